@@ -0,0 +1,553 @@
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/internal/baseprotocol"
+	"github.com/tomocy/warabi/object"
+)
+
+// Server serves the Debug Adapter Protocol so that editors can debug
+// programs with the interpreter.
+type Server struct {
+	interpreter *evaluator.Interpreter
+}
+
+func NewServer(interpreter *evaluator.Interpreter) *Server {
+	return &Server{
+		interpreter: interpreter,
+	}
+}
+
+// Serve serves a client, which launches a program at most, until it
+// disconnects or r is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &session{
+		interpreter:       *s.interpreter,
+		w:                 &writer{w: w},
+		ctx:               ctx,
+		cancel:            cancel,
+		sourceBreakpoints: make(map[string][]int),
+	}
+	defer sess.terminate()
+
+	return sess.serve(bufio.NewReader(r))
+}
+
+// threadID is the ID of the only thread, which runs the program.
+const threadID = 1
+
+var (
+	errNotLaunched = errors.New("no program is launched")
+	errRunning     = errors.New("program is running")
+	errExited      = errors.New("program has exited")
+)
+
+// session is the state of a client. The debugger is resumed in
+// a goroutine so that pause requests can interrupt it, and the other
+// requests are handled while it is stopped.
+type session struct {
+	interpreter evaluator.Interpreter
+	w           *writer
+	ctx         context.Context
+	cancel      context.CancelFunc
+	stopOnEntry bool
+	done        bool
+
+	mu                  sync.Mutex
+	debugger            evaluator.Debugger
+	sourceBreakpoints   map[string][]int
+	functionBreakpoints []int
+	running             bool
+	exited              bool
+	interrupt           context.CancelFunc
+	resumed             chan struct{}
+}
+
+// handler handles the arguments of a request and returns the body of
+// the response. then, if any, is called after the response is sent.
+type handler func(sess *session, args json.RawMessage) (body interface{}, then func(), err error)
+
+var handlers = map[string]handler{
+	"initialize":              (*session).initialize,
+	"launch":                  (*session).launch,
+	"setBreakpoints":          (*session).setBreakpoints,
+	"setFunctionBreakpoints":  (*session).setFunctionBreakpoints,
+	"setExceptionBreakpoints": (*session).setExceptionBreakpoints,
+	"configurationDone":       (*session).configurationDone,
+	"threads":                 (*session).threads,
+	"stackTrace":              (*session).stackTrace,
+	"scopes":                  (*session).scopes,
+	"variables":               (*session).variables,
+	"evaluate":                (*session).evaluate,
+	"continue":                resumeBy(evaluator.Debugger.Continue),
+	"next":                    resumeBy(evaluator.Debugger.StepOver),
+	"stepIn":                  resumeBy(evaluator.Debugger.StepIn),
+	"stepOut":                 resumeBy(evaluator.Debugger.StepOut),
+	"pause":                   (*session).pause,
+	"disconnect":              (*session).disconnect,
+	"terminate":               (*session).disconnect,
+}
+
+func (sess *session) serve(r *bufio.Reader) error {
+	for !sess.done {
+		var req request
+		if err := baseprotocol.ReadMessage(r, &req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		handle, ok := handlers[req.Command]
+		if !ok {
+			if err := sess.w.respondError(req, fmt.Errorf("unsupported request: %s", req.Command)); err != nil {
+				return err
+			}
+			continue
+		}
+		body, then, err := handle(sess, req.Arguments)
+		if err != nil {
+			if err := sess.w.respondError(req, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := sess.w.respond(req, body); err != nil {
+			return err
+		}
+		if then != nil {
+			then()
+		}
+	}
+
+	return nil
+}
+
+func (sess *session) initialize(args json.RawMessage) (interface{}, func(), error) {
+	return capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsFunctionBreakpoints:      true,
+		SupportsEvaluateForHovers:        true,
+	}, nil, nil
+}
+
+// launch loads the program, which does not start until configurationDone,
+// so that the client can set breakpoints after the initialized event.
+func (sess *session) launch(rawArgs json.RawMessage) (interface{}, func(), error) {
+	var args launchArguments
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, nil, err
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.debugger != nil {
+		return nil, nil, errors.New("program is already launched")
+	}
+
+	interpreter := sess.interpreter
+	interpreter.SetOutput(outputWriter{
+		w:        sess.w,
+		category: "stdout",
+	})
+	debugger, err := interpreter.Debug(sess.ctx, args.Program)
+	if err != nil {
+		return nil, nil, err
+	}
+	sess.debugger = debugger
+	sess.stopOnEntry = args.StopOnEntry
+
+	return nil, func() {
+		sess.w.emit("initialized", nil)
+	}, nil
+}
+
+func (sess *session) setBreakpoints(rawArgs json.RawMessage) (interface{}, func(), error) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, nil, err
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.debugger == nil {
+		return nil, nil, errNotLaunched
+	}
+
+	path := args.Source.Path
+	for _, id := range sess.sourceBreakpoints[path] {
+		sess.debugger.ClearBreakpoint(id)
+	}
+	sess.sourceBreakpoints[path] = nil
+
+	breakpoints := make([]breakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		set, err := sess.debugger.SetBreakpoint(path + ":" + strconv.Itoa(b.Line))
+		if err != nil {
+			breakpoints[i] = breakpoint{
+				Message: err.Error(),
+				Line:    b.Line,
+			}
+			continue
+		}
+		sess.sourceBreakpoints[path] = append(sess.sourceBreakpoints[path], set.ID)
+		breakpoints[i] = breakpoint{
+			ID:       set.ID,
+			Verified: true,
+			Line:     b.Line,
+			Source:   &args.Source,
+		}
+	}
+
+	return breakpointsBody{
+		Breakpoints: breakpoints,
+	}, nil, nil
+}
+
+func (sess *session) setFunctionBreakpoints(rawArgs json.RawMessage) (interface{}, func(), error) {
+	var args setFunctionBreakpointsArguments
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, nil, err
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.debugger == nil {
+		return nil, nil, errNotLaunched
+	}
+
+	for _, id := range sess.functionBreakpoints {
+		sess.debugger.ClearBreakpoint(id)
+	}
+	sess.functionBreakpoints = nil
+
+	breakpoints := make([]breakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		set, err := sess.debugger.SetBreakpoint(b.Name)
+		if err != nil {
+			breakpoints[i] = breakpoint{
+				Message: err.Error(),
+			}
+			continue
+		}
+		sess.functionBreakpoints = append(sess.functionBreakpoints, set.ID)
+		breakpoints[i] = breakpoint{
+			ID:       set.ID,
+			Verified: true,
+		}
+	}
+
+	return breakpointsBody{
+		Breakpoints: breakpoints,
+	}, nil, nil
+}
+
+// setExceptionBreakpoints accepts no filters since panics cannot be
+// stopped at.
+func (sess *session) setExceptionBreakpoints(args json.RawMessage) (interface{}, func(), error) {
+	return breakpointsBody{
+		Breakpoints: []breakpoint{},
+	}, nil, nil
+}
+
+func (sess *session) configurationDone(args json.RawMessage) (interface{}, func(), error) {
+	if err := sess.checkResumable(); err != nil {
+		return nil, nil, err
+	}
+
+	if sess.stopOnEntry {
+		return nil, func() {
+			sess.resume(evaluator.Debugger.StepIn, "entry")
+		}, nil
+	}
+	return nil, func() {
+		sess.resume(evaluator.Debugger.Continue, "")
+	}, nil
+}
+
+func (sess *session) threads(args json.RawMessage) (interface{}, func(), error) {
+	return threadsBody{
+		Threads: []thread{
+			{
+				ID:   threadID,
+				Name: "main",
+			},
+		},
+	}, nil, nil
+}
+
+// stackTrace numbers the frames from 1 for the innermost one, since 0
+// means no frame in the protocol. The IDs are valid until the program
+// is resumed.
+func (sess *session) stackTrace(rawArgs json.RawMessage) (interface{}, func(), error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if err := sess.checkStopped(); err != nil {
+		return nil, nil, err
+	}
+
+	frames, err := sess.debugger.Stack()
+	if err != nil {
+		return nil, nil, err
+	}
+	stackFrames := make([]stackFrame, len(frames))
+	for i, frame := range frames {
+		stackFrames[i] = stackFrame{
+			ID:     i + 1,
+			Name:   frame.Function,
+			Line:   frame.Position.Line,
+			Column: frame.Position.Column,
+		}
+		if frame.Position.IsValid() {
+			stackFrames[i].Source = &source{
+				Name: filepath.Base(frame.Position.Filename),
+				Path: frame.Position.Filename,
+			}
+		}
+	}
+
+	return stackTraceBody{
+		StackFrames: stackFrames,
+		TotalFrames: len(stackFrames),
+	}, nil, nil
+}
+
+// scopes returns the locals of the frame as the only scope, which
+// variables are referred to by the ID of the frame.
+func (sess *session) scopes(rawArgs json.RawMessage) (interface{}, func(), error) {
+	var args scopesArguments
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, nil, err
+	}
+
+	return scopesBody{
+		Scopes: []scope{
+			{
+				Name:               "Locals",
+				VariablesReference: args.FrameID,
+			},
+		},
+	}, nil, nil
+}
+
+func (sess *session) variables(rawArgs json.RawMessage) (interface{}, func(), error) {
+	var args variablesArguments
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, nil, err
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if err := sess.checkStopped(); err != nil {
+		return nil, nil, err
+	}
+
+	vars, err := sess.debugger.Locals(args.VariablesReference - 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	variables := make([]variable, len(vars))
+	for i, v := range vars {
+		name := v.Name
+		if v.Shadowed {
+			name = fmt.Sprintf("(%s)", name)
+		}
+		variables[i] = variable{
+			Name: name,
+		}
+		variables[i].Value, variables[i].Type = describe(v.Value)
+	}
+
+	return variablesBody{
+		Variables: variables,
+	}, nil, nil
+}
+
+// evaluate evaluates the expression in the innermost frame unless
+// a frame is given.
+func (sess *session) evaluate(rawArgs json.RawMessage) (interface{}, func(), error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, nil, err
+	}
+	frame := 0
+	if args.FrameID != 0 {
+		frame = args.FrameID - 1
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if err := sess.checkStopped(); err != nil {
+		return nil, nil, err
+	}
+
+	obj, err := sess.debugger.Evaluate(sess.ctx, frame, args.Expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	var body evaluateBody
+	body.Result, body.Type = describe(obj)
+
+	return body, nil, nil
+}
+
+func describe(obj object.Object) (string, string) {
+	if obj == nil {
+		return "<nil>", ""
+	}
+
+	return obj.String(), obj.Kind().String()
+}
+
+func resumeBy(step func(evaluator.Debugger, context.Context) (evaluator.Stop, error)) handler {
+	return func(sess *session, args json.RawMessage) (interface{}, func(), error) {
+		if err := sess.checkResumable(); err != nil {
+			return nil, nil, err
+		}
+
+		return continueBody{
+			AllThreadsContinued: true,
+		}, func() {
+			sess.resume(step, "")
+		}, nil
+	}
+}
+
+func (sess *session) pause(args json.RawMessage) (interface{}, func(), error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.running {
+		sess.interrupt()
+	}
+
+	return nil, nil, nil
+}
+
+func (sess *session) disconnect(args json.RawMessage) (interface{}, func(), error) {
+	sess.terminate()
+	sess.done = true
+	return nil, nil, nil
+}
+
+func (sess *session) checkResumable() error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	return sess.checkStopped()
+}
+
+// checkStopped is called with mu held.
+func (sess *session) checkStopped() error {
+	switch {
+	case sess.debugger == nil:
+		return errNotLaunched
+	case sess.exited:
+		return errExited
+	case sess.running:
+		return errRunning
+	default:
+		return nil
+	}
+}
+
+// resume resumes the program in a goroutine, which reports where it
+// stops as an event. reason, if any, replaces the reason of the stop.
+func (sess *session) resume(step func(evaluator.Debugger, context.Context) (evaluator.Stop, error), reason string) {
+	sess.mu.Lock()
+	ctx, interrupt := context.WithCancel(sess.ctx)
+	resumed := make(chan struct{})
+	sess.running, sess.interrupt, sess.resumed = true, interrupt, resumed
+	debugger := sess.debugger
+	sess.mu.Unlock()
+
+	go func() {
+		defer close(resumed)
+		defer interrupt()
+
+		stop, err := step(debugger, ctx)
+		sess.mu.Lock()
+		sess.running = false
+		sess.exited = err != nil || stop.Reason == evaluator.StopExit
+		sess.mu.Unlock()
+
+		if err != nil {
+			sess.w.emit("terminated", nil)
+			return
+		}
+		sess.report(stop, reason)
+	}()
+}
+
+func (sess *session) report(stop evaluator.Stop, reason string) {
+	if stop.Reason == evaluator.StopExit {
+		code := 0
+		if stop.Err != nil {
+			code = 1
+			var runtimeErr *evaluator.RuntimeError
+			if errors.As(stop.Err, &runtimeErr) {
+				code = 2
+			}
+			sess.w.emit("output", outputEventBody{
+				Category: "stderr",
+				Output:   stop.Err.Error() + "\n",
+			})
+		}
+		sess.w.emit("exited", exitedEventBody{
+			ExitCode: code,
+		})
+		sess.w.emit("terminated", nil)
+		return
+	}
+
+	body := stoppedEventBody{
+		Reason:            reason,
+		ThreadID:          threadID,
+		AllThreadsStopped: true,
+	}
+	if body.Reason == "" {
+		switch stop.Reason {
+		case evaluator.StopBreakpoint:
+			body.Reason = "breakpoint"
+			body.HitBreakpointIDs = []int{stop.Breakpoint.ID}
+		case evaluator.StopInterrupt:
+			body.Reason = "pause"
+		default:
+			body.Reason = "step"
+		}
+	}
+	sess.w.emit("stopped", body)
+}
+
+// terminate interrupts the program if it is running, and aborts it.
+func (sess *session) terminate() {
+	sess.mu.Lock()
+	if sess.running {
+		sess.interrupt()
+	}
+	resumed := sess.resumed
+	sess.mu.Unlock()
+	if resumed != nil {
+		<-resumed
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.debugger != nil {
+		sess.debugger.Abort()
+	}
+	sess.cancel()
+}
@@ -0,0 +1,248 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/internal/baseprotocol"
+)
+
+const debuggedSource = `package main
+
+import "fmt"
+
+func show(n int) {
+	doubled := n * 2
+	fmt.Println(n, doubled)
+}
+
+func main() {
+	n := 1
+	show(n)
+	fmt.Println("done")
+}
+`
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(filename, []byte(debuggedSource), 0644); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	c := startClient(t)
+
+	c.request("initialize", map[string]interface{}{"adapterID": "warabi"})
+	if got := c.expectResponse("initialize"); got.Body["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("unexpected capabilities: %v\n", got.Body)
+	}
+
+	c.request("launch", map[string]interface{}{"program": filename})
+	c.expectResponse("launch")
+	c.expectEvent("initialized")
+
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": filename},
+		"breakpoints": []interface{}{map[string]interface{}{"line": 6}, map[string]interface{}{"line": 8}},
+	})
+	got := c.expectResponse("setBreakpoints")
+	if got, want := fmt.Sprint(got.Body["breakpoints"]), "[map[id:1 line:6 source:map[path:"+filename+"] verified:true] map[line:8 message:no statement at "+filename+":8 verified:false]]"; got != want {
+		t.Errorf("unexpected breakpoints: got %s, expected %s\n", got, want)
+	}
+
+	c.request("configurationDone", nil)
+	c.expectResponse("configurationDone")
+	if got := c.expectEvent("stopped"); got.Body["reason"] != "breakpoint" {
+		t.Errorf("unexpected stop: %v\n", got.Body)
+	}
+
+	c.request("stackTrace", map[string]interface{}{"threadId": threadID})
+	got = c.expectResponse("stackTrace")
+	var frames []string
+	for _, frame := range got.Body["stackFrames"].([]interface{}) {
+		frame := frame.(map[string]interface{})
+		frames = append(frames, fmt.Sprintf("%v %v:%v", frame["name"], filepath.Base(fmt.Sprint(frame["source"].(map[string]interface{})["path"])), frame["line"]))
+	}
+	if got, want := strings.Join(frames, ", "), "show main.go:6, main main.go:12"; got != want {
+		t.Errorf("unexpected stack: got %s, expected %s\n", got, want)
+	}
+
+	c.request("scopes", map[string]interface{}{"frameId": 2})
+	got = c.expectResponse("scopes")
+	reference := got.Body["scopes"].([]interface{})[0].(map[string]interface{})["variablesReference"]
+	c.request("variables", map[string]interface{}{"variablesReference": reference})
+	got = c.expectResponse("variables")
+	if got, want := fmt.Sprint(got.Body["variables"]), "[map[name:n type:int value:1 variablesReference:0]]"; got != want {
+		t.Errorf("unexpected variables: got %s, expected %s\n", got, want)
+	}
+
+	c.request("evaluate", map[string]interface{}{"expression": "n + 10", "frameId": 1})
+	if got := c.expectResponse("evaluate"); got.Body["result"] != "11" {
+		t.Errorf("unexpected result: %v\n", got.Body)
+	}
+
+	c.request("next", map[string]interface{}{"threadId": threadID})
+	c.expectResponse("next")
+	if got := c.expectEvent("stopped"); got.Body["reason"] != "step" {
+		t.Errorf("unexpected stop: %v\n", got.Body)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": threadID})
+	c.expectResponse("continue")
+	if got := c.expectEvent("exited"); got.Body["exitCode"] != 0.0 {
+		t.Errorf("unexpected exit: %v\n", got.Body)
+	}
+	c.expectEvent("terminated")
+	if got, want := c.output, "1 2\ndone\n"; got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+
+	c.request("threads", nil)
+	c.expectResponse("threads")
+	c.request("stackTrace", map[string]interface{}{"threadId": threadID})
+	if got := c.expectMessage(); got.Command != "stackTrace" || got.Success {
+		t.Errorf("unexpected response of exited program: %+v\n", got)
+	}
+
+	c.request("disconnect", nil)
+	c.expectResponse("disconnect")
+	c.close()
+}
+
+type message struct {
+	Type    string                 `json:"type"`
+	Command string                 `json:"command"`
+	Event   string                 `json:"event"`
+	Success bool                   `json:"success"`
+	Message string                 `json:"message"`
+	Body    map[string]interface{} `json:"body"`
+}
+
+// client is a scripted client, which fails the test on what
+// it does not expect.
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	seq    int
+	output string
+	done   chan error
+}
+
+func startClient(t *testing.T) *client {
+	requestR, requestW := io.Pipe()
+	responseR, responseW := io.Pipe()
+	c := &client{
+		t:    t,
+		w:    requestW,
+		r:    bufio.NewReader(responseR),
+		done: make(chan error, 1),
+	}
+	go func() {
+		err := NewServer(evaluator.NewInterpreter(evaluator.TreeWalk)).Serve(requestR, responseW)
+		responseW.Close()
+		c.done <- err
+	}()
+
+	return c
+}
+
+func (c *client) request(command string, args interface{}) {
+	c.t.Helper()
+
+	c.seq++
+	body, err := json.Marshal(map[string]interface{}{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": args,
+	})
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+}
+
+// expectMessage returns the next message other than output events,
+// which are collected.
+func (c *client) expectMessage() message {
+	c.t.Helper()
+
+	received := make(chan message)
+	errs := make(chan error)
+	go func() {
+		for {
+			var msg message
+			if err := baseprotocol.ReadMessage(c.r, &msg); err != nil {
+				errs <- err
+				return
+			}
+			if msg.Type == "event" && msg.Event == "output" {
+				c.output += fmt.Sprint(msg.Body["output"])
+				continue
+			}
+			received <- msg
+			return
+		}
+	}()
+
+	select {
+	case msg := <-received:
+		return msg
+	case err := <-errs:
+		c.t.Fatalf("unexpected error: %s\n", err)
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("no message is received\n")
+	}
+
+	return message{}
+}
+
+func (c *client) expectResponse(command string) message {
+	c.t.Helper()
+
+	msg := c.expectMessage()
+	if msg.Type != "response" || msg.Command != command {
+		c.t.Fatalf("unexpected message: got %+v, expected response of %s\n", msg, command)
+	}
+	if !msg.Success {
+		c.t.Fatalf("unexpected failure of %s: %s\n", command, msg.Message)
+	}
+
+	return msg
+}
+
+func (c *client) expectEvent(name string) message {
+	c.t.Helper()
+
+	msg := c.expectMessage()
+	if msg.Type != "event" || msg.Event != name {
+		c.t.Fatalf("unexpected message: got %+v, expected %s event\n", msg, name)
+	}
+
+	return msg
+}
+
+func (c *client) close() {
+	c.t.Helper()
+
+	c.w.Close()
+	if err := <-c.done; err != nil {
+		c.t.Errorf("unexpected error: %s\n", err)
+	}
+}
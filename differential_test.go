@@ -0,0 +1,185 @@
+//go:build differential
+// +build differential
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomocy/warabi/evaluator"
+)
+
+// TestDifferential runs each program in testdata/differential with the go
+// command and with warabi run on every backend, and compares what they write to
+// stdout, their exit codes and their panic messages.
+//
+//	go test -tags differential -run Differential .
+func TestDifferential(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command is not found")
+	}
+	filenames, err := filepath.Glob(filepath.Join("testdata", "differential", "*.go"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	for _, filename := range filenames {
+		filename := filename
+		t.Run(strings.TrimSuffix(filepath.Base(filename), ".go"), func(t *testing.T) {
+			want, err := runGo(filename)
+			if err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+
+			for _, backend := range []evaluator.Backend{evaluator.TreeWalk, evaluator.VM, evaluator.Closure} {
+				got := runWarabi(filename, backend)
+				if diff := got.diff(want); diff != "" {
+					src, _ := ioutil.ReadFile(filename)
+					t.Errorf("%s: warabi (-) and go (+) differ:\n%s\nprogram:\n%s", backend, diff, src)
+				}
+			}
+		})
+	}
+}
+
+type programResult struct {
+	stdout string
+	code   int
+	panic  string
+}
+
+// runGo builds the program and runs the binary rather than go run,
+// which reports exit codes other than 0 as 1.
+func runGo(filename string) (programResult, error) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		return programResult{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	binary := filepath.Join(dir, "program")
+	if out, err := exec.CommandContext(ctx, "go", "build", "-o", binary, filename).CombinedOutput(); err != nil {
+		return programResult{}, fmt.Errorf("failed to build %s: %s\n%s", filename, err, out)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return programResult{}, err
+		}
+	}
+
+	return programResult{
+		stdout: stdout.String(),
+		code:   cmd.ProcessState.ExitCode(),
+		panic:  panicMessage(stderr.String()),
+	}, nil
+}
+
+// runWarabi runs the program in this process since the evaluation of
+// run command does not depend on anything but its arguments.
+func runWarabi(filename string, backend evaluator.Backend) programResult {
+	var stdout, stderr bytes.Buffer
+	code := run(
+		[]string{"run", "--backend", backend.String(), "--timeout", "10s", filename},
+		strings.NewReader(""), &stdout, &stderr,
+	)
+
+	return programResult{
+		stdout: stdout.String(),
+		code:   code,
+		panic:  panicMessage(stderr.String()),
+	}
+}
+
+// panicMessage returns the line of the panic in stderr, dropping the
+// goroutine traces.
+func panicMessage(stderr string) string {
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.HasPrefix(line, "panic: ") {
+			return strings.TrimSuffix(line, " [recovered]")
+		}
+	}
+
+	return ""
+}
+
+func (r programResult) diff(other programResult) string {
+	var b strings.Builder
+	if r.code != other.code {
+		fmt.Fprintf(&b, "exit code:\n- %d\n+ %d\n", r.code, other.code)
+	}
+	if r.panic != other.panic {
+		fmt.Fprintf(&b, "panic:\n- %s\n+ %s\n", r.panic, other.panic)
+	}
+	if r.stdout != other.stdout {
+		fmt.Fprintf(&b, "stdout:\n%s", diffLines(r.stdout, other.stdout))
+	}
+
+	return b.String()
+}
+
+// diffLines returns the lines which are only in a or only in b, marked with
+// - and + respectively, along with the longest common subsequence of them.
+func diffLines(a, b string) string {
+	as, bs := strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n")
+	lengths := make([][]int, len(as)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; 0 <= i; i-- {
+		for j := len(bs) - 1; 0 <= j; j-- {
+			if as[i] == bs[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	writeLine := func(mark, line string) {
+		if line == "" {
+			return
+		}
+		fmt.Fprintf(&diff, "%s %q\n", mark, line)
+	}
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			writeLine(" ", as[i])
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			writeLine("-", as[i])
+			i++
+		default:
+			writeLine("+", bs[j])
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		writeLine("-", as[i])
+	}
+	for ; j < len(bs); j++ {
+		writeLine("+", bs[j])
+	}
+
+	return diff.String()
+}
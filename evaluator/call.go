@@ -0,0 +1,196 @@
+package evaluator
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sync"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// functionCaller runs the body of a function in the backend which calls it.
+type functionCaller interface {
+	callFunction(fn *object.FunctionLiteral, args []object.Object)
+}
+
+func newFunctionLiteral(t *ast.FuncType, body *ast.BlockStmt, env *object.Environment) *object.FunctionLiteral {
+	fn := &object.FunctionLiteral{
+		Params:  fieldList(t.Params),
+		Results: fieldList(t.Results),
+		Env:     env,
+		Type:    t,
+	}
+	if body != nil {
+		fn.Body = body.List
+	}
+
+	return fn
+}
+
+// functionCache keeps the bodies of the functions compiled by the vm and
+// the closure backends, keyed by their types in the source, so that the
+// function literals evaluated from the same source over and over share
+// them across calls and evaluations.
+type functionCache struct {
+	mu        sync.Mutex
+	bytecodes map[*ast.FuncType]*bytecode
+	closures  map[*ast.FuncType]closureProgram
+}
+
+func newFunctionCache() *functionCache {
+	return &functionCache{
+		bytecodes: make(map[*ast.FuncType]*bytecode),
+		closures:  make(map[*ast.FuncType]closureProgram),
+	}
+}
+
+// bytecode returns the compiled body of fn, compiling it if it is not
+// yet. A nil cache compiles it every time.
+func (c *functionCache) bytecode(fn *object.FunctionLiteral) *bytecode {
+	if c == nil || fn.Type == nil {
+		code := compileFunction(fn)
+		return &code
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	code, ok := c.bytecodes[fn.Type]
+	if !ok {
+		compiled := compileFunction(fn)
+		code = &compiled
+		c.bytecodes[fn.Type] = code
+	}
+
+	return code
+}
+
+// closureProgram is what bytecode is for the closure backend.
+func (c *functionCache) closureProgram(fn *object.FunctionLiteral) closureProgram {
+	if c == nil || fn.Type == nil {
+		return compileClosuresOfFunction(fn)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	program, ok := c.closures[fn.Type]
+	if !ok {
+		program = compileClosuresOfFunction(fn)
+		c.closures[fn.Type] = program
+	}
+
+	return program
+}
+
+func parameterNames(fn *object.FunctionLiteral) []string {
+	var names []string
+	for _, param := range fn.Params {
+		if len(param.Names) == 0 {
+			names = append(names, "_")
+			continue
+		}
+		for _, name := range param.Names {
+			names = append(names, name.Name)
+		}
+	}
+
+	return names
+}
+
+// scopeOf returns the environment to call fn in, which is the one fn was
+// declared in if any.
+func scopeOf(fn *object.FunctionLiteral, env *object.Environment) *object.Environment {
+	if fn.Env != nil {
+		return fn.Env
+	}
+
+	return env
+}
+
+func callObject(
+	caller functionCaller,
+	limiter *limiter,
+	expr *ast.CallExpr,
+	fnObj object.Object,
+	args []object.Object,
+) object.Object {
+	for i, arg := range args {
+		valueOf(arg, expr.Args[i])
+	}
+
+	return callObjectAt(caller, limiter, types.ExprString(expr.Fun), expr.Lparen, fnObj, args)
+}
+
+func callObjectAt(
+	caller functionCaller,
+	limiter *limiter,
+	name string,
+	pos token.Pos,
+	fnObj object.Object,
+	args []object.Object,
+) (result object.Object) {
+	limiter.pushCall(name, pos)
+	defer limiter.popCall()
+	if limiter.observing() {
+		limiter.observeCall(name, pos, args)
+		defer func() {
+			limiter.observeReturn(name, pos, result, recover())
+		}()
+	}
+
+	switch fn := fnObj.(type) {
+	case *object.Builtin:
+		obj, err := fn.Fn(builtinCaller{
+			caller:  caller,
+			limiter: limiter,
+		}, args)
+		if err != nil {
+			bail(err)
+		}
+		return obj
+	case *object.FunctionLiteral:
+		params := parameterNames(fn)
+		if len(args) < len(params) {
+			bail(errorAt(pos, "not enough arguments in call to %s", name))
+		}
+		if len(params) < len(args) {
+			bail(errorAt(pos, "too many arguments in call to %s", name))
+		}
+		limiter.enter()
+		caller.callFunction(fn, args)
+		limiter.leave()
+		return nil
+	default:
+		bail(errorAt(pos, "cannot call non-function %s", name))
+		return nil
+	}
+}
+
+type builtinCaller struct {
+	caller  functionCaller
+	limiter *limiter
+}
+
+func (c builtinCaller) Call(fn object.Object, args ...object.Object) (obj object.Object, err error) {
+	mark := c.limiter.mark()
+	defer c.limiter.restore(mark)
+	defer recoverBailout(&err, c.limiter.files())
+
+	return callObjectAt(c.caller, c.limiter, "func", token.NoPos, fn, args), nil
+}
+
+func (c builtinCaller) Frames() []object.Frame {
+	return c.limiter.frames()
+}
+
+func condition(obj object.Object, expr ast.Expr) bool {
+	switch obj {
+	case object.True:
+		return true
+	case object.False:
+		return false
+	default:
+		bail(errorAt(expr.Pos(), "non-boolean condition in if statement"))
+		return false
+	}
+}
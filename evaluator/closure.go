@@ -0,0 +1,436 @@
+package evaluator
+
+import (
+	"go/ast"
+
+	"github.com/tomocy/warabi/object"
+)
+
+type closureFrame struct {
+	slots     []object.Object
+	env       *object.Environment
+	limiter   *limiter
+	functions *functionCache
+}
+
+type closure func(*closureFrame) object.Object
+
+type closureProgram struct {
+	declarations []func(*closureFrame) []object.Object
+	slotSize     int
+}
+
+func newClosureFrame(env *object.Environment, limiter *limiter, functions *functionCache) *closureFrame {
+	return &closureFrame{
+		env:       env,
+		limiter:   limiter,
+		functions: functions,
+	}
+}
+
+func (p closureProgram) run(env *object.Environment, limiter *limiter, functions *functionCache) []object.Object {
+	frame := newClosureFrame(env, limiter, functions)
+	frame.slots = make([]object.Object, p.slotSize)
+	var objs []object.Object
+	for _, declaration := range p.declarations {
+		objs = append(objs, declaration(frame)...)
+	}
+
+	return objs
+}
+
+// call runs the program of a function body with the arguments in
+// the first slots. The frame shares the compiled functions with caller.
+func (p closureProgram) call(caller *closureFrame, env *object.Environment, args []object.Object) {
+	frame := &closureFrame{
+		slots:     make([]object.Object, p.slotSize),
+		env:       env,
+		limiter:   caller.limiter,
+		functions: caller.functions,
+	}
+	copy(frame.slots, args)
+	for _, declaration := range p.declarations {
+		declaration(frame)
+	}
+}
+
+// callFunction compiles the body of fn on the first call and reuses it.
+func (f *closureFrame) callFunction(fn *object.FunctionLiteral, args []object.Object) {
+	f.functions.closureProgram(fn).call(f, scopeOf(fn, f.env), args)
+}
+
+type closureCompiler struct {
+	slotIndexes map[string]int
+	slotSize    int
+	local       bool
+}
+
+func compileClosures(decls []ast.Decl) closureProgram {
+	c := newClosureCompiler()
+	var program closureProgram
+	for _, decl := range decls {
+		program.declarations = append(program.declarations, c.compileDeclaration(decl))
+	}
+	program.slotSize = c.slotSize
+
+	return program
+}
+
+func compileClosuresOfExpression(expr ast.Expr) closureProgram {
+	c := newClosureCompiler()
+	compiled := c.compileExpression(expr)
+	return closureProgram{
+		declarations: []func(*closureFrame) []object.Object{
+			func(frame *closureFrame) []object.Object {
+				return []object.Object{compiled(frame)}
+			},
+		},
+	}
+}
+
+func compileClosuresOfFunction(fn *object.FunctionLiteral) closureProgram {
+	c := newClosureCompiler()
+	c.local = true
+	for _, name := range parameterNames(fn) {
+		c.declareSlot(name)
+	}
+	var program closureProgram
+	for _, stmt := range fn.Body {
+		program.declarations = append(program.declarations, c.compileStatement(stmt))
+	}
+	program.slotSize = c.slotSize
+
+	return program
+}
+
+func newClosureCompiler() *closureCompiler {
+	return &closureCompiler{
+		slotIndexes: make(map[string]int),
+	}
+}
+
+func (c *closureCompiler) compileDeclaration(decl ast.Decl) func(*closureFrame) []object.Object {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return func(frame *closureFrame) []object.Object {
+			fn := newFunctionLiteral(decl.Type, decl.Body, frame.env)
+			if isReferable(decl) {
+				frame.env.Set(decl.Name.Name, fn)
+			}
+
+			return []object.Object{fn}
+		}
+	case *ast.GenDecl:
+		return c.compileGenericsDeclaration(decl)
+	default:
+		return func(*closureFrame) []object.Object {
+			return nil
+		}
+	}
+}
+
+func (c *closureCompiler) compileStatement(stmt ast.Stmt) func(*closureFrame) []object.Object {
+	switch stmt := stmt.(type) {
+	case *ast.DeclStmt:
+		return c.compileDeclaration(stmt.Decl)
+	case *ast.AssignStmt:
+		return c.compileShortVariableDeclaration(stmt)
+	case *ast.ExprStmt:
+		expr := c.compileExpression(stmt.X)
+		return func(frame *closureFrame) []object.Object {
+			expr(frame)
+			return nil
+		}
+	case *ast.BlockStmt:
+		defer c.enterScope()()
+		return c.compileStatements(stmt.List)
+	case *ast.IfStmt:
+		defer c.enterScope()()
+		return c.compileIf(stmt)
+	case *ast.EmptyStmt:
+		return func(*closureFrame) []object.Object {
+			return nil
+		}
+	default:
+		return func(*closureFrame) []object.Object {
+			bailUnsupported(stmt)
+			return nil
+		}
+	}
+}
+
+func (c *closureCompiler) compileStatements(stmts []ast.Stmt) func(*closureFrame) []object.Object {
+	compiled := make([]func(*closureFrame) []object.Object, len(stmts))
+	for i, stmt := range stmts {
+		compiled[i] = c.compileStatement(stmt)
+	}
+
+	return func(frame *closureFrame) []object.Object {
+		for _, stmt := range compiled {
+			frame.limiter.step()
+			stmt(frame)
+		}
+
+		return nil
+	}
+}
+
+func (c *closureCompiler) compileShortVariableDeclaration(stmt *ast.AssignStmt) func(*closureFrame) []object.Object {
+	names, ok := definedNames(stmt)
+	if !ok {
+		return func(*closureFrame) []object.Object {
+			bailUnsupported(stmt)
+			return nil
+		}
+	}
+	values := make([]closure, len(stmt.Rhs))
+	for i, value := range stmt.Rhs {
+		values[i] = c.compileExpression(value)
+	}
+	slots := make([]int, len(names))
+	for i, name := range names {
+		slots[i] = c.declareSlot(name)
+	}
+
+	return func(frame *closureFrame) []object.Object {
+		objs := make([]object.Object, len(values))
+		for i, value := range values {
+			objs[i] = valueOf(value(frame), stmt.Rhs[i])
+		}
+		for i, slot := range slots {
+			frame.slots[slot] = objs[i]
+		}
+
+		return nil
+	}
+}
+
+func (c *closureCompiler) compileIf(stmt *ast.IfStmt) func(*closureFrame) []object.Object {
+	init := func(*closureFrame) []object.Object {
+		return nil
+	}
+	if stmt.Init != nil {
+		init = c.compileStatement(stmt.Init)
+	}
+	cond := c.compileExpression(stmt.Cond)
+	body := c.compileStatement(stmt.Body)
+	els := func(*closureFrame) []object.Object {
+		return nil
+	}
+	if stmt.Else != nil {
+		els = c.compileStatement(stmt.Else)
+	}
+
+	return func(frame *closureFrame) []object.Object {
+		init(frame)
+		if condition(cond(frame), stmt.Cond) {
+			return body(frame)
+		}
+		return els(frame)
+	}
+}
+
+// enterScope starts a block scope of slots and returns the function
+// to end it.
+func (c *closureCompiler) enterScope() func() {
+	outer := c.slotIndexes
+	c.slotIndexes = copyIndexes(outer)
+	return func() {
+		c.slotIndexes = outer
+	}
+}
+
+func (c *closureCompiler) compileGenericsDeclaration(decl *ast.GenDecl) func(*closureFrame) []object.Object {
+	var specs []func(*closureFrame) []object.Object
+	for _, spec := range decl.Specs {
+		spec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		specs = append(specs, c.compileValueSpecification(spec))
+	}
+
+	return func(frame *closureFrame) []object.Object {
+		var objs []object.Object
+		for _, spec := range specs {
+			objs = append(objs, spec(frame)...)
+		}
+
+		return objs
+	}
+}
+
+func (c *closureCompiler) compileValueSpecification(spec *ast.ValueSpec) func(*closureFrame) []object.Object {
+	spec = normalizeValueSpecification(spec)
+	assigns := make([]closure, len(spec.Names))
+	for i := 0; i < len(spec.Names); i++ {
+		value, expr := c.compileExpression(spec.Values[i]), spec.Values[i]
+		assigns[i] = c.compileAssignment(spec.Names[i].Name, func(frame *closureFrame) object.Object {
+			return valueOf(value(frame), expr)
+		})
+	}
+
+	return func(frame *closureFrame) []object.Object {
+		objs := make([]object.Object, len(assigns))
+		for i, assign := range assigns {
+			objs[i] = assign(frame)
+		}
+
+		return objs
+	}
+}
+
+func (c *closureCompiler) compileAssignment(name string, value closure) closure {
+	if object.IsBuiltin(name) {
+		return func(frame *closureFrame) object.Object {
+			obj := value(frame)
+			frame.env.Set(name, obj)
+			return obj
+		}
+	}
+
+	if c.local {
+		slot := c.declareSlot(name)
+		return func(frame *closureFrame) object.Object {
+			obj := value(frame)
+			frame.slots[slot] = obj
+			return obj
+		}
+	}
+
+	slot := c.resolveSlot(name)
+	return func(frame *closureFrame) object.Object {
+		obj := value(frame)
+		frame.slots[slot] = obj
+		frame.env.Set(name, obj)
+		return obj
+	}
+}
+
+func (c *closureCompiler) resolveSlot(name string) int {
+	if slot, ok := c.slotIndexes[name]; ok {
+		return slot
+	}
+
+	return c.declareSlot(name)
+}
+
+func (c *closureCompiler) declareSlot(name string) int {
+	c.slotIndexes[name] = c.slotSize
+	c.slotSize++
+	return c.slotIndexes[name]
+}
+
+func (c *closureCompiler) compileExpression(expr ast.Expr) closure {
+	compiled := c.compileExpressionOf(expr)
+	return func(frame *closureFrame) object.Object {
+		frame.limiter.step()
+		return compiled(frame)
+	}
+}
+
+func (c *closureCompiler) compileExpressionOf(expr ast.Expr) closure {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return c.compileExpression(expr.X)
+	case *ast.BinaryExpr:
+		return c.compileBinaryOperation(expr)
+	case *ast.UnaryExpr:
+		return c.compileUnaryOperation(expr)
+	case *ast.SelectorExpr:
+		operand := c.compileExpression(expr.X)
+		return func(frame *closureFrame) object.Object {
+			return selectMember(operand(frame), expr)
+		}
+	case *ast.CallExpr:
+		return c.compileCall(expr)
+	case *ast.FuncLit:
+		return c.compileFunctionLiteral(expr)
+	case *ast.Ident:
+		return c.compileIdentifier(expr)
+	case *ast.BasicLit:
+		obj := evaluateBasicLiteral(expr)
+		return func(*closureFrame) object.Object {
+			return obj
+		}
+	default:
+		// It bails out when it is run as the tree-walk backend does,
+		// which never runs the right operands short-circuited.
+		return func(*closureFrame) object.Object {
+			bailUnsupportedExpression(expr)
+			return nil
+		}
+	}
+}
+
+func (c *closureCompiler) compileBinaryOperation(expr *ast.BinaryExpr) closure {
+	left, right := c.compileExpression(expr.X), c.compileExpression(expr.Y)
+	return func(frame *closureFrame) object.Object {
+		leftObj := left(frame)
+		if obj, ok := shortCircuit(expr, leftObj); ok {
+			return obj
+		}
+		obj := operateBinary(expr, leftObj, right(frame))
+		frame.limiter.allocate(obj)
+
+		return obj
+	}
+}
+
+func (c *closureCompiler) compileUnaryOperation(expr *ast.UnaryExpr) closure {
+	operand := c.compileExpression(expr.X)
+	return func(frame *closureFrame) object.Object {
+		return operateUnary(expr, operand(frame))
+	}
+}
+
+func (c *closureCompiler) compileCall(expr *ast.CallExpr) closure {
+	fn := c.compileExpression(expr.Fun)
+	args := make([]closure, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = c.compileExpression(arg)
+	}
+
+	return func(frame *closureFrame) object.Object {
+		fnObj := fn(frame)
+		argObjs := make([]object.Object, len(args))
+		for i, arg := range args {
+			argObjs[i] = arg(frame)
+		}
+
+		return callObject(frame, frame.limiter, expr, fnObj, argObjs)
+	}
+}
+
+// compileFunctionLiteral captures the slots in scope by value, which is
+// safe as long as they can not be assigned after their declarations.
+func (c *closureCompiler) compileFunctionLiteral(expr *ast.FuncLit) closure {
+	var scope map[string]int
+	if c.local {
+		scope = copyIndexes(c.slotIndexes)
+	}
+
+	return func(frame *closureFrame) object.Object {
+		env := frame.env
+		if scope != nil {
+			env = object.NewEnclosedEnvironment(frame.env)
+			for name, slot := range scope {
+				env.Set(name, frame.slots[slot])
+			}
+		}
+
+		return newFunctionLiteral(expr.Type, expr.Body, env)
+	}
+}
+
+func (c *closureCompiler) compileIdentifier(expr *ast.Ident) closure {
+	if slot, ok := c.slotIndexes[expr.Name]; ok {
+		return func(frame *closureFrame) object.Object {
+			return frame.slots[slot]
+		}
+	}
+
+	return func(frame *closureFrame) object.Object {
+		return lookUp(frame.env, expr)
+	}
+}
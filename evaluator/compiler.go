@@ -0,0 +1,375 @@
+package evaluator
+
+import (
+	"encoding/binary"
+	"go/ast"
+	"go/token"
+
+	"github.com/tomocy/warabi/object"
+)
+
+type opcode byte
+
+const (
+	opConstant opcode = iota
+	opGetGlobal
+	opSetGlobal
+	opGetLocal
+	opSetLocal
+	opSelect
+	opCall
+	opFunction
+	opBinary
+	opShortCircuit
+	opUnary
+	opValue
+	opJump
+	opJumpIfFalse
+	opDuplicate
+	opPop
+	opYield
+	opUnsupported
+)
+
+// operandWidths are the widths of the operands of each opcode, which are
+// wide enough for the indexes and the offsets of any program in memory.
+var operandWidths = map[opcode][]int{
+	opConstant:     {4},
+	opGetGlobal:    {4},
+	opSetGlobal:    {4},
+	opGetLocal:     {4},
+	opSetLocal:     {4},
+	opSelect:       {4},
+	opCall:         {4, 4},
+	opFunction:     {4, 4},
+	opBinary:       {4},
+	opShortCircuit: {4, 4},
+	opUnary:        {4},
+	opValue:        {4},
+	opJump:         {4},
+	opJumpIfFalse:  {4, 4},
+	opDuplicate:    {},
+	opPop:          {},
+	opYield:        {},
+	opUnsupported:  {4},
+}
+
+func makeInstruction(op opcode, operands ...int) []byte {
+	widths := operandWidths[op]
+	size := 1
+	for _, width := range widths {
+		size += width
+	}
+
+	instruction := make([]byte, size)
+	instruction[0] = byte(op)
+	offset := 1
+	for i, operand := range operands {
+		binary.BigEndian.PutUint32(instruction[offset:], uint32(operand))
+		offset += widths[i]
+	}
+
+	return instruction
+}
+
+type bytecode struct {
+	instructions []byte
+	constants    []object.Object
+	names        []string
+	identifiers  []*ast.Ident
+	selectors    []*ast.SelectorExpr
+	calls        []*ast.CallExpr
+	binaries     []*ast.BinaryExpr
+	unaries      []*ast.UnaryExpr
+	values       []ast.Expr
+	conditions   []ast.Expr
+	unsupported  []ast.Node
+	scopes       []map[string]int
+	locals       int
+}
+
+type compiler struct {
+	bytecode
+	nameIndexes  map[string]int
+	localIndexes map[string]int
+}
+
+func compile(decls []ast.Decl) bytecode {
+	c := newCompiler()
+	for _, decl := range decls {
+		c.compileDeclaration(decl)
+	}
+
+	return c.bytecode
+}
+
+func compileExpression(expr ast.Expr) bytecode {
+	c := newCompiler()
+	c.compileExpression(expr)
+	c.emit(opYield)
+
+	return c.bytecode
+}
+
+// compileFunction compiles the body of fn. The parameters are
+// the first locals.
+func compileFunction(fn *object.FunctionLiteral) bytecode {
+	c := newCompiler()
+	c.localIndexes = make(map[string]int)
+	for _, name := range parameterNames(fn) {
+		c.declareLocal(name)
+	}
+	c.compileStatements(fn.Body)
+
+	return c.bytecode
+}
+
+func newCompiler() *compiler {
+	return &compiler{
+		nameIndexes: make(map[string]int),
+	}
+}
+
+func (c *compiler) compileDeclaration(decl ast.Decl) {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		c.compileFunctionDeclaration(decl)
+	case *ast.GenDecl:
+		c.compileGenericsDeclaration(decl)
+	}
+}
+
+func (c *compiler) compileFunctionDeclaration(decl *ast.FuncDecl) {
+	for _, obj := range evaluateFunctionDeclaration(decl) {
+		c.emit(opFunction, c.addConstant(obj), c.addScope(nil))
+		if isReferable(decl) {
+			c.emit(opDuplicate)
+			c.emit(opSetGlobal, c.addName(decl.Name.Name))
+		}
+		c.emit(opYield)
+	}
+}
+
+func (c *compiler) compileStatements(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		c.compileStatement(stmt)
+	}
+}
+
+func (c *compiler) compileStatement(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.DeclStmt:
+		c.compileDeclaration(stmt.Decl)
+	case *ast.AssignStmt:
+		c.compileAssignment(stmt)
+	case *ast.ExprStmt:
+		c.compileExpression(stmt.X)
+		c.emit(opPop)
+	case *ast.BlockStmt:
+		defer c.enterScope()()
+		c.compileStatements(stmt.List)
+	case *ast.IfStmt:
+		defer c.enterScope()()
+		c.compileIf(stmt)
+	case *ast.EmptyStmt:
+	default:
+		c.emitUnsupported(stmt)
+	}
+}
+
+func (c *compiler) compileAssignment(stmt *ast.AssignStmt) {
+	names, ok := definedNames(stmt)
+	if !ok {
+		c.emitUnsupported(stmt)
+		return
+	}
+	for _, value := range stmt.Rhs {
+		c.compileValue(value)
+	}
+	for i := len(names) - 1; 0 <= i; i-- {
+		c.emit(opSetLocal, c.declareLocal(names[i]))
+	}
+}
+
+func (c *compiler) compileIf(stmt *ast.IfStmt) {
+	if stmt.Init != nil {
+		c.compileStatement(stmt.Init)
+	}
+	c.compileExpression(stmt.Cond)
+	c.conditions = append(c.conditions, stmt.Cond)
+	jumpIfFalse := c.emitJump(opJumpIfFalse, len(c.conditions)-1)
+	c.compileStatement(stmt.Body)
+	if stmt.Else == nil {
+		c.patchJump(jumpIfFalse)
+		return
+	}
+
+	jump := c.emitJump(opJump)
+	c.patchJump(jumpIfFalse)
+	c.compileStatement(stmt.Else)
+	c.patchJump(jump)
+}
+
+// enterScope starts a block scope of locals and returns the function
+// to end it.
+func (c *compiler) enterScope() func() {
+	outer := c.localIndexes
+	c.localIndexes = copyIndexes(outer)
+	return func() {
+		c.localIndexes = outer
+	}
+}
+
+func copyIndexes(indexes map[string]int) map[string]int {
+	copied := make(map[string]int, len(indexes))
+	for name, index := range indexes {
+		copied[name] = index
+	}
+
+	return copied
+}
+
+func (c *compiler) compileGenericsDeclaration(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		spec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		c.compileValueSpecification(spec)
+	}
+}
+
+func (c *compiler) compileValueSpecification(spec *ast.ValueSpec) {
+	spec = normalizeValueSpecification(spec)
+	for i := 0; i < len(spec.Names); i++ {
+		c.compileValue(spec.Values[i])
+		if c.localIndexes != nil {
+			c.emit(opSetLocal, c.declareLocal(spec.Names[i].Name))
+			continue
+		}
+		c.emit(opDuplicate)
+		c.emit(opSetGlobal, c.addName(spec.Names[i].Name))
+		c.emit(opYield)
+	}
+}
+
+// compileValue compiles expr whose value is used, which is checked to
+// exist as a call of a function without results has none.
+func (c *compiler) compileValue(expr ast.Expr) {
+	c.compileExpression(expr)
+	c.values = append(c.values, expr)
+	c.emit(opValue, len(c.values)-1)
+}
+
+func (c *compiler) compileExpression(expr ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		c.compileExpression(expr.X)
+	case *ast.BinaryExpr:
+		c.compileBinaryOperation(expr)
+	case *ast.UnaryExpr:
+		c.compileExpression(expr.X)
+		c.unaries = append(c.unaries, expr)
+		c.emit(opUnary, len(c.unaries)-1)
+	case *ast.SelectorExpr:
+		c.compileExpression(expr.X)
+		c.selectors = append(c.selectors, expr)
+		c.emit(opSelect, len(c.selectors)-1)
+	case *ast.CallExpr:
+		c.compileExpression(expr.Fun)
+		for _, arg := range expr.Args {
+			c.compileExpression(arg)
+		}
+		c.calls = append(c.calls, expr)
+		c.emit(opCall, len(expr.Args), len(c.calls)-1)
+	case *ast.FuncLit:
+		var scope map[string]int
+		if c.localIndexes != nil {
+			scope = copyIndexes(c.localIndexes)
+		}
+		fn := newFunctionLiteral(expr.Type, expr.Body, nil)
+		c.emit(opFunction, c.addConstant(fn), c.addScope(scope))
+	case *ast.Ident:
+		if index, ok := c.localIndexes[expr.Name]; ok {
+			c.emit(opGetLocal, index)
+			return
+		}
+		c.identifiers = append(c.identifiers, expr)
+		c.emit(opGetGlobal, len(c.identifiers)-1)
+	case *ast.BasicLit:
+		c.emit(opConstant, c.addConstant(evaluateBasicLiteral(expr)))
+	default:
+		c.emitUnsupported(expr)
+	}
+}
+
+// compileBinaryOperation compiles expr so that the right operand of
+// a logical operation is skipped if the left one determines the result.
+func (c *compiler) compileBinaryOperation(expr *ast.BinaryExpr) {
+	c.binaries = append(c.binaries, expr)
+	index := len(c.binaries) - 1
+	c.compileExpression(expr.X)
+	if expr.Op != token.LAND && expr.Op != token.LOR {
+		c.compileExpression(expr.Y)
+		c.emit(opBinary, index)
+		return
+	}
+
+	shortCircuit := c.emitJump(opShortCircuit, index)
+	c.compileExpression(expr.Y)
+	c.emit(opBinary, index)
+	c.patchJump(shortCircuit)
+}
+
+// emitUnsupported emits the instruction to bail out of node when it is
+// run rather than compiled, as the tree-walk backend does, so that the
+// ones which are never run such as the right operands short-circuited
+// are evaluated as well.
+func (c *compiler) emitUnsupported(node ast.Node) {
+	c.unsupported = append(c.unsupported, node)
+	c.emit(opUnsupported, len(c.unsupported)-1)
+}
+
+func (c *compiler) emit(op opcode, operands ...int) {
+	c.instructions = append(c.instructions, makeInstruction(op, operands...)...)
+}
+
+// emitJump emits a jump whose destination is patched later, and returns
+// the offset of its first operand.
+func (c *compiler) emitJump(op opcode, operands ...int) int {
+	offset := len(c.instructions) + 1
+	c.emit(op, append([]int{0}, operands...)...)
+	return offset
+}
+
+func (c *compiler) patchJump(offset int) {
+	binary.BigEndian.PutUint32(c.instructions[offset:], uint32(len(c.instructions)))
+}
+
+func (c *compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *compiler) addName(name string) int {
+	if index, ok := c.nameIndexes[name]; ok {
+		return index
+	}
+
+	c.names = append(c.names, name)
+	c.nameIndexes[name] = len(c.names) - 1
+	return c.nameIndexes[name]
+}
+
+func (c *compiler) addScope(scope map[string]int) int {
+	c.scopes = append(c.scopes, scope)
+	return len(c.scopes) - 1
+}
+
+// declareLocal allocates a new local even if the name is declared
+// in an outer scope, which the new one shadows.
+func (c *compiler) declareLocal(name string) int {
+	c.localIndexes[name] = c.locals
+	c.locals++
+	return c.localIndexes[name]
+}
@@ -0,0 +1,430 @@
+package evaluator
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tomocy/warabi/object"
+)
+
+type CandidateKind int
+
+const (
+	CandidateVariable CandidateKind = iota
+	CandidateFunction
+	CandidatePackage
+	CandidateConstant
+	CandidateKeyword
+)
+
+func (k CandidateKind) String() string {
+	switch k {
+	case CandidateVariable:
+		return "variable"
+	case CandidateFunction:
+		return "function"
+	case CandidatePackage:
+		return "package"
+	case CandidateConstant:
+		return "constant"
+	case CandidateKeyword:
+		return "keyword"
+	default:
+		return "unknown"
+	}
+}
+
+// Candidate is a name which completes the identifier before the cursor.
+// Detail is the kind of the object it names, if known.
+type Candidate struct {
+	Name   string
+	Kind   CandidateKind
+	Detail string
+}
+
+var keywords = []string{
+	"break", "case", "chan", "const", "continue", "default", "defer", "else",
+	"fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+	"map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+}
+
+// Complete returns the candidates, sorted by name, which complete
+// the identifier before the cursor, the offset in bytes in src.
+// After a selector, they are the exported members of the object it
+// selects from. Otherwise, they are the names declared in src where
+// the cursor is, the names in the environment and its outer ones,
+// the predeclared names and the keywords. src is a file or a snippet.
+func (i Interpreter) Complete(src string, cursor int) []Candidate {
+	if cursor < 0 || len(src) < cursor {
+		cursor = len(src)
+	}
+	start := IdentifierStart(src, cursor)
+	prefix := src[start:cursor]
+	scope := newCompletionScope(i.env, src, cursor)
+
+	var candidates []Candidate
+	if strings.HasSuffix(src[:start], ".") {
+		candidates = scope.completeMember(src[:start-1], prefix)
+	} else {
+		candidates = scope.complete(prefix)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	return candidates
+}
+
+// IdentifierStart returns the offset where the identifier ending at
+// the cursor starts, which is the cursor if there is no identifier.
+func IdentifierStart(src string, cursor int) int {
+	start := cursor
+	for 0 < start {
+		r, size := utf8.DecodeLastRuneInString(src[:start])
+		if !isIdentifierRune(r) {
+			break
+		}
+		start -= size
+	}
+
+	return start
+}
+
+// IdentifierAt returns the range of the identifier around the offset.
+func IdentifierAt(src string, offset int) (int, int) {
+	end := offset
+	for end < len(src) {
+		r, size := utf8.DecodeRuneInString(src[end:])
+		if !isIdentifierRune(r) {
+			break
+		}
+		end += size
+	}
+
+	return IdentifierStart(src, offset), end
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// completionScope is the names visible at the cursor. types are the
+// types of the names declared in src, which are not evaluated yet.
+type completionScope struct {
+	env     *object.Environment
+	names   map[string]CandidateKind
+	types   map[string]ast.Expr
+	imports map[string]string
+}
+
+func newCompletionScope(env *object.Environment, src string, cursor int) *completionScope {
+	scope := &completionScope{
+		env:     env,
+		names:   make(map[string]CandidateKind),
+		types:   make(map[string]ast.Expr),
+		imports: make(map[string]string),
+	}
+
+	offset := 0
+	if !strings.HasPrefix(strings.TrimSpace(src), "package") {
+		src, offset = packageStatement+src, len(packageStatement)
+	}
+	fileSet := token.NewFileSet()
+	file, _ := parser.ParseFile(fileSet, "", src, parser.Mode(0))
+	if file == nil {
+		return scope
+	}
+	pos := fileSet.File(file.Pos()).Pos(cursor + offset)
+	scope.declareFile(file, pos)
+
+	return scope
+}
+
+func (s *completionScope) declareFile(file *ast.File, pos token.Pos) {
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		s.imports[name] = path
+		s.names[name] = CandidatePackage
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				s.names[decl.Name.Name] = CandidateFunction
+			}
+		case *ast.GenDecl:
+			s.declareGenDecl(decl)
+		}
+	}
+
+	// The names declared in the scopes enclosing the cursor.
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.GenDecl:
+			return node.Tok != token.IMPORT
+		case *ast.FuncDecl:
+			if !contains(node.Body, pos) {
+				return false
+			}
+			s.declareFields(node.Type.Params)
+			s.declareFields(node.Type.Results)
+		case *ast.FuncLit:
+			if !contains(node.Body, pos) {
+				return false
+			}
+			s.declareFields(node.Type.Params)
+			s.declareFields(node.Type.Results)
+		case *ast.BlockStmt:
+			return contains(node, pos)
+		case *ast.RangeStmt:
+			if !contains(node.Body, pos) {
+				return false
+			}
+			if node.Tok == token.DEFINE {
+				for _, expr := range []ast.Expr{node.Key, node.Value} {
+					if ident, ok := expr.(*ast.Ident); ok {
+						s.names[ident.Name] = CandidateVariable
+					}
+				}
+			}
+		case *ast.IfStmt, *ast.ForStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.CaseClause:
+			return node.Pos() <= pos && pos <= node.End()
+		case *ast.DeclStmt:
+			if node.Pos() < pos {
+				s.declareGenDecl(node.Decl.(*ast.GenDecl))
+			}
+		case *ast.AssignStmt:
+			if node.Tok != token.DEFINE || pos <= node.End() {
+				return true
+			}
+			for _, lhs := range node.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok {
+					s.names[ident.Name] = CandidateVariable
+				}
+			}
+		}
+		return true
+	})
+}
+
+// contains reports whether the position is in the block, which may not
+// be closed yet.
+func contains(block *ast.BlockStmt, pos token.Pos) bool {
+	if block == nil || pos <= block.Lbrace {
+		return false
+	}
+
+	return !block.Rbrace.IsValid() || pos <= block.Rbrace
+}
+
+func (s *completionScope) declareGenDecl(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		spec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		kind := CandidateVariable
+		if decl.Tok == token.CONST {
+			kind = CandidateConstant
+		}
+		for _, name := range spec.Names {
+			s.names[name.Name] = kind
+			if spec.Type != nil {
+				s.types[name.Name] = spec.Type
+			}
+		}
+	}
+}
+
+func (s *completionScope) declareFields(fields *ast.FieldList) {
+	if fields == nil {
+		return
+	}
+	for _, field := range fields.List {
+		kind := CandidateVariable
+		if _, ok := field.Type.(*ast.FuncType); ok {
+			kind = CandidateFunction
+		}
+		for _, name := range field.Names {
+			s.names[name.Name] = kind
+			s.types[name.Name] = field.Type
+		}
+	}
+}
+
+func (s *completionScope) complete(prefix string) []Candidate {
+	var candidates []Candidate
+	seen := make(map[string]bool)
+	add := func(candidate Candidate) {
+		if seen[candidate.Name] || !strings.HasPrefix(candidate.Name, prefix) {
+			return
+		}
+		seen[candidate.Name] = true
+		candidates = append(candidates, candidate)
+	}
+
+	for name, kind := range s.names {
+		candidate := Candidate{
+			Name: name,
+			Kind: kind,
+		}
+		if obj, ok := s.env.Get(name); ok {
+			candidate = candidateOf(name, obj)
+		}
+		add(candidate)
+	}
+	for env := s.env; env != nil; env = env.Outer() {
+		for _, name := range env.Names() {
+			obj, _ := env.Get(name)
+			add(candidateOf(name, obj))
+		}
+	}
+	for _, name := range []string{"true", "false"} {
+		add(Candidate{
+			Name:   name,
+			Kind:   CandidateConstant,
+			Detail: object.Boolean.String(),
+		})
+	}
+	for _, name := range keywords {
+		add(Candidate{
+			Name: name,
+			Kind: CandidateKeyword,
+		})
+	}
+
+	return candidates
+}
+
+// completeMember completes the member of the object which the operand,
+// the source before the selector, evaluates to. The operand must be
+// a chain of selectors, which are selected without being evaluated.
+func (s *completionScope) completeMember(operand, prefix string) []Candidate {
+	var names []string
+	for {
+		start := IdentifierStart(operand, len(operand))
+		if start == len(operand) {
+			return nil
+		}
+		names = append([]string{operand[start:]}, names...)
+		if !strings.HasSuffix(operand[:start], ".") {
+			break
+		}
+		operand = operand[:start-1]
+	}
+
+	obj, ok := s.lookUp(names[0])
+	if !ok {
+		return nil
+	}
+	for _, name := range names[1:] {
+		selector, ok := obj.(object.Selector)
+		if !ok {
+			return nil
+		}
+		if obj, ok = selector.Select(name); !ok {
+			return nil
+		}
+	}
+	enumerator, ok := obj.(object.Enumerator)
+	if !ok {
+		return nil
+	}
+
+	var candidates []Candidate
+	for _, name := range enumerator.Members() {
+		if !ast.IsExported(name) || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		member, _ := enumerator.Select(name)
+		candidates = append(candidates, candidateOf(name, member))
+	}
+
+	return candidates
+}
+
+// lookUp returns the object of the name, which is the imported package,
+// the parameter of *testing.T, *testing.B or *testing.F, or the object
+// in the environment.
+func (s *completionScope) lookUp(name string) (object.Object, bool) {
+	if path, ok := s.imports[name]; ok {
+		if obj, ok := s.env.Get(name); ok && obj != nil && obj.Kind() == object.Package {
+			return obj, true
+		}
+		newPackage, ok := standardPackages[path]
+		if !ok {
+			return nil, false
+		}
+		return newPackage(Interpreter{
+			output: io.Discard,
+		}), true
+	}
+	if typ, ok := s.types[name]; ok {
+		return s.testingObjectOf(typ)
+	}
+
+	return s.env.Get(name)
+}
+
+func (s *completionScope) testingObjectOf(typ ast.Expr) (object.Object, bool) {
+	star, ok := typ.(*ast.StarExpr)
+	if !ok {
+		return nil, false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return nil, false
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || s.imports[pkg.Name] != "testing" {
+		return nil, false
+	}
+	kinds := map[string]testKind{
+		"T": kindTest,
+		"B": kindBenchmark,
+		"F": kindFuzz,
+	}
+	kind, ok := kinds[sel.Sel.Name]
+	if !ok {
+		return nil, false
+	}
+
+	return testingObject{
+		state: &testState{
+			kind: kind,
+		},
+	}, true
+}
+
+func candidateOf(name string, obj object.Object) Candidate {
+	candidate := Candidate{
+		Name: name,
+		Kind: CandidateVariable,
+	}
+	if obj == nil {
+		return candidate
+	}
+
+	candidate.Detail = obj.Kind().String()
+	switch obj.Kind() {
+	case object.Function:
+		candidate.Kind = CandidateFunction
+	case object.Package:
+		candidate.Kind = CandidatePackage
+	}
+
+	return candidate
+}
@@ -0,0 +1,69 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	interpreter := NewInterpreter(TreeWalk)
+	if _, err := interpreter.Evaluate("import \"fmt\"\n\nvar apple = 1\n\nfunc apply() {}\n"); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	// The cursor is at |.
+	tests := map[string]string{
+		"ap|":       "apple(variable int) apply(function func)",
+		"1 + ap|le": "apple(variable int) apply(function func)",
+		"fa|":       "fallthrough(keyword) false(constant bool)",
+		"fmt.Spr|":  "Sprint(function func) Sprintf(function func) Sprintln(function func)",
+		"fmt.x|":    "",
+		"apple.|":   "",
+		"banana.|":  "",
+		"func f(cherry int) {\n\tcoconut := 1\n\tvar cashew = c|\n\tcranberry := 2\n}\n\nfunc g(citron int) {}": "" +
+			"case(keyword) cashew(variable) chan(keyword) cherry(variable) coconut(variable) const(keyword) continue(keyword)",
+		"import \"testing\"\n\nfunc BenchmarkF(b *testing.B) {\n\tb.|": "" +
+			"Cleanup(function func) Error(function func) Errorf(function func) Fail(function func) FailNow(function func) " +
+			"Failed(function func) Fatal(function func) Fatalf(function func) Helper(function func) Log(function func) " +
+			"Logf(function func) N(variable int) Name(function func) ReportAllocs(function func) ResetTimer(function func) " +
+			"Skip(function func) SkipNow(function func) Skipf(function func) Skipped(function func) " +
+			"StartTimer(function func) StopTimer(function func)",
+		"package main\n\nimport (\n\tt \"testing\"\n\t\"fmt\"\n)\n\nfunc TestF(x *t.T) {\n\tfunc() {\n\t\tx.F|\n\t}()\n}\n": "" +
+			"Fail(function func) FailNow(function func) Failed(function func) Fatal(function func) Fatalf(function func)",
+	}
+	for src, want := range tests {
+		cursor := strings.Index(src, "|")
+		src = strings.Replace(src, "|", "", 1)
+		var descs []string
+		for _, candidate := range interpreter.Complete(src, cursor) {
+			desc := fmt.Sprintf("%s(%s", candidate.Name, candidate.Kind)
+			if candidate.Detail != "" {
+				desc += " " + candidate.Detail
+			}
+			descs = append(descs, desc+")")
+		}
+		if got := strings.Join(descs, " "); got != want {
+			t.Errorf("unexpected candidates for %q: got %s, expected %s\n", src, got, want)
+		}
+	}
+}
+
+func TestIdentifierAt(t *testing.T) {
+	tests := []struct {
+		src                string
+		offset             int
+		wantStart, wantEnd int
+	}{
+		{"fmt.Println(a)", 6, 4, 11},
+		{"fmt.Println(a)", 3, 0, 3},
+		{"a + bc", 2, 2, 2},
+		{"var 名前 = 1", 4, 4, 10},
+	}
+	for _, test := range tests {
+		start, end := IdentifierAt(test.src, test.offset)
+		if start != test.wantStart || end != test.wantEnd {
+			t.Errorf("unexpected range of %q at %d: got [%d, %d), expected [%d, %d)\n", test.src, test.offset, start, end, test.wantStart, test.wantEnd)
+		}
+	}
+}
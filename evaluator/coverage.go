@@ -0,0 +1,399 @@
+package evaluator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Coverage counts how many times the blocks of statements in the files
+// added to it are executed. The blocks are the ones go test -cover
+// counts, so that the profiles it writes can be read by go tool cover.
+type Coverage struct {
+	mode  string
+	files []*coveredFile
+	// blocks are the blocks keyed by the absolute filenames and the offsets
+	// of their first statements.
+	blocks    map[string]map[int]*coverBlock
+	absolutes map[string]string
+	// fileSet has the files added, which are parsed apart from the ones
+	// run and matched with them by the filenames and the offsets.
+	fileSet *token.FileSet
+}
+
+type coveredFile struct {
+	name   string
+	dir    string
+	blocks []*coverBlock
+}
+
+type coverBlock struct {
+	start, end token.Position
+	statements int
+	count      int
+}
+
+// NewCoverage returns a coverage in mode, which is set, count or atomic as
+// go test -covermode. atomic is the same as count since programs run
+// in a single goroutine.
+func NewCoverage(mode string) (*Coverage, error) {
+	switch mode {
+	case "set", "count", "atomic":
+	default:
+		return nil, fmt.Errorf("unknown cover mode: %s", mode)
+	}
+
+	return &Coverage{
+		mode:      mode,
+		blocks:    make(map[string]map[int]*coverBlock),
+		absolutes: make(map[string]string),
+		fileSet:   token.NewFileSet(),
+	}, nil
+}
+
+// AddPackage adds the files of the package in dir other than the test files.
+func (c *Coverage) AddPackage(dir string) error {
+	// The test files are parsed too so that packages only of tests
+	// can be added with nothing to cover.
+	files, _, err := parseTestPackage(c.fileSet, dir)
+	if err != nil {
+		return err
+	}
+
+	return c.addFiles(dir, files)
+}
+
+// AddFile adds the file of a program run alone.
+
+func (c *Coverage) AddFile(filename string) error {
+	file, err := parser.ParseFile(c.fileSet, filename, nil, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	return c.addFiles(filepath.Dir(filename), []*ast.File{file})
+}
+
+func (c *Coverage) addFiles(dir string, files []*ast.File) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	module, err := findModule(dir)
+	if err != nil {
+		return err
+	}
+	path := module.importPath(dir)
+
+	for _, file := range files {
+		filename, err := filepath.Abs(c.fileSet.Position(file.Pos()).Filename)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.blocks[filename]; ok || strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		finder := &blockFinder{
+			fileSet: c.fileSet,
+			src:     src,
+			blocks:  make(map[int]*coverBlock),
+		}
+		ast.Walk(finder, file)
+		c.blocks[filename] = finder.blocks
+		c.files = append(c.files, &coveredFile{
+			name:   path + "/" + filepath.Base(filename),
+			dir:    dir,
+			blocks: finder.sortedBlocks(),
+		})
+	}
+
+	return nil
+}
+
+func (c *Coverage) Observe(event Event) {
+	if event.Kind != EnterNode {
+		return
+	}
+	if _, ok := event.Node.(ast.Stmt); !ok {
+		return
+	}
+
+	filename, ok := c.absolutes[event.Position.Filename]
+	if !ok {
+		filename, _ = filepath.Abs(event.Position.Filename)
+		c.absolutes[event.Position.Filename] = filename
+	}
+	if block, ok := c.blocks[filename][event.Position.Offset]; ok {
+		block.count++
+	}
+}
+
+// WriteProfile writes the counts in the format of go test -coverprofile.
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "mode: %s\n", c.mode)
+	for _, file := range c.files {
+		for _, block := range file.blocks {
+			count := block.count
+			if c.mode == "set" && 1 < count {
+				count = 1
+			}
+			fmt.Fprintf(
+				&b, "%s:%d.%d,%d.%d %d %d\n",
+				file.name, block.start.Line, block.start.Column, block.end.Line, block.end.Column,
+				block.statements, count,
+			)
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Percent returns the percentage of the statements executed in the
+// packages in dirs, or in all the files if no dirs are given.
+func (c *Coverage) Percent(dirs ...string) float64 {
+	included := make(map[string]bool)
+	for _, dir := range dirs {
+		dir, _ = filepath.Abs(dir)
+		included[dir] = true
+	}
+
+	var total, covered int
+	for _, file := range c.files {
+		if len(dirs) != 0 && !included[file.dir] {
+			continue
+		}
+		for _, block := range file.blocks {
+			total += block.statements
+			if block.count != 0 {
+				covered += block.statements
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * float64(covered) / float64(total)
+}
+
+// blockFinder finds the blocks in a file as cmd/cover does. A block
+// starts at the brace of a block or at a statement and ends before
+// the next statement which ends basic blocks, such as if statements, or
+// at the closing brace.
+type blockFinder struct {
+	fileSet *token.FileSet
+	src     []byte
+	blocks  map[int]*coverBlock
+	empty   []*coverBlock
+}
+
+func (f *blockFinder) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.BlockStmt:
+		if 0 < len(node.List) {
+			switch node.List[0].(type) {
+			case *ast.CaseClause, *ast.CommClause:
+				return f
+			}
+		}
+		f.addBlocks(node.Lbrace, node.Lbrace+1, node.Rbrace+1, node.List, true)
+	case *ast.CaseClause:
+		f.addBlocks(node.Colon+1, node.Colon+1, node.End(), node.Body, false)
+	case *ast.CommClause:
+		f.addBlocks(node.Colon+1, node.Colon+1, node.End(), node.Body, false)
+	case *ast.IfStmt:
+		if node.Init != nil {
+			ast.Walk(f, node.Init)
+		}
+		ast.Walk(f, node.Cond)
+		ast.Walk(f, node.Body)
+		if node.Else == nil {
+			return nil
+		}
+
+		// The else clause starts a block after the else keyword, which
+		// wraps the if statement of else if.
+		start := node.Body.End() + token.Pos(f.findElse(node.Body.End())) + token.Pos(len("else"))
+		switch stmt := node.Else.(type) {
+		case *ast.IfStmt:
+			f.addBlocks(start, start+1, stmt.End(), []ast.Stmt{stmt}, true)
+			ast.Walk(f, stmt)
+		case *ast.BlockStmt:
+			f.addBlocks(start, start+1, stmt.Rbrace+1, stmt.List, true)
+			for _, stmt := range stmt.List {
+				ast.Walk(f, stmt)
+			}
+		}
+		return nil
+	}
+
+	return f
+}
+
+func (f *blockFinder) findElse(pos token.Pos) int {
+	offset := f.fileSet.Position(pos).Offset
+	return bytes.Index(f.src[offset:], []byte("else"))
+}
+
+// addBlocks adds the blocks of stmts from start to end. Empty blocks
+// start at insert, after the brace.
+func (f *blockFinder) addBlocks(start, insert, end token.Pos, stmts []ast.Stmt, toClosingBrace bool) {
+	if len(stmts) == 0 {
+		f.empty = append(f.empty, f.newBlock(insert, end, 0))
+		return
+	}
+
+	for len(stmts) != 0 {
+		last, blockEnd := 0, end
+		for last < len(stmts) {
+			stmt := stmts[last]
+			blockEnd = statementBoundary(stmt)
+			last++
+			if endsBasicBlock(stmt) {
+				toClosingBrace = false
+				break
+			}
+		}
+		if toClosingBrace {
+			blockEnd = end
+		}
+		if start != blockEnd {
+			f.blocks[f.fileSet.Position(stmts[0].Pos()).Offset] = f.newBlock(start, blockEnd, last)
+		}
+
+		stmts = stmts[last:]
+		if len(stmts) != 0 {
+			start = stmts[0].Pos()
+		}
+	}
+}
+
+func (f *blockFinder) newBlock(start, end token.Pos, statements int) *coverBlock {
+	return &coverBlock{
+		start:      f.fileSet.Position(start),
+		end:        f.fileSet.Position(end),
+		statements: statements,
+	}
+}
+
+func (f *blockFinder) sortedBlocks() []*coverBlock {
+	blocks := append([]*coverBlock(nil), f.empty...)
+	for _, block := range f.blocks {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].start.Offset < blocks[j].start.Offset
+	})
+
+	return blocks
+}
+
+// statementBoundary returns where the block of stmt ends, which is
+// before the body of stmt or the function literal in it, if any.
+func statementBoundary(stmt ast.Stmt) token.Pos {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		return stmt.Lbrace
+	case *ast.IfStmt:
+		if pos, ok := findFunctionLiteral(stmt.Init); ok {
+			return pos
+		}
+		if pos, ok := findFunctionLiteral(stmt.Cond); ok {
+			return pos
+		}
+		return stmt.Body.Lbrace
+	case *ast.ForStmt:
+		if pos, ok := findFunctionLiteral(stmt.Init); ok {
+			return pos
+		}
+		if pos, ok := findFunctionLiteral(stmt.Cond); ok {
+			return pos
+		}
+		if pos, ok := findFunctionLiteral(stmt.Post); ok {
+			return pos
+		}
+		return stmt.Body.Lbrace
+	case *ast.LabeledStmt:
+		return statementBoundary(stmt.Stmt)
+	case *ast.RangeStmt:
+		if pos, ok := findFunctionLiteral(stmt.X); ok {
+			return pos
+		}
+		return stmt.Body.Lbrace
+	case *ast.SwitchStmt:
+		if pos, ok := findFunctionLiteral(stmt.Init); ok {
+			return pos
+		}
+		if pos, ok := findFunctionLiteral(stmt.Tag); ok {
+			return pos
+		}
+		return stmt.Body.Lbrace
+	case *ast.SelectStmt:
+		return stmt.Body.Lbrace
+	case *ast.TypeSwitchStmt:
+		if pos, ok := findFunctionLiteral(stmt.Init); ok {
+			return pos
+		}
+		return stmt.Body.Lbrace
+	}
+
+	if pos, ok := findFunctionLiteral(stmt); ok {
+		return pos
+	}
+	return stmt.End()
+}
+
+// endsBasicBlock reports whether stmt ends the block it is in, as
+// statements with bodies, branches and panics do.
+func endsBasicBlock(stmt ast.Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt, *ast.BranchStmt, *ast.ForStmt, *ast.IfStmt, *ast.RangeStmt,
+		*ast.SwitchStmt, *ast.SelectStmt, *ast.TypeSwitchStmt:
+		return true
+	case *ast.LabeledStmt:
+		return true
+	case *ast.ExprStmt:
+		if call, ok := stmt.X.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "panic" && len(call.Args) == 1 {
+				return true
+			}
+		}
+	}
+
+	_, ok := findFunctionLiteral(stmt)
+	return ok
+}
+
+func findFunctionLiteral(node ast.Node) (token.Pos, bool) {
+	if node == nil {
+		return token.NoPos, false
+	}
+
+	var pos token.Pos
+	ast.Inspect(node, func(node ast.Node) bool {
+		if pos != token.NoPos {
+			return false
+		}
+		if lit, ok := node.(*ast.FuncLit); ok {
+			pos = lit.Body.Lbrace
+			return false
+		}
+		return true
+	})
+
+	return pos, pos != token.NoPos
+}
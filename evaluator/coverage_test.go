@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const coveredSource = `package classify
+
+import "fmt"
+
+func Classify(n int) {
+	if n < 0 {
+		fmt.Println("negative")
+	} else if n == 0 {
+		fmt.Println("zero")
+	} else {
+		s := "positive"
+		fmt.Println(s)
+	}
+}
+
+func Empty() {}
+`
+
+func TestCoverage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"classify.go":      coveredSource,
+		"classify_test.go": "package classify\n\nimport \"testing\"\n\nfunc TestClassify(t *testing.T) {\n\tClassify(1)\n\tClassify(0)\n\tClassify(2)\n}\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+	}
+
+	coverage, err := NewCoverage("count")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	var w bytes.Buffer
+	passed, err := NewInterpreter(TreeWalk).Test(context.Background(), dir, &w, TestOptions{
+		Coverage: coverage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if !passed {
+		t.Errorf("unexpected failure:\n%s\n", w.String())
+	}
+	durations := regexp.MustCompile(`\d+\.\d+s`)
+	want := "positive\nzero\npositive\nok  \t_" + filepath.ToSlash(dir) + "\t0.00s\tcoverage: 83.3% of statements\n"
+	if got := durations.ReplaceAllString(w.String(), "0.00s"); got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+
+	var profile bytes.Buffer
+	if err := coverage.WriteProfile(&profile); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	want = `mode: count
+classify.go:5.22,6.11 1 3
+classify.go:6.11,8.3 1 0
+classify.go:8.8,8.19 1 3
+classify.go:8.19,10.3 1 1
+classify.go:10.8,13.3 2 2
+classify.go:16.15,16.16 0 0
+`
+	if got := strings.ReplaceAll(profile.String(), "_"+filepath.ToSlash(dir)+"/", ""); got != want {
+		t.Errorf("unexpected profile: got %q, expected %q\n", got, want)
+	}
+
+	var html bytes.Buffer
+	if err := WriteCoverageHTML(&html, &profile); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	for _, want := range []string{
+		"<title>classify: Go Coverage Report</title>",
+		"classify.go (83.3%)</option>",
+		`<span class="cov10" title="3">{
+        if n &lt; 0 </span><span class="cov0" title="0">{
+                fmt.Println("negative")
+        }</span>`,
+		`<span class="cov6" title="2"> {
+                s := "positive"`,
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("unexpected HTML without %q:\n%s\n", want, html.String())
+		}
+	}
+}
+
+func TestNewCoverage(t *testing.T) {
+	if _, err := NewCoverage("sometimes"); err == nil {
+		t.Errorf("unexpected nil error\n")
+	}
+}
@@ -0,0 +1,426 @@
+package evaluator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type profileBlock struct {
+	startLine, startColumn int
+	endLine, endColumn     int
+	statements             int
+	count                  int
+}
+
+type profile struct {
+	name   string
+	blocks []profileBlock
+}
+
+// parseProfile parses a profile which go test -coverprofile or Coverage
+// writes. The counts of the same blocks are merged.
+func parseProfile(r io.Reader) (string, []*profile, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", nil, err
+		}
+		return "", nil, fmt.Errorf("bad profile: no mode line")
+	}
+	mode := strings.TrimPrefix(scanner.Text(), "mode: ")
+	if mode == scanner.Text() {
+		return "", nil, fmt.Errorf("bad profile: no mode line")
+	}
+
+	var profiles []*profile
+	byName := make(map[string]*profile)
+	merged := make(map[string]map[[4]int]int)
+	for n := 2; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		name, block, err := parseProfileLine(line)
+		if err != nil {
+			return "", nil, fmt.Errorf("bad profile: line %d: %s", n, err)
+		}
+
+		p, ok := byName[name]
+		if !ok {
+			p = &profile{name: name}
+			byName[name] = p
+			merged[name] = make(map[[4]int]int)
+			profiles = append(profiles, p)
+		}
+		key := [4]int{block.startLine, block.startColumn, block.endLine, block.endColumn}
+		if i, ok := merged[name][key]; ok {
+			if mode == "set" {
+				if block.count != 0 {
+					p.blocks[i].count = 1
+				}
+			} else {
+				p.blocks[i].count += block.count
+			}
+			continue
+		}
+		merged[name][key] = len(p.blocks)
+		p.blocks = append(p.blocks, block)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	for _, p := range profiles {
+		sort.SliceStable(p.blocks, func(i, j int) bool {
+			a, b := p.blocks[i], p.blocks[j]
+			return a.startLine < b.startLine || a.startLine == b.startLine && a.startColumn < b.startColumn
+		})
+	}
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].name < profiles[j].name
+	})
+
+	return mode, profiles, nil
+}
+
+// parseProfileLine parses a line of name:line.column,line.column statements count.
+func parseProfileLine(line string) (string, profileBlock, error) {
+	colon := strings.LastIndex(line, ":")
+	if colon == -1 {
+		return "", profileBlock{}, fmt.Errorf("no filename: %q", line)
+	}
+	var block profileBlock
+	_, err := fmt.Sscanf(
+		line[colon+1:], "%d.%d,%d.%d %d %d",
+		&block.startLine, &block.startColumn, &block.endLine, &block.endColumn,
+		&block.statements, &block.count,
+	)
+	if err != nil {
+		return "", profileBlock{}, fmt.Errorf("%q: %s", line, err)
+	}
+
+	return line[:colon], block, nil
+}
+
+func (p *profile) percent() float64 {
+	var total, covered int
+	for _, block := range p.blocks {
+		total += block.statements
+		if block.count != 0 {
+			covered += block.statements
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * float64(covered) / float64(total)
+}
+
+// findProfiledFile finds the file of the name in a profile, which is
+// the import path of its package and its base name. Packages outside
+// of any module are named after their directories.
+func findProfiledFile(name string) (string, error) {
+	dir, base := path.Split(name)
+	dir = strings.TrimSuffix(dir, "/")
+	if strings.HasPrefix(dir, "_") {
+		return filepath.Join(filepath.FromSlash(dir[1:]), base), nil
+	}
+
+	module, err := findModule(".")
+	if err != nil {
+		return "", err
+	}
+	if resolved, ok := module.resolve(dir); ok {
+		return filepath.Join(resolved, base), nil
+	}
+
+	return "", fmt.Errorf("cannot find the file of %s", name)
+}
+
+// WriteCoverageHTML writes the profile as go tool cover -html does, with
+// the sources colored by how many times they are executed.
+func WriteCoverageHTML(w io.Writer, r io.Reader) error {
+	mode, profiles, err := parseProfile(r)
+	if err != nil {
+		return err
+	}
+
+	data := coverageHTMLData{
+		Set: mode == "set",
+	}
+	packages := make(map[string]bool)
+	for _, p := range profiles {
+		filename, err := findProfiledFile(p.name)
+		if err != nil {
+			return err
+		}
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		var body bytes.Buffer
+		writeCoveredSource(&body, src, p.blocks)
+		data.Files = append(data.Files, &coveredHTMLFile{
+			Name:     p.name,
+			Body:     template.HTML(body.String()),
+			Coverage: p.percent(),
+		})
+
+		if file, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly); err == nil {
+			packages[file.Name.Name] = true
+			data.PackageName = file.Name.Name
+		}
+	}
+	if len(packages) != 1 {
+		data.PackageName = ""
+	}
+
+	return coverageHTMLTemplate.Execute(w, data)
+}
+
+// writeCoveredSource writes src escaped with the blocks wrapped in spans
+// of the classes of their counts.
+func writeCoveredSource(w *bytes.Buffer, src []byte, blocks []profileBlock) {
+	max := 0
+	for _, block := range blocks {
+		if max < block.count {
+			max = block.count
+		}
+	}
+
+	type boundary struct {
+		offset int
+		start  bool
+		count  int
+		index  int
+	}
+	var boundaries []boundary
+	lines := lineOffsets(src)
+	offset := func(line, column int) int {
+		if line < 1 || len(lines) < line {
+			return len(src)
+		}
+		return lines[line-1] + column - 1
+	}
+	for _, block := range blocks {
+		boundaries = append(
+			boundaries,
+			boundary{offset: offset(block.startLine, block.startColumn), start: true, count: block.count, index: len(boundaries)},
+			boundary{offset: offset(block.endLine, block.endColumn), index: len(boundaries) + 1},
+		)
+	}
+	// The ends come before the starts at the same offsets so that
+	// spans do not overlap.
+	sort.SliceStable(boundaries, func(i, j int) bool {
+		a, b := boundaries[i], boundaries[j]
+		if a.offset != b.offset {
+			return a.offset < b.offset
+		}
+		if a.start != b.start {
+			return !a.start
+		}
+		return a.index < b.index
+	})
+
+	for i := 0; i <= len(src); i++ {
+		for len(boundaries) != 0 && boundaries[0].offset == i {
+			b := boundaries[0]
+			boundaries = boundaries[1:]
+			if !b.start {
+				w.WriteString("</span>")
+				continue
+			}
+			fmt.Fprintf(w, `<span class="cov%d" title="%d">`, coverageClass(b.count, max), b.count)
+		}
+		if i == len(src) {
+			break
+		}
+
+		switch c := src[i]; c {
+		case '<':
+			w.WriteString("&lt;")
+		case '>':
+			w.WriteString("&gt;")
+		case '&':
+			w.WriteString("&amp;")
+		case '\t':
+			w.WriteString("        ")
+		default:
+			w.WriteByte(c)
+		}
+	}
+}
+
+func lineOffsets(src []byte) []int {
+	offsets := []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+
+	return offsets
+}
+
+// coverageClass returns which of cov0 to cov10 the count is in. Counts
+// are on a log scale up to max, and covered blocks in set mode are cov8.
+func coverageClass(count, max int) int {
+	switch {
+	case count == 0:
+		return 0
+	case max <= 1:
+		return 8
+	default:
+		return int(math.Floor(9*math.Log(float64(count))/math.Log(float64(max)))) + 1
+	}
+}
+
+type coverageHTMLData struct {
+	PackageName string
+	Files       []*coveredHTMLFile
+	Set         bool
+}
+
+type coveredHTMLFile struct {
+	Name     string
+	Body     template.HTML
+	Coverage float64
+}
+
+var coverageHTMLTemplate = template.Must(template.New("html").Funcs(template.FuncMap{
+	"colors": coverageColors,
+}).Parse(coverageHTML))
+
+// coverageColors returns the colors of cov0, which is red, and cov1 to
+// cov10, which are from gray to green.
+func coverageColors() template.CSS {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".cov0 { color: rgb(192, 0, 0) }\n")
+	for n := 1; n <= 10; n++ {
+		fmt.Fprintf(
+			&b, ".cov%d { color: rgb(%d, %d, %d) }\n",
+			n, 128-12*(n-1), 128+12*(n-1), 128+3*(n-1),
+		)
+	}
+
+	return template.CSS(b.String())
+}
+
+const coverageHTML = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+		<title>{{$pkg := .PackageName}}{{if $pkg}}{{$pkg}}: {{end}}Go Coverage Report</title>
+		<style>
+			body {
+				background: black;
+				color: rgb(80, 80, 80);
+			}
+			body, pre, #legend span {
+				font-family: Menlo, monospace;
+				font-weight: bold;
+			}
+			#topbar {
+				background: black;
+				position: fixed;
+				top: 0; left: 0; right: 0;
+				height: 42px;
+				border-bottom: 1px solid rgb(80, 80, 80);
+			}
+			#content {
+				margin-top: 50px;
+			}
+			#nav, #legend {
+				float: left;
+				margin-left: 10px;
+			}
+			#legend {
+				margin-top: 12px;
+			}
+			#nav {
+				margin-top: 10px;
+			}
+			#legend span {
+				margin: 0 5px;
+			}
+			{{colors}}
+		</style>
+	</head>
+	<body>
+		<div id="topbar">
+			<div id="nav">
+				<select id="files">
+				{{range $i, $f := .Files}}
+				<option value="file{{$i}}">{{$f.Name}} ({{printf "%.1f" $f.Coverage}}%)</option>
+				{{end}}
+				</select>
+			</div>
+			<div id="legend">
+				<span>not tracked</span>
+			{{if .Set}}
+				<span class="cov0">not covered</span>
+				<span class="cov8">covered</span>
+			{{else}}
+				<span class="cov0">no coverage</span>
+				<span class="cov1">low coverage</span>
+				<span class="cov2">*</span>
+				<span class="cov3">*</span>
+				<span class="cov4">*</span>
+				<span class="cov5">*</span>
+				<span class="cov6">*</span>
+				<span class="cov7">*</span>
+				<span class="cov8">*</span>
+				<span class="cov9">*</span>
+				<span class="cov10">high coverage</span>
+			{{end}}
+			</div>
+		</div>
+		<div id="content">
+		{{range $i, $f := .Files}}
+		<pre class="file" id="file{{$i}}" style="display: none">{{$f.Body}}</pre>
+		{{end}}
+		</div>
+	</body>
+	<script>
+	(function() {
+		var files = document.getElementById('files');
+		var visible;
+		files.addEventListener('change', onChange, false);
+		function select(part) {
+			if (visible)
+				visible.style.display = 'none';
+			visible = document.getElementById(part);
+			if (!visible)
+				return;
+			files.value = part;
+			visible.style.display = 'block';
+			location.hash = part;
+		}
+		function onChange() {
+			select(files.value);
+			window.scrollTo(0, 0);
+		}
+		if (location.hash != "") {
+			select(location.hash.substr(1));
+		}
+		if (!visible) {
+			select("file0");
+		}
+	})();
+	</script>
+</html>
+`
@@ -0,0 +1,268 @@
+package evaluator
+
+import (
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CPUProfiler profiles the time spent in the lines of interpreted
+// functions, which it measures between the events of evaluations,
+// and writes it in the pprof format.
+type CPUProfiler struct {
+	now         func() time.Time
+	start, last time.Time
+	stack       []profiledFrame
+	samples     map[string]*cpuSample
+	// order is the samples in the order they are recorded first so that
+	// profiles are written deterministically.
+	order []*cpuSample
+	files map[string]string
+}
+
+type profiledFrame struct {
+	function string
+	line     int
+}
+
+type cpuSample struct {
+	// stack is from the frame running to the outermost one.
+	stack []profiledFrame
+	nanos int64
+}
+
+func NewCPUProfiler() *CPUProfiler {
+	return &CPUProfiler{
+		now:     time.Now,
+		samples: make(map[string]*cpuSample),
+		files:   make(map[string]string),
+	}
+}
+
+func (p *CPUProfiler) Observe(event Event) {
+	now := p.now()
+	if p.start.IsZero() {
+		p.start = now
+	} else {
+		p.record(now.Sub(p.last))
+	}
+	p.last = now
+
+	switch event.Kind {
+	case CallFunction:
+		if len(p.stack) != 0 && event.Position.IsValid() {
+			p.stack[len(p.stack)-1].line = event.Position.Line
+		}
+		p.stack = append(p.stack, profiledFrame{
+			function: event.Function,
+		})
+	case ReturnFunction:
+		if len(p.stack) != 0 {
+			p.stack = p.stack[:len(p.stack)-1]
+		}
+	case EnterNode:
+		if len(p.stack) == 0 || !event.Position.IsValid() {
+			return
+		}
+		frame := &p.stack[len(p.stack)-1]
+		frame.line = event.Position.Line
+		if _, ok := p.files[frame.function]; !ok {
+			p.files[frame.function] = event.Position.Filename
+		}
+	}
+}
+
+// record adds d to the sample of the current stack. The time before
+// the first call, as in initializing packages, is not recorded.
+func (p *CPUProfiler) record(d time.Duration) {
+	if len(p.stack) == 0 {
+		return
+	}
+
+	var key strings.Builder
+	for _, frame := range p.stack {
+		key.WriteString(frame.function)
+		key.WriteByte(':')
+		key.WriteString(strconv.Itoa(frame.line))
+		key.WriteByte(';')
+	}
+	sample, ok := p.samples[key.String()]
+	if !ok {
+		sample = &cpuSample{
+			stack: make([]profiledFrame, len(p.stack)),
+		}
+		for i, frame := range p.stack {
+			sample.stack[len(p.stack)-1-i] = frame
+		}
+		p.samples[key.String()] = sample
+		p.order = append(p.order, sample)
+	}
+	sample.nanos += int64(d)
+}
+
+// WriteProfile writes the profile gzipped in the protocol buffer format
+// of pprof, which go tool pprof reads.
+func (p *CPUProfiler) WriteProfile(w io.Writer) error {
+	b := newProfileBuilder()
+	var profile protoBuffer
+	profile.message(1, b.valueType("cpu", "nanoseconds"))
+	for _, sample := range p.order {
+		var msg protoBuffer
+		locations := make([]uint64, len(sample.stack))
+		for i, frame := range sample.stack {
+			locations[i] = b.location(frame, p.files[frame.function])
+		}
+		msg.packed(1, locations)
+		msg.packed(2, []uint64{uint64(sample.nanos)})
+		profile.message(2, msg)
+	}
+	// The only mapping tells pprof that the locations are symbolized.
+	var mapping protoBuffer
+	mapping.int(1, 1)
+	mapping.int(5, b.string("warabi"))
+	mapping.int(7, 1)
+	mapping.int(8, 1)
+	mapping.int(9, 1)
+	profile.message(3, mapping)
+	profile.bytes = append(profile.bytes, b.locations.bytes...)
+	profile.bytes = append(profile.bytes, b.functions.bytes...)
+	for _, s := range b.strings {
+		profile.string(6, s)
+	}
+	if !p.start.IsZero() {
+		profile.int(9, uint64(p.start.UnixNano()))
+		profile.int(10, uint64(p.last.Sub(p.start)))
+	}
+	profile.message(11, b.valueType("cpu", "nanoseconds"))
+	profile.int(12, 1)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.bytes); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// profileBuilder builds the tables of a profile, whose entries are
+// referred by indexes or ids.
+type profileBuilder struct {
+	strings     []string
+	stringIndex map[string]uint64
+	locations   protoBuffer
+	locationIDs map[profiledFrame]uint64
+	functions   protoBuffer
+	functionIDs map[string]uint64
+}
+
+func newProfileBuilder() *profileBuilder {
+	return &profileBuilder{
+		strings:     []string{""},
+		stringIndex: map[string]uint64{"": 0},
+		locationIDs: make(map[profiledFrame]uint64),
+		functionIDs: make(map[string]uint64),
+	}
+}
+
+func (b *profileBuilder) string(s string) uint64 {
+	if i, ok := b.stringIndex[s]; ok {
+		return i
+	}
+	i := uint64(len(b.strings))
+	b.strings = append(b.strings, s)
+	b.stringIndex[s] = i
+
+	return i
+}
+
+func (b *profileBuilder) valueType(typ, unit string) protoBuffer {
+	var msg protoBuffer
+	msg.int(1, b.string(typ))
+	msg.int(2, b.string(unit))
+
+	return msg
+}
+
+func (b *profileBuilder) location(frame profiledFrame, filename string) uint64 {
+	if id, ok := b.locationIDs[frame]; ok {
+		return id
+	}
+	id := uint64(len(b.locationIDs) + 1)
+	b.locationIDs[frame] = id
+
+	var line protoBuffer
+	line.int(1, b.function(frame.function, filename))
+	line.int(2, uint64(frame.line))
+	var location protoBuffer
+	location.int(1, id)
+	location.int(2, 1)
+	location.message(4, line)
+	b.locations.message(4, location)
+
+	return id
+}
+
+func (b *profileBuilder) function(name, filename string) uint64 {
+	if id, ok := b.functionIDs[name]; ok {
+		return id
+	}
+	id := uint64(len(b.functionIDs) + 1)
+	b.functionIDs[name] = id
+
+	var function protoBuffer
+	function.int(1, id)
+	function.int(2, b.string(name))
+	function.int(3, b.string(name))
+	function.int(4, b.string(filename))
+	b.functions.message(5, function)
+
+	return id
+}
+
+// protoBuffer encodes the fields of a protocol buffer message.
+type protoBuffer struct {
+	bytes []byte
+}
+
+func (b *protoBuffer) varint(n uint64) {
+	for 0x80 <= n {
+		b.bytes = append(b.bytes, byte(n)|0x80)
+		n >>= 7
+	}
+	b.bytes = append(b.bytes, byte(n))
+}
+
+func (b *protoBuffer) key(field int, wireType uint64) {
+	b.varint(uint64(field)<<3 | wireType)
+}
+
+func (b *protoBuffer) int(field int, n uint64) {
+	if n == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(n)
+}
+
+func (b *protoBuffer) lengthDelimited(field int, bytes []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(bytes)))
+	b.bytes = append(b.bytes, bytes...)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.lengthDelimited(field, []byte(s))
+}
+
+func (b *protoBuffer) message(field int, msg protoBuffer) {
+	b.lengthDelimited(field, msg.bytes)
+}
+
+func (b *protoBuffer) packed(field int, ns []uint64) {
+	var packed protoBuffer
+	for _, n := range ns {
+		packed.varint(n)
+	}
+	b.lengthDelimited(field, packed.bytes)
+}
@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCPUProfiler(t *testing.T) {
+	profiler := NewCPUProfiler()
+	var now time.Time
+	profiler.now = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+
+	interpreter := NewInterpreter(TreeWalk)
+	interpreter.SetOutput(ioutil.Discard)
+	interpreter.AddObserver(profiler)
+	src := `package main
+
+import "fmt"
+
+func show(n int) {
+	fmt.Println(n)
+}
+
+func main() {
+	show(1)
+	n := 2
+	show(n)
+}
+`
+	if err := interpreter.RunFile(context.Background(), "main.go", []byte(src)); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	var samples []string
+	for _, sample := range profiler.order {
+		frames := make([]string, len(sample.stack))
+		for i, frame := range sample.stack {
+			frames[i] = fmt.Sprintf("%s:%d", frame.function, frame.line)
+		}
+		samples = append(samples, fmt.Sprintf("%s %s", strings.Join(frames, " "), time.Duration(sample.nanos)))
+	}
+	want := []string{
+		"main:0 1ms",
+		"main:10 9ms",
+		"show:0 main:10 1ms",
+		"show:6 main:10 11ms",
+		"fmt.Println:0 show:6 main:10 1ms",
+		"main:11 5ms",
+		"main:12 9ms",
+		"show:0 main:12 1ms",
+		"show:6 main:12 11ms",
+		"fmt.Println:0 show:6 main:12 1ms",
+	}
+	if got, want := strings.Join(samples, "\n"), strings.Join(want, "\n"); got != want {
+		t.Errorf("unexpected samples:\n%s\nexpected:\n%s\n", got, want)
+	}
+
+	var w bytes.Buffer
+	if err := profiler.WriteProfile(&w); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	r, err := gzip.NewReader(&w)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	profile, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	for _, s := range []string{"cpu", "nanoseconds", "main", "show", "fmt.Println", "main.go"} {
+		if !bytes.Contains(profile, []byte(s)) {
+			t.Errorf("unexpected profile without %q\n", s)
+		}
+	}
+}
+
+func TestProtoBuffer(t *testing.T) {
+	var b protoBuffer
+	b.int(1, 150)
+	b.string(2, "testing")
+	b.packed(4, []uint64{3, 270})
+	if got, want := b.bytes, []byte{0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g', 0x22, 0x03, 0x03, 0x8e, 0x02}; !bytes.Equal(got, want) {
+		t.Errorf("unexpected bytes: got %x, expected %x\n", got, want)
+	}
+}
@@ -0,0 +1,548 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// Debugger controls a program run by Interpreter.Debug. The program does
+// not start until it is resumed, and then runs until it stops at
+// a breakpoint, after a step, on interruption or by exiting. While it is
+// stopped, its frames, numbered from 0 for the innermost one, can be
+// inspected.
+//
+// Breakpoints can be set and cleared from another goroutine while
+// the program runs, but the other methods must not be called concurrently.
+type Debugger interface {
+	// SetBreakpoint sets a breakpoint at location, which is either
+	// file:line or the name of a function as it is called.
+	SetBreakpoint(location string) (Breakpoint, error)
+	ClearBreakpoint(id int) error
+	Breakpoints() []Breakpoint
+
+	// Continue, StepIn, StepOver and StepOut resume the program. If ctx
+	// is done before the program stops, it is interrupted at the next
+	// statement.
+	Continue(ctx context.Context) (Stop, error)
+	StepIn(ctx context.Context) (Stop, error)
+	StepOver(ctx context.Context) (Stop, error)
+	StepOut(ctx context.Context) (Stop, error)
+
+	Stack() ([]object.Frame, error)
+	Locals(frame int) ([]Variable, error)
+	Evaluate(ctx context.Context, frame int, src string) (object.Object, error)
+
+	// Abort stops the program if it has not exited.
+	Abort()
+}
+
+type Breakpoint struct {
+	ID       int
+	Function string
+	File     string
+	Line     int
+}
+
+func (b Breakpoint) String() string {
+	if b.Function != "" {
+		return fmt.Sprintf("breakpoint %d at %s", b.ID, b.Function)
+	}
+
+	return fmt.Sprintf("breakpoint %d at %s:%d", b.ID, b.File, b.Line)
+}
+
+type StopReason int
+
+const (
+	StopBreakpoint StopReason = iota
+	StopStep
+	StopInterrupt
+	StopExit
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopStep:
+		return "step"
+	case StopInterrupt:
+		return "interrupt"
+	case StopExit:
+		return "exit"
+	default:
+		return "unknown"
+	}
+}
+
+// Stop describes where and why the program stops. Breakpoint is set
+// if Reason is StopBreakpoint, and Err is the error the program exits
+// with, if any, if Reason is StopExit.
+type Stop struct {
+	Reason     StopReason
+	Breakpoint Breakpoint
+	Function   string
+	Position   token.Position
+	Err        error
+}
+
+// Variable is a variable in scope of a frame. Shadowed variables are
+// declared in outer scopes than the variables of the same names.
+type Variable struct {
+	Name     string
+	Value    object.Object
+	Shadowed bool
+}
+
+var (
+	errNotStopped = errors.New("program is not stopped")
+	errExited     = errors.New("program has exited")
+	errAborted    = errors.New("program is aborted")
+)
+
+// Debug loads the main package in the directory or the file at path to
+// debug it, observing the evaluation of it.
+func (i Interpreter) Debug(ctx context.Context, path string) (Debugger, error) {
+	dir, files, err := loadProgram(i.fileSet, path)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &debugSession{
+		files:       files,
+		fileSet:     i.fileSet,
+		breakpoints: make(map[int]Breakpoint),
+		resumes:     make(chan resumeMode),
+		stops:       make(chan Stop),
+	}
+	i.AddObserver(session)
+	session.start = func() {
+		err := i.run(ctx, dir, files)
+		if errors.Is(err, errAborted) {
+			err = nil
+		}
+		session.stops <- Stop{
+			Reason: StopExit,
+			Err:    err,
+		}
+	}
+
+	return session, nil
+}
+
+func loadProgram(fileSet *token.FileSet, path string) (string, []*ast.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() {
+		files, err := parsePackage(fileSet, path)
+		return path, files, err
+	}
+
+	file, err := parser.ParseFile(fileSet, path, nil, parser.ParseComments)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return filepath.Dir(path), []*ast.File{file}, nil
+}
+
+type resumeMode int
+
+const (
+	resumeContinue resumeMode = iota
+	resumeStepIn
+	resumeStepOver
+	resumeStepOut
+	resumeAbort
+)
+
+// debugSession is the Debugger of a program. The program runs in its own
+// goroutine, which the session blocks while the program is stopped so
+// that the frames can be inspected safely.
+type debugSession struct {
+	files   []*ast.File
+	fileSet *token.FileSet
+	start   func()
+
+	mu          sync.Mutex
+	breakpoints map[int]Breakpoint
+	lastID      int
+
+	resumes chan resumeMode
+	stops   chan Stop
+	started bool
+	stopped bool
+	exited  bool
+
+	// The fields below are accessed only from the goroutine of
+	// the program, or while it is stopped.
+	mode        resumeMode
+	stepDepth   int
+	resumedFrom token.Position
+	resumedAt   int
+	interrupted int32
+	frames      []debugFrame
+}
+
+// debugFrame is a call in progress with the statement executed last in
+// it, which builtins have none of.
+type debugFrame struct {
+	function string
+	entered  bool
+	env      *object.Environment
+	pos      token.Position
+}
+
+func (s *debugSession) SetBreakpoint(location string) (Breakpoint, error) {
+	breakpoint, err := s.parseLocation(location)
+	if err != nil {
+		return Breakpoint{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	breakpoint.ID = s.lastID
+	s.breakpoints[breakpoint.ID] = breakpoint
+	return breakpoint, nil
+}
+
+func (s *debugSession) parseLocation(location string) (Breakpoint, error) {
+	i := strings.LastIndex(location, ":")
+	if i == -1 {
+		if !strings.Contains(location, ".") && !s.declares(location) {
+			return Breakpoint{}, fmt.Errorf("undefined function: %s", location)
+		}
+		return Breakpoint{
+			Function: location,
+		}, nil
+	}
+
+	file := location[:i]
+	line, err := strconv.Atoi(location[i+1:])
+	if err != nil {
+		return Breakpoint{}, fmt.Errorf("invalid location: %s", location)
+	}
+	if !s.hasStatementAt(file, line) {
+		return Breakpoint{}, fmt.Errorf("no statement at %s", location)
+	}
+
+	return Breakpoint{
+		File: file,
+		Line: line,
+	}, nil
+}
+
+func (s *debugSession) declares(name string) bool {
+	for _, file := range s.files {
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && decl.Name.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *debugSession) hasStatementAt(file string, line int) bool {
+	var found bool
+	for _, f := range s.files {
+		if !matchesFile(s.fileSet.Position(f.Pos()).Filename, file) {
+			continue
+		}
+		ast.Inspect(f, func(node ast.Node) bool {
+			if stmt, ok := node.(ast.Stmt); ok && isPausable(stmt) && s.fileSet.Position(stmt.Pos()).Line == line {
+				found = true
+			}
+			return !found
+		})
+	}
+
+	return found
+}
+
+// matchesFile reports whether file, which is given by users, refers to
+// filename, comparing them from the last element.
+func matchesFile(filename, file string) bool {
+	filename, file = filepath.ToSlash(filepath.Clean(filename)), filepath.ToSlash(filepath.Clean(file))
+	return filename == file || strings.HasSuffix(filename, "/"+file)
+}
+
+func (s *debugSession) ClearBreakpoint(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.breakpoints[id]; !ok {
+		return fmt.Errorf("no breakpoint %d", id)
+	}
+
+	delete(s.breakpoints, id)
+	return nil
+}
+
+func (s *debugSession) Breakpoints() []Breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	breakpoints := make([]Breakpoint, 0, len(s.breakpoints))
+	for _, breakpoint := range s.breakpoints {
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool {
+		return breakpoints[i].ID < breakpoints[j].ID
+	})
+
+	return breakpoints
+}
+
+func (s *debugSession) Continue(ctx context.Context) (Stop, error) {
+	return s.resume(ctx, resumeContinue)
+}
+
+func (s *debugSession) StepIn(ctx context.Context) (Stop, error) {
+	return s.resume(ctx, resumeStepIn)
+}
+
+func (s *debugSession) StepOver(ctx context.Context) (Stop, error) {
+	return s.resume(ctx, resumeStepOver)
+}
+
+func (s *debugSession) StepOut(ctx context.Context) (Stop, error) {
+	return s.resume(ctx, resumeStepOut)
+}
+
+func (s *debugSession) resume(ctx context.Context, mode resumeMode) (Stop, error) {
+	if s.exited {
+		return Stop{}, errExited
+	}
+
+	atomic.StoreInt32(&s.interrupted, 0)
+	if s.started {
+		s.resumes <- mode
+	} else {
+		s.started = true
+		s.mode = mode
+		go s.start()
+	}
+
+	var stop Stop
+	select {
+	case stop = <-s.stops:
+	case <-ctx.Done():
+		atomic.StoreInt32(&s.interrupted, 1)
+		stop = <-s.stops
+	}
+	s.stopped = stop.Reason != StopExit
+	s.exited = stop.Reason == StopExit
+
+	return stop, nil
+}
+
+func (s *debugSession) Abort() {
+	switch {
+	case s.stopped:
+		s.stopped = false
+		s.resumes <- resumeAbort
+		<-s.stops
+	case s.exited:
+		return
+	}
+
+	s.exited = true
+}
+
+func (s *debugSession) Stack() ([]object.Frame, error) {
+	if !s.stopped {
+		return nil, errNotStopped
+	}
+
+	frames := make([]object.Frame, len(s.frames))
+	for i := range s.frames {
+		frame := s.frames[len(s.frames)-1-i]
+		frames[i] = object.Frame{
+			Function: frame.function,
+			Position: frame.pos,
+		}
+	}
+
+	return frames, nil
+}
+
+func (s *debugSession) frame(index int) (debugFrame, error) {
+	if !s.stopped {
+		return debugFrame{}, errNotStopped
+	}
+	if index < 0 || len(s.frames) <= index {
+		return debugFrame{}, fmt.Errorf("no frame %d", index)
+	}
+
+	return s.frames[len(s.frames)-1-index], nil
+}
+
+// Locals returns the variables in scope of the frame from the innermost
+// scope to the outermost one in the function, which may be that of
+// another function if it is a function literal.
+func (s *debugSession) Locals(index int) ([]Variable, error) {
+	frame, err := s.frame(index)
+	if err != nil {
+		return nil, err
+	}
+
+	var vars []Variable
+	declared := make(map[string]bool)
+	for env := frame.env; env != nil && !isPackageScope(env); env = env.Outer() {
+		for _, name := range env.Names() {
+			obj, _ := env.Get(name)
+			vars = append(vars, Variable{
+				Name:     name,
+				Value:    obj,
+				Shadowed: declared[name],
+			})
+			declared[name] = true
+		}
+	}
+
+	return vars, nil
+}
+
+func isPackageScope(env *object.Environment) bool {
+	return env == object.Universe || env.Outer() == object.Universe
+}
+
+func (s *debugSession) Evaluate(ctx context.Context, index int, src string) (obj object.Object, err error) {
+	frame, err := s.frame(index)
+	if err != nil {
+		return nil, err
+	}
+	if frame.env == nil {
+		return nil, fmt.Errorf("frame %d is of a builtin", index)
+	}
+	expr, err := parser.ParseExprFrom(s.fileSet, "main.go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	walker := &treeWalker{
+		env:     frame.env,
+		limiter: newLimiter(ctx, s.fileSet, Limits{}),
+	}
+	defer recoverBailout(&err, s.fileSet)
+
+	return valueOf(walker.evaluateExpression(expr), expr), nil
+}
+
+// Observe is called in the goroutine of the program, and blocks while
+// the program is stopped before a statement.
+func (s *debugSession) Observe(event Event) {
+	switch event.Kind {
+	case CallFunction:
+		s.frames = append(s.frames, debugFrame{
+			function: event.Function,
+			entered:  true,
+		})
+	case ReturnFunction:
+		s.frames = s.frames[:len(s.frames)-1]
+	case EnterNode:
+		if stmt, ok := event.Node.(ast.Stmt); ok && isPausable(stmt) {
+			s.statement(event.Position, event.Env)
+		}
+	}
+}
+
+func (s *debugSession) statement(pos token.Position, env *object.Environment) {
+	depth := len(s.frames)
+	frame := &s.frames[depth-1]
+	entered := frame.entered
+	frame.entered, frame.env, frame.pos = false, env, pos
+
+	stop, ok := s.shouldStop(frame.function, depth, pos, entered)
+	if !ok {
+		return
+	}
+	stop.Function = frame.function
+	stop.Position = pos
+
+	s.stops <- stop
+	s.mode = <-s.resumes
+	if s.mode == resumeAbort {
+		bail(errAborted)
+	}
+	s.stepDepth = depth
+	s.resumedFrom = pos
+	s.resumedAt = depth
+}
+
+// shouldStop stops the program at most once on each line, so that
+// resuming from a line does not stop at the same one again.
+func (s *debugSession) shouldStop(function string, depth int, pos token.Position, entered bool) (Stop, bool) {
+	onResumedLine := depth == s.resumedAt && pos.Filename == s.resumedFrom.Filename && pos.Line == s.resumedFrom.Line
+	if !onResumedLine {
+		s.resumedFrom = token.Position{}
+	}
+
+	if atomic.LoadInt32(&s.interrupted) == 1 {
+		return Stop{Reason: StopInterrupt}, true
+	}
+	if onResumedLine {
+		return Stop{}, false
+	}
+	if breakpoint, ok := s.breakpointAt(function, pos, entered); ok {
+		return Stop{
+			Reason:     StopBreakpoint,
+			Breakpoint: breakpoint,
+		}, true
+	}
+
+	switch s.mode {
+	case resumeStepIn:
+		return Stop{Reason: StopStep}, true
+	case resumeStepOver:
+		return Stop{Reason: StopStep}, depth <= s.stepDepth
+	case resumeStepOut:
+		return Stop{Reason: StopStep}, depth < s.stepDepth
+	default:
+		return Stop{}, false
+	}
+}
+
+// breakpointAt returns the breakpoint at pos. Breakpoints at functions
+// are hit only by the first statements of the calls of them.
+func (s *debugSession) breakpointAt(function string, pos token.Position, entered bool) (Breakpoint, bool) {
+	for _, breakpoint := range s.Breakpoints() {
+		switch {
+		case breakpoint.Function != "":
+			if entered && function == breakpoint.Function {
+				return breakpoint, true
+			}
+		case breakpoint.Line == pos.Line && matchesFile(pos.Filename, breakpoint.File):
+			return breakpoint, true
+		}
+	}
+
+	return Breakpoint{}, false
+}
+
+// isPausable reports whether the program can stop at stmt. Blocks are
+// not since the statements in them are.
+func isPausable(stmt ast.Stmt) bool {
+	switch stmt.(type) {
+	case *ast.BlockStmt, *ast.EmptyStmt:
+		return false
+	default:
+		return true
+	}
+}
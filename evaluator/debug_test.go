@@ -0,0 +1,211 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const debuggedSource = `package main
+
+import "fmt"
+
+func show(n int) {
+	doubled := n * 2
+	fmt.Println(n, doubled)
+}
+
+func main() {
+	n := 1
+	show(n)
+	if n := 2; n > 1 {
+		show(n)
+	}
+	fmt.Println("done")
+}
+`
+
+func debugSource(t *testing.T, src string, w *strings.Builder) Debugger {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	filename := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	interpreter := NewInterpreter(VM)
+	interpreter.SetOutput(w)
+	debugger, err := interpreter.Debug(context.Background(), filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	return debugger
+}
+
+func TestDebugger(t *testing.T) {
+	var w strings.Builder
+	debugger := debugSource(t, debuggedSource, &w)
+	defer debugger.Abort()
+	ctx := context.Background()
+
+	for _, location := range []string{"main.go:9", "main.go:x", "missing"} {
+		if _, err := debugger.SetBreakpoint(location); err == nil {
+			t.Fatalf("unexpected nil error: %s\n", location)
+		}
+	}
+	for _, location := range []string{"main.go:12", "show"} {
+		if _, err := debugger.SetBreakpoint(location); err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+	}
+
+	steps := []struct {
+		name string
+		step func(context.Context) (Stop, error)
+		want string
+	}{
+		{"continue", debugger.Continue, "breakpoint 1 at main.go:12 in main"},
+		{"step in", debugger.StepIn, "breakpoint 2 at main.go:6 in show"},
+		{"step over", debugger.StepOver, "step at main.go:7 in show"},
+		{"step out", debugger.StepOut, "step at main.go:13 in main"},
+		{"step over", debugger.StepOver, "step at main.go:14 in main"},
+		{"step in", debugger.StepIn, "breakpoint 2 at main.go:6 in show"},
+		{"step out", debugger.StepOut, "step at main.go:16 in main"},
+		{"continue", debugger.Continue, "exit"},
+	}
+	for i, step := range steps {
+		stop, err := step.step(ctx)
+		if err != nil {
+			t.Fatalf("%d: %s: unexpected error: %s\n", i, step.name, err)
+		}
+		if got := formatStop(stop); got != step.want {
+			t.Fatalf("%d: %s: unexpected stop: got %q, expected %q\n", i, step.name, got, step.want)
+		}
+
+		switch i {
+		case 0:
+			assertLocals(t, debugger, 0, "n = 1")
+		case 1:
+			stack, err := debugger.Stack()
+			if err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+			var frames []string
+			for _, frame := range stack {
+				frames = append(frames, fmt.Sprintf("%s at %d", frame.Function, frame.Position.Line))
+			}
+			if got, want := strings.Join(frames, ", "), "show at 6, main at 12"; got != want {
+				t.Errorf("unexpected stack: got %q, expected %q\n", got, want)
+			}
+			assertEvaluation(t, debugger, 0, "n * 10", "10")
+			assertEvaluation(t, debugger, 1, "n - 1", "0")
+		case 4:
+			assertLocals(t, debugger, 0, "n = 2, n = 1 (shadowed)")
+		}
+	}
+
+	if got, want := w.String(), "1 2\n2 4\ndone\n"; got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+	if _, err := debugger.Continue(ctx); err == nil {
+		t.Errorf("unexpected nil error of exited program\n")
+	}
+	if _, err := debugger.Stack(); err == nil {
+		t.Errorf("unexpected nil error of exited program\n")
+	}
+}
+
+func TestDebuggerAbort(t *testing.T) {
+	var w strings.Builder
+	debugger := debugSource(t, debuggedSource, &w)
+	ctx := context.Background()
+
+	if _, err := debugger.SetBreakpoint("main.go:16"); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if _, err := debugger.Continue(ctx); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	debugger.Abort()
+
+	if _, err := debugger.Continue(ctx); err == nil {
+		t.Errorf("unexpected nil error of aborted program\n")
+	}
+	if got, want := w.String(), "1 2\n2 4\n"; got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
+
+func TestDebuggerError(t *testing.T) {
+	var w strings.Builder
+	debugger := debugSource(t, "package main\n\nfunc main() {\n\tn := 1 / 0\n}\n", &w)
+
+	stop, err := debugger.StepIn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if got, want := formatStop(stop), "step at main.go:4 in main"; got != want {
+		t.Fatalf("unexpected stop: got %q, expected %q\n", got, want)
+	}
+
+	stop, err = debugger.StepIn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if stop.Reason != StopExit || stop.Err == nil {
+		t.Errorf("unexpected stop: got %+v, expected exit with error\n", stop)
+	}
+}
+
+func formatStop(stop Stop) string {
+	reason := stop.Reason.String()
+	switch stop.Reason {
+	case StopBreakpoint:
+		reason = fmt.Sprintf("breakpoint %d", stop.Breakpoint.ID)
+	case StopExit:
+		return reason
+	}
+
+	return fmt.Sprintf("%s at %s:%d in %s", reason, filepath.Base(stop.Position.Filename), stop.Position.Line, stop.Function)
+}
+
+func assertLocals(t *testing.T, debugger Debugger, frame int, want string) {
+	t.Helper()
+
+	vars, err := debugger.Locals(frame)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	strs := make([]string, len(vars))
+	for i, v := range vars {
+		strs[i] = fmt.Sprintf("%s = %s", v.Name, v.Value)
+		if v.Shadowed {
+			strs[i] += " (shadowed)"
+		}
+	}
+	if got := strings.Join(strs, ", "); got != want {
+		t.Errorf("unexpected locals: got %q, expected %q\n", got, want)
+	}
+}
+
+func assertEvaluation(t *testing.T, debugger Debugger, frame int, src, want string) {
+	t.Helper()
+
+	obj, err := debugger.Evaluate(context.Background(), frame, src)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if got := obj.String(); got != want {
+		t.Errorf("unexpected evaluation of %s: got %s, expected %s\n", src, got, want)
+	}
+}
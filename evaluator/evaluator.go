@@ -1,10 +1,12 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"strconv"
 
 	"github.com/tomocy/warabi/object"
@@ -12,95 +14,179 @@ import (
 
 const packageStatement = "package main\n"
 
-var fileSet = token.NewFileSet()
+func Evaluate(src string) ([]object.Object, error) {
+	return NewInterpreter(TreeWalk).Evaluate(src)
+}
 
-func Evaluate(src string) []object.Object {
-	file, err := parser.ParseFile(fileSet, "main.go", packageStatement+src, parser.ParseComments)
-	if err != nil {
-		panic(err)
-	}
+func parse(fileSet *token.FileSet, src string) (*ast.File, error) {
+	return parser.ParseFile(fileSet, "main.go", packageStatement+src, parser.ParseComments)
+}
 
-	return evaluateDeclarations(file.Decls)
+type treeWalker struct {
+	env     *object.Environment
+	limiter *limiter
 }
 
-func evaluateDeclarations(decls []ast.Decl) []object.Object {
+func (w *treeWalker) evaluateDeclarations(decls []ast.Decl) []object.Object {
 	var objs []object.Object
 	for _, decl := range decls {
-		objs = append(objs, evaluateDeclaration(decl)...)
+		objs = append(objs, w.evaluateDeclaration(decl)...)
 	}
 
 	return objs
 }
 
-func evaluateDeclaration(decl ast.Decl) []object.Object {
+func (w *treeWalker) evaluateDeclaration(decl ast.Decl) []object.Object {
 	switch decl := decl.(type) {
 	case *ast.FuncDecl:
-		return evaluateFunctionDeclaration(decl)
+		return w.evaluateFunctionDeclaration(decl)
 	case *ast.GenDecl:
-		return evaluateGenericsDeclaration(decl)
+		return w.evaluateGenericsDeclaration(decl)
 	default:
 		return nil
 	}
 }
 
+func (w *treeWalker) evaluateFunctionDeclaration(decl *ast.FuncDecl) []object.Object {
+	fn := newFunctionLiteral(decl.Type, decl.Body, w.env)
+	if isReferable(decl) {
+		w.env.Set(decl.Name.Name, fn)
+	}
+
+	return []object.Object{fn}
+}
+
 func evaluateFunctionDeclaration(decl *ast.FuncDecl) []object.Object {
-	env := setFunctionEnvironment(decl.Type)
-	return []object.Object{
-		&object.FunctionLiteral{
-			Params:  decl.Type.Params.List,
-			Results: decl.Type.Results.List,
-			Body:    decl.Body.List,
-			Env:     env,
-		},
-	}
-}
-
-func setFunctionEnvironment(t *ast.FuncType) *object.Environment {
-	env := object.NewEnvironment()
-	for _, param := range t.Params.List {
-		for _, name := range param.Names {
-			zeroValue := zeroValues[name.Name]
-			obj := evaluateExpression(zeroValue)
-			env.Set(name.Name, obj)
-		}
+	return []object.Object{newFunctionLiteral(decl.Type, decl.Body, nil)}
+}
+
+// isReferable reports whether the function can be referred to by its name.
+// init functions can not, so several of them may be declared.
+func isReferable(decl *ast.FuncDecl) bool {
+	return decl.Name.Name != "init"
+}
+
+func fieldList(fields *ast.FieldList) []*ast.Field {
+	if fields == nil {
+		return nil
+	}
+
+	return fields.List
+}
+
+func (w *treeWalker) callFunction(fn *object.FunctionLiteral, args []object.Object) {
+	walker := w.enclose(scopeOf(fn, w.env))
+	for i, name := range parameterNames(fn) {
+		walker.env.Set(name, args[i])
+	}
+	walker.executeStatements(fn.Body)
+}
+
+func (w *treeWalker) enclose(env *object.Environment) *treeWalker {
+	return &treeWalker{
+		env:     object.NewEnclosedEnvironment(env),
+		limiter: w.limiter,
 	}
-	for _, res := range t.Results.List {
-		for _, name := range res.Names {
-			zeroValue := zeroValues[name.Name]
-			obj := evaluateExpression(zeroValue)
-			env.Set(name.Name, obj)
+}
+
+func (w *treeWalker) executeStatements(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		w.executeStatement(stmt)
+	}
+}
+
+func (w *treeWalker) executeStatement(stmt ast.Stmt) {
+	w.limiter.step()
+	w.limiter.observeEnter(stmt, w.env)
+	switch stmt := stmt.(type) {
+	case *ast.DeclStmt:
+		w.evaluateDeclaration(stmt.Decl)
+	case *ast.AssignStmt:
+		w.executeAssignment(stmt)
+	case *ast.ExprStmt:
+		w.evaluateExpression(stmt.X)
+	case *ast.BlockStmt:
+		w.enclose(w.env).executeStatements(stmt.List)
+	case *ast.IfStmt:
+		w.enclose(w.env).executeIf(stmt)
+	case *ast.EmptyStmt:
+	default:
+		bailUnsupported(stmt)
+	}
+	w.limiter.observeExit(stmt, nil)
+}
+
+// executeAssignment executes short variable declarations, which are
+// the only assignments supported.
+func (w *treeWalker) executeAssignment(stmt *ast.AssignStmt) {
+	names, ok := definedNames(stmt)
+	if !ok {
+		bailUnsupported(stmt)
+	}
+	objs := make([]object.Object, len(names))
+	for i, value := range stmt.Rhs {
+		objs[i] = valueOf(w.evaluateExpression(value), value)
+	}
+	for i, name := range names {
+		w.env.Set(name, objs[i])
+		w.limiter.observeAssign(stmt.Lhs[i].(*ast.Ident), objs[i])
+	}
+}
+
+func definedNames(stmt *ast.AssignStmt) ([]string, bool) {
+	if stmt.Tok != token.DEFINE || len(stmt.Lhs) != len(stmt.Rhs) {
+		return nil, false
+	}
+	names := make([]string, len(stmt.Lhs))
+	for i, lhs := range stmt.Lhs {
+		ident, ok := lhs.(*ast.Ident)
+		if !ok {
+			return nil, false
 		}
+		names[i] = ident.Name
 	}
 
-	return env
+	return names, true
 }
 
-func evaluateGenericsDeclaration(decl *ast.GenDecl) []object.Object {
+func (w *treeWalker) executeIf(stmt *ast.IfStmt) {
+	if stmt.Init != nil {
+		w.executeStatement(stmt.Init)
+	}
+	if condition(w.evaluateExpression(stmt.Cond), stmt.Cond) {
+		w.executeStatement(stmt.Body)
+		return
+	}
+	if stmt.Else != nil {
+		w.executeStatement(stmt.Else)
+	}
+}
+
+func (w *treeWalker) evaluateGenericsDeclaration(decl *ast.GenDecl) []object.Object {
 	var objs []object.Object
 	for _, spec := range decl.Specs {
-		objs = append(objs, evaluateSpecification(spec)...)
+		objs = append(objs, w.evaluateSpecification(spec)...)
 	}
 
 	return objs
 }
 
-func evaluateSpecification(spec ast.Spec) []object.Object {
+func (w *treeWalker) evaluateSpecification(spec ast.Spec) []object.Object {
 	switch spec := spec.(type) {
 	case *ast.ValueSpec:
-		return evaluateValueSpecification(spec)
+		return w.evaluateValueSpecification(spec)
 	default:
 		return nil
 	}
 }
 
-func evaluateValueSpecification(spec *ast.ValueSpec) []object.Object {
+func (w *treeWalker) evaluateValueSpecification(spec *ast.ValueSpec) []object.Object {
 	var objs []object.Object
-	if len(spec.Values) == 0 {
-		spec = restoreZeroValues(*spec)
-	}
+	spec = normalizeValueSpecification(spec)
 	for i := 0; i < len(spec.Names); i++ {
-		obj := evaluateExpression(spec.Values[i])
-		object.Env.Set(spec.Names[i].Name, obj)
+		obj := valueOf(w.evaluateExpression(spec.Values[i]), spec.Values[i])
+		w.env.Set(spec.Names[i].Name, obj)
+		w.limiter.observeAssign(spec.Names[i], obj)
 		objs = append(objs, obj)
 	}
 
@@ -118,28 +204,50 @@ var zeroValues = map[string]ast.Expr{
 	},
 	"byte": &ast.BasicLit{
 		Kind:  token.CHAR,
-		Value: "'0'",
+		Value: `'\x00'`,
 	},
 	"rune": &ast.BasicLit{
 		Kind:  token.CHAR,
-		Value: "'0'",
+		Value: `'\x00'`,
 	},
 	"float32": &ast.BasicLit{
 		Kind:  token.FLOAT,
 		Value: "0.0",
 	},
+	"float64": &ast.BasicLit{
+		Kind:  token.FLOAT,
+		Value: "0.0",
+	},
+	"bool": &ast.Ident{
+		Name: "false",
+	},
+}
+
+// normalizeValueSpecification returns spec with the zero values if it has
+// no values, reporting an error if it has values as many as not its names.
+func normalizeValueSpecification(spec *ast.ValueSpec) *ast.ValueSpec {
+	if len(spec.Values) == 0 {
+		return restoreZeroValues(*spec)
+	}
+	if len(spec.Values) != len(spec.Names) {
+		bail(errorAt(
+			spec.Pos(), "assignment mismatch: %d variables but %d values", len(spec.Names), len(spec.Values),
+		))
+	}
+
+	return spec
 }
 
 func restoreZeroValues(spec ast.ValueSpec) *ast.ValueSpec {
 	spec.Values = make([]ast.Expr, len(spec.Names))
 	ident, ok := spec.Type.(*ast.Ident)
 	if !ok {
-		return &spec
+		bail(errorAt(spec.Type.Pos(), "unsupported type: %s", types.ExprString(spec.Type)))
 	}
 
 	zeroValue, ok := zeroValues[ident.Name]
 	if !ok {
-		return &spec
+		bail(errorAt(ident.Pos(), "unsupported type: %s", ident.Name))
 	}
 
 	for i := 0; i < len(spec.Names); i++ {
@@ -149,75 +257,196 @@ func restoreZeroValues(spec ast.ValueSpec) *ast.ValueSpec {
 	return &spec
 }
 
-func evaluateExpression(expr ast.Expr) object.Object {
+func (w *treeWalker) evaluateExpression(expr ast.Expr) object.Object {
+	w.limiter.step()
+	w.limiter.observeEnter(expr, w.env)
+	obj := w.evaluateExpressionOf(expr)
+	w.limiter.observeExit(expr, obj)
+
+	return obj
+}
+
+func (w *treeWalker) evaluateExpressionOf(expr ast.Expr) object.Object {
 	switch expr := expr.(type) {
 	case *ast.ParenExpr:
-		return evaluateParenOperation(expr)
+		return w.evaluateParenOperation(expr)
 	case *ast.BinaryExpr:
-		return evaluateBinaryOperation(expr)
+		return w.evaluateBinaryOperation(expr)
 	case *ast.UnaryExpr:
-		return evaluateUnaryOperation(expr)
+		return w.evaluateUnaryOperation(expr)
+	case *ast.SelectorExpr:
+		return w.evaluateSelector(expr)
+	case *ast.CallExpr:
+		return w.evaluateCall(expr)
+	case *ast.FuncLit:
+		return newFunctionLiteral(expr.Type, expr.Body, w.env)
 	case *ast.Ident:
-		return evaluateIdentifier(expr)
+		return w.evaluateIdentifier(expr)
 	case *ast.BasicLit:
 		return evaluateBasicLiteral(expr)
 	default:
+		bailUnsupportedExpression(expr)
 		return nil
 	}
 }
 
-func evaluateParenOperation(expr *ast.ParenExpr) object.Object {
-	return evaluateExpression(expr.X)
+func (w *treeWalker) evaluateParenOperation(expr *ast.ParenExpr) object.Object {
+	return w.evaluateExpression(expr.X)
+}
+
+func (w *treeWalker) evaluateBinaryOperation(expr *ast.BinaryExpr) object.Object {
+	leftObj := w.evaluateExpression(expr.X)
+	if obj, ok := shortCircuit(expr, leftObj); ok {
+		return obj
+	}
+	rightObj := w.evaluateExpression(expr.Y)
+	obj := operateBinary(expr, leftObj, rightObj)
+	w.limiter.allocate(obj)
+
+	return obj
 }
 
-func evaluateBinaryOperation(expr *ast.BinaryExpr) object.Object {
-	leftObj := evaluateExpression(expr.X)
-	rightObj := evaluateExpression(expr.Y)
+// shortCircuit reports whether expr is a logical operation whose result
+// is determined by the left operand, in which case the right one must not
+// be evaluated.
+func shortCircuit(expr *ast.BinaryExpr, leftObj object.Object) (object.Object, bool) {
 	switch {
-	case leftObj.Kind() == object.Integer && rightObj.Kind() == object.Integer:
-		return evaluateBinaryOperationOfIntegerLiteral(
-			leftObj.(*object.IntegerLiteral),
-			expr.Op,
-			rightObj.(*object.IntegerLiteral),
-		)
-	case leftObj.Kind() == object.String && rightObj.Kind() == object.String:
-		return evaluateBinaryOperationOfStringLiteral(
-			leftObj.(*object.StringLiteral),
-			expr.Op,
-			rightObj.(*object.StringLiteral),
-		)
-	case leftObj.Kind() == object.Character && rightObj.Kind() == object.Character:
-		return evaluateBinaryOperationOfCharacterLiteral(
-			leftObj.(*object.CharacterLiteral),
-			expr.Op,
-			rightObj.(*object.CharacterLiteral),
-		)
-	case leftObj.Kind() == object.FloatingPoint && rightObj.Kind() == object.FloatingPoint:
-		return evaluateBinaryOperationOfFloatingPointLiteral(
-			leftObj.(*object.FloatingPointLiteral),
-			expr.Op,
-			rightObj.(*object.FloatingPointLiteral),
-		)
-	case leftObj.Kind() == object.FloatingPoint && rightObj.Kind() == object.Integer:
-		intObj := rightObj.(*object.IntegerLiteral)
-		floatObj := &object.FloatingPointLiteral{
-			Value: float32(intObj.Value),
-		}
-		return evaluateBinaryOperationOfFloatingPointLiteral(
-			leftObj.(*object.FloatingPointLiteral),
-			expr.Op,
-			floatObj,
-		)
-	case leftObj.Kind() == object.Integer && rightObj.Kind() == object.FloatingPoint:
-		intObj := leftObj.(*object.IntegerLiteral)
-		floatObj := &object.FloatingPointLiteral{
-			Value: float32(intObj.Value),
-		}
-		return evaluateBinaryOperationOfFloatingPointLiteral(
-			floatObj,
-			expr.Op,
-			rightObj.(*object.FloatingPointLiteral),
-		)
+	case expr.Op == token.LAND && leftObj == object.False:
+		return leftObj, true
+	case expr.Op == token.LOR && leftObj == object.True:
+		return leftObj, true
+	default:
+		return nil, false
+	}
+}
+
+func operateBinary(expr *ast.BinaryExpr, leftObj object.Object, rightObj object.Object) object.Object {
+	leftObj, rightObj = promote(valueOf(leftObj, expr.X), valueOf(rightObj, expr.Y))
+	if leftObj.Kind() != rightObj.Kind() {
+		bail(errorAt(
+			expr.OpPos, "invalid operation: %s (mismatched types %s and %s)", types.ExprString(expr), leftObj.Kind(), rightObj.Kind(),
+		))
+	}
+	if (expr.Op == token.QUO || expr.Op == token.REM) && isIntegerZero(rightObj) {
+		bail(&positionError{
+			pos: expr.OpPos,
+			at: func(position token.Position) error {
+				return &RuntimeError{
+					Pos:     position,
+					Message: "integer divide by zero",
+				}
+			},
+		})
+	}
+
+	var obj object.Object
+	switch leftObj := leftObj.(type) {
+	case *object.IntegerLiteral:
+		obj = evaluateBinaryOperationOfIntegerLiteral(leftObj, expr.Op, rightObj.(*object.IntegerLiteral))
+	case *object.StringLiteral:
+		obj = evaluateBinaryOperationOfStringLiteral(leftObj, expr.Op, rightObj.(*object.StringLiteral))
+	case *object.CharacterLiteral:
+		obj = evaluateBinaryOperationOfCharacterLiteral(leftObj, expr.Op, rightObj.(*object.CharacterLiteral))
+	case *object.FloatingPointLiteral:
+		obj = evaluateBinaryOperationOfFloatingPointLiteral(leftObj, expr.Op, rightObj.(*object.FloatingPointLiteral))
+	case *object.BooleanLiteral:
+		obj = evaluateBinaryOperationOfBooleanLiteral(leftObj, expr.Op, rightObj)
+	}
+	if obj == nil {
+		bailUndefinedOperator(expr.OpPos, expr.Op, expr.X, leftObj)
+	}
+
+	return obj
+}
+
+// numericRanks ranks the numeric kinds in the order Go converts untyped
+// constants of different kinds in operations into the higher one.
+var numericRanks = map[object.Kind]int{
+	object.Integer:       1,
+	object.Character:     2,
+	object.FloatingPoint: 3,
+}
+
+// promote converts the numeric operand of the lower kind into the kind
+// of the other one.
+func promote(leftObj, rightObj object.Object) (object.Object, object.Object) {
+	leftRank, leftOK := numericRanks[leftObj.Kind()]
+	rightRank, rightOK := numericRanks[rightObj.Kind()]
+	if !leftOK || !rightOK {
+		return leftObj, rightObj
+	}
+	if leftRank < rightRank {
+		return convertNumber(leftObj, rightObj.Kind()), rightObj
+	}
+
+	return leftObj, convertNumber(rightObj, leftObj.Kind())
+}
+
+func convertNumber(obj object.Object, kind object.Kind) object.Object {
+	switch {
+	case obj.Kind() == kind:
+		return obj
+	case kind == object.Character:
+		return &object.CharacterLiteral{Value: rune(obj.(*object.IntegerLiteral).Value)}
+	}
+
+	switch obj := obj.(type) {
+	case *object.IntegerLiteral:
+		return &object.FloatingPointLiteral{Value: float32(obj.Value)}
+	case *object.CharacterLiteral:
+		return &object.FloatingPointLiteral{Value: float32(obj.Value)}
+	default:
+		return obj
+	}
+}
+
+func isIntegerZero(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.IntegerLiteral:
+		return obj.Value == 0
+	case *object.CharacterLiteral:
+		return obj.Value == 0
+	default:
+		return false
+	}
+}
+
+// RuntimeError is an error which Go reports as a run-time panic.
+type RuntimeError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s: runtime error: %s", e.Pos, e.Message)
+}
+
+// valueOf returns obj, which is evaluated from expr, reporting an error
+// if it is nil, that is, expr is a call of a function without results.
+func valueOf(obj object.Object, expr ast.Expr) object.Object {
+	if obj == nil {
+		bail(errorAt(expr.Pos(), "%s (no value) used as value", types.ExprString(expr)))
+	}
+
+	return obj
+}
+
+func bailUndefinedOperator(pos token.Pos, operator token.Token, operand ast.Expr, obj object.Object) {
+	bail(errorAt(
+		pos, "invalid operation: operator %s not defined on %s (value of type %s)", operator, types.ExprString(operand), obj.Kind(),
+	))
+}
+
+func evaluateBinaryOperationOfBooleanLiteral(leftObj object.Object, operator token.Token, rightObj object.Object) object.Object {
+	switch operator {
+	case token.LAND:
+		return convertToBooleanLiteral(leftObj == object.True && rightObj == object.True)
+	case token.LOR:
+		return convertToBooleanLiteral(leftObj == object.True || rightObj == object.True)
+	case token.EQL:
+		return convertToBooleanLiteral(leftObj == rightObj)
+	case token.NEQ:
+		return convertToBooleanLiteral(leftObj != rightObj)
 	default:
 		return nil
 	}
@@ -236,12 +465,13 @@ func evaluateBinaryOperationOfIntegerLiteral(
 	case token.MUL:
 		return &object.IntegerLiteral{Value: leftObj.Value * rightObj.Value}
 	case token.QUO:
-		if rightObj.Value == 0 {
-			return nil
-		}
 		return &object.IntegerLiteral{Value: leftObj.Value / rightObj.Value}
 	case token.REM:
 		return &object.IntegerLiteral{Value: leftObj.Value % rightObj.Value}
+	case token.EQL:
+		return convertToBooleanLiteral(leftObj.Value == rightObj.Value)
+	case token.NEQ:
+		return convertToBooleanLiteral(leftObj.Value != rightObj.Value)
 	case token.LSS:
 		return convertToBooleanLiteral(leftObj.Value < rightObj.Value)
 	case token.GTR:
@@ -263,6 +493,10 @@ func evaluateBinaryOperationOfStringLiteral(
 	switch operator {
 	case token.ADD:
 		return &object.StringLiteral{Value: leftObj.Value + rightObj.Value}
+	case token.EQL:
+		return convertToBooleanLiteral(leftObj.Value == rightObj.Value)
+	case token.NEQ:
+		return convertToBooleanLiteral(leftObj.Value != rightObj.Value)
 	case token.LSS:
 		return convertToBooleanLiteral(leftObj.Value < rightObj.Value)
 	case token.GTR:
@@ -289,12 +523,13 @@ func evaluateBinaryOperationOfCharacterLiteral(
 	case token.MUL:
 		return &object.CharacterLiteral{Value: leftObj.Value * rightObj.Value}
 	case token.QUO:
-		if rightObj.Value == 0 {
-			return nil
-		}
 		return &object.CharacterLiteral{Value: leftObj.Value / rightObj.Value}
 	case token.REM:
 		return &object.CharacterLiteral{Value: leftObj.Value % rightObj.Value}
+	case token.EQL:
+		return convertToBooleanLiteral(leftObj.Value == rightObj.Value)
+	case token.NEQ:
+		return convertToBooleanLiteral(leftObj.Value != rightObj.Value)
 	case token.LSS:
 		return convertToBooleanLiteral(leftObj.Value < rightObj.Value)
 	case token.GTR:
@@ -321,10 +556,11 @@ func evaluateBinaryOperationOfFloatingPointLiteral(
 	case token.MUL:
 		return &object.FloatingPointLiteral{Value: leftObj.Value * rightObj.Value}
 	case token.QUO:
-		if rightObj.Value == 0 {
-			return nil
-		}
 		return &object.FloatingPointLiteral{Value: leftObj.Value / rightObj.Value}
+	case token.EQL:
+		return convertToBooleanLiteral(leftObj.Value == rightObj.Value)
+	case token.NEQ:
+		return convertToBooleanLiteral(leftObj.Value != rightObj.Value)
 	case token.LSS:
 		return convertToBooleanLiteral(leftObj.Value < rightObj.Value)
 	case token.GTR:
@@ -338,30 +574,64 @@ func evaluateBinaryOperationOfFloatingPointLiteral(
 	}
 }
 
-func evaluateUnaryOperation(expr *ast.UnaryExpr) object.Object {
+func (w *treeWalker) evaluateUnaryOperation(expr *ast.UnaryExpr) object.Object {
+	obj := w.evaluateExpression(expr.X)
+	return operateUnary(expr, obj)
+}
+
+func operateUnary(expr *ast.UnaryExpr, obj object.Object) object.Object {
+	obj = valueOf(obj, expr.X)
+	var operated object.Object
 	switch expr.Op {
+	case token.ADD:
+		operated = operatePlus(obj)
 	case token.SUB:
-		return evaluateMinusOperation(expr)
+		operated = operateMinus(obj)
+	case token.XOR:
+		operated = operateComplement(obj)
 	case token.NOT:
-		return evaluateNotOperation(expr)
-	default:
+		operated = operateNot(obj)
+	}
+	if operated == nil {
+		bailUndefinedOperator(expr.OpPos, expr.Op, expr.X, obj)
+	}
+
+	return operated
+}
+
+func operatePlus(obj object.Object) object.Object {
+	if _, ok := numericRanks[obj.Kind()]; !ok {
 		return nil
 	}
+
+	return obj
 }
 
-func evaluateMinusOperation(expr *ast.UnaryExpr) object.Object {
-	obj := evaluateExpression(expr.X)
-	intLiteral, ok := obj.(*object.IntegerLiteral)
-	if !ok {
+func operateMinus(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.IntegerLiteral:
+		return &object.IntegerLiteral{Value: -obj.Value}
+	case *object.CharacterLiteral:
+		return &object.CharacterLiteral{Value: -obj.Value}
+	case *object.FloatingPointLiteral:
+		return &object.FloatingPointLiteral{Value: -obj.Value}
+	default:
 		return nil
 	}
+}
 
-	intLiteral.Value *= -1
-	return intLiteral
+func operateComplement(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.IntegerLiteral:
+		return &object.IntegerLiteral{Value: ^obj.Value}
+	case *object.CharacterLiteral:
+		return &object.CharacterLiteral{Value: ^obj.Value}
+	default:
+		return nil
+	}
 }
 
-func evaluateNotOperation(expr *ast.UnaryExpr) object.Object {
-	obj := evaluateExpression(expr.X)
+func operateNot(obj object.Object) object.Object {
 	boolLiteral, ok := obj.(*object.BooleanLiteral)
 	if !ok {
 		return nil
@@ -374,10 +644,57 @@ func evaluateNotOperation(expr *ast.UnaryExpr) object.Object {
 	return object.True
 }
 
-func evaluateIdentifier(expr *ast.Ident) object.Object {
-	obj, ok := object.Env.Get(expr.Name)
+func (w *treeWalker) evaluateSelector(expr *ast.SelectorExpr) object.Object {
+	obj := w.evaluateExpression(expr.X)
+	return selectMember(obj, expr)
+}
+
+func selectMember(obj object.Object, expr *ast.SelectorExpr) object.Object {
+	obj = valueOf(obj, expr.X)
+	sel := expr.Sel
+	selector, ok := obj.(object.Selector)
 	if !ok {
-		return nil
+		bail(errorAt(
+			sel.Pos(), "%s undefined (type %s has no field or method %s)", types.ExprString(expr), obj.Kind(), sel.Name,
+		))
+	}
+	if !ast.IsExported(sel.Name) {
+		bail(errorAt(sel.Pos(), "cannot refer to unexported name %s.%s", selectorName(selector), sel.Name))
+	}
+	member, ok := selector.Select(sel.Name)
+	if !ok {
+		bail(errorAt(sel.Pos(), "undefined: %s.%s", selectorName(selector), sel.Name))
+	}
+
+	return member
+}
+
+func selectorName(selector object.Selector) string {
+	if pkg, ok := selector.(*object.ImportedPackage); ok {
+		return pkg.Name
+	}
+
+	return selector.String()
+}
+
+func (w *treeWalker) evaluateCall(expr *ast.CallExpr) object.Object {
+	fn := w.evaluateExpression(expr.Fun)
+	args := make([]object.Object, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = w.evaluateExpression(arg)
+	}
+
+	return callObject(w, w.limiter, expr, fn, args)
+}
+
+func (w *treeWalker) evaluateIdentifier(expr *ast.Ident) object.Object {
+	return lookUp(w.env, expr)
+}
+
+func lookUp(env *object.Environment, ident *ast.Ident) object.Object {
+	obj, ok := env.Get(ident.Name)
+	if !ok {
+		bail(errorAt(ident.Pos(), "undefined: %s", ident.Name))
 	}
 
 	return obj
@@ -394,43 +711,60 @@ func evaluateBasicLiteral(expr *ast.BasicLit) object.Object {
 	case token.FLOAT:
 		return evaluateFloatingPointLiteral(expr)
 	default:
+		bailUnsupportedExpression(expr)
 		return nil
 	}
 }
 
 func evaluateIntegerLiteral(expr *ast.BasicLit) object.Object {
-	value, err := strconv.Atoi(expr.Value)
+	value, err := strconv.ParseInt(expr.Value, 0, 0)
 	if err != nil {
-		return nil
+		bailInvalidLiteral(expr, "int", err)
 	}
 	return &object.IntegerLiteral{
-		Value: value,
+		Value: int(value),
 	}
 }
 
 func evaluateStringLiteral(expr *ast.BasicLit) object.Object {
+	value, err := strconv.Unquote(expr.Value)
+	if err != nil {
+		bailInvalidLiteral(expr, "string", err)
+	}
 	return &object.StringLiteral{
-		Value: expr.Value[1 : len(expr.Value)-1],
+		Value: value,
 	}
 }
 
 func evaluateCharacterLiteral(expr *ast.BasicLit) object.Object {
+	value, _, _, err := strconv.UnquoteChar(expr.Value[1:len(expr.Value)-1], '\'')
+	if err != nil {
+		bailInvalidLiteral(expr, "rune", err)
+	}
 	return &object.CharacterLiteral{
-		Value: []rune(expr.Value[1 : len(expr.Value)-1])[0],
+		Value: value,
 	}
 }
 
 func evaluateFloatingPointLiteral(expr *ast.BasicLit) object.Object {
 	value, err := strconv.ParseFloat(expr.Value, 32)
 	if err != nil {
-		return nil
+		bailInvalidLiteral(expr, "float32", err)
 	}
 	return &object.FloatingPointLiteral{
 		Value: float32(value),
 	}
 }
 
+func bailInvalidLiteral(expr *ast.BasicLit, typ string, err error) {
+	if errors.Is(err, strconv.ErrRange) {
+		bail(errorAt(expr.Pos(), "cannot use %s (untyped constant) as %s value (overflows)", expr.Value, typ))
+	}
+
+	bail(errorAt(expr.Pos(), "invalid literal %s", expr.Value))
+}
+
 func convertToBooleanLiteral(b bool) object.Object {
-	obj, _ := object.Env.Get(fmt.Sprintf("%t", b))
+	obj, _ := object.Universe.Get(fmt.Sprintf("%t", b))
 	return obj
 }
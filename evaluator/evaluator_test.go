@@ -1,9 +1,16 @@
 package evaluator
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
 	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/tomocy/warabi/object"
@@ -155,6 +162,20 @@ func TestEvaluate(t *testing.T) {
 				object.False,
 			},
 		},
+		{
+			"var a = b * 2; var b = 1 + c; var c = 1",
+			[]object.Object{
+				&object.IntegerLiteral{
+					Value: 1,
+				},
+				&object.IntegerLiteral{
+					Value: 2,
+				},
+				&object.IntegerLiteral{
+					Value: 4,
+				},
+			},
+		},
 		{
 			"var a, b, c, d = true, false, !false, !true",
 			[]object.Object{
@@ -164,19 +185,824 @@ func TestEvaluate(t *testing.T) {
 				object.False,
 			},
 		},
+		{
+			"var a, b, c, d = true && false, false || true, 1 < 2 && 2 < 3, false && 1 / 0 == 0",
+			[]object.Object{
+				object.False,
+				object.True,
+				object.True,
+				object.False,
+			},
+		},
+		{
+			"var a, b, c, d = 'a' + 1, 1 + 'a' * 0.5, -1.5, ^0x0f",
+			[]object.Object{
+				&object.CharacterLiteral{
+					Value: 'b',
+				},
+				&object.FloatingPointLiteral{
+					Value: 49.5,
+				},
+				&object.FloatingPointLiteral{
+					Value: -1.5,
+				},
+				&object.IntegerLiteral{
+					Value: -16,
+				},
+			},
+		},
+		{
+			"var a bool; var b float64; var c rune",
+			[]object.Object{
+				object.False,
+				&object.FloatingPointLiteral{
+					Value: 0,
+				},
+				&object.CharacterLiteral{
+					Value: 0,
+				},
+			},
+		},
+	}
+
+	backends := []Backend{TreeWalk, VM, Closure}
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			interpreter := NewInterpreter(backend)
+			for _, test := range tests {
+				t.Run(test.source, func(t *testing.T) {
+					gots, err := interpreter.Evaluate(test.source)
+					if err != nil {
+						t.Fatalf("unexpected error: %s\n", err)
+					}
+					if len(gots) != len(test.wants) {
+						t.Fatalf("unexpected object length: got %d, expected %d\n", len(gots), len(test.wants))
+					}
+					for i := 0; i < len(test.wants); i++ {
+						if !reflect.DeepEqual(gots[i], test.wants[i]) {
+							t.Errorf("unexpected object: got %#v, expected %#v\n", gots[i], test.wants[i])
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"var a = 1 / 0", "main.go:2:11: runtime error: integer divide by zero"},
+		{"var a = 'a' % '\\x00'", "main.go:2:13: runtime error: integer divide by zero"},
+		{`var a = 1 + "a"`, `main.go:2:11: invalid operation: 1 + "a" (mismatched types int and string)`},
+		{"var a = 1.5 % 1", "main.go:2:13: invalid operation: operator % not defined on 1.5 (value of type float32)"},
+		{`var a = -"a"`, `main.go:2:9: invalid operation: operator - not defined on "a" (value of type string)`},
+		{"var a = b", "main.go:2:9: undefined: b"},
+		{"func f() {}; var a = f()", "main.go:2:22: f() (no value) used as value"},
+		{"func f() {}; var a = f() + 1", "main.go:2:22: f() (no value) used as value"},
+		{"var a = 1; var b = a.c", "main.go:2:22: a.c undefined (type int has no field or method c)"},
+		{"var a = []int{}", "main.go:2:9: unsupported expression: []int{}"},
+		{"var a []int", "main.go:2:7: unsupported type: []int"},
+		{"var a, b = 1", "main.go:2:5: assignment mismatch: 2 variables but 1 values"},
+		{"var a = 99999999999999999999", "main.go:2:9: cannot use 99999999999999999999 (untyped constant) as int value (overflows)"},
+	}
+
+	backends := []Backend{TreeWalk, VM, Closure}
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			interpreter := NewInterpreter(backend)
+			for _, test := range tests {
+				t.Run(test.source, func(t *testing.T) {
+					interpreter.Env().Clear()
+					_, err := interpreter.Evaluate(test.source)
+					if err == nil {
+						t.Fatalf("unexpected nil error\n")
+					}
+					if got := err.Error(); got != test.want {
+						t.Errorf("unexpected error: got %q, expected %q\n", got, test.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		source  string
+		name    string
+		wantErr bool
+	}{
+		{
+			"func callee() { var local = 1; var local2 = local + 1 }",
+			"callee",
+			false,
+		},
+		{
+			"func callee() {}",
+			"callee",
+			false,
+		},
+		{
+			"func callee(a int) {}",
+			"callee",
+			true,
+		},
+		{
+			"func callee() { callee() }",
+			"callee",
+			true,
+		},
+		{
+			"var callee = 1",
+			"callee",
+			true,
+		},
+	}
+
+	backends := []Backend{TreeWalk, VM, Closure}
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			interpreter := NewInterpreter(backend)
+			for _, test := range tests {
+				t.Run(test.source, func(t *testing.T) {
+					if _, err := interpreter.Evaluate(test.source); err != nil {
+						t.Fatalf("unexpected error: %s\n", err)
+					}
+					err := interpreter.Call(context.Background(), test.name)
+					if (err != nil) != test.wantErr {
+						t.Errorf("unexpected error: got %v, expected error: %t\n", err, test.wantErr)
+					}
+					if _, ok := interpreter.Env().Get("local"); ok {
+						t.Errorf("unexpected leak of local variable\n")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestEvaluateExpressionWithoutValue(t *testing.T) {
+	backends := []Backend{TreeWalk, VM, Closure}
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			interpreter := NewInterpreter(backend)
+			if _, err := interpreter.Evaluate("func f() {}"); err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+			if obj, err := interpreter.EvaluateExpression(context.Background(), "f()"); obj != nil || err != nil {
+				t.Errorf("unexpected result: %v, %v\n", obj, err)
+			}
+			if _, err := interpreter.EvaluateExpression(context.Background(), "f() + 1"); err == nil {
+				t.Errorf("unexpected nil error\n")
+			}
+		})
+	}
+}
+
+func TestRunPackage(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wants   map[string]object.Object
+		wantErr bool
+	}{
+		{
+			"initialization order",
+			map[string]string{
+				"a.go":      "package main\n\nvar pkgA = pkgB + 1\n\nfunc init() { var x = pkgA }\n",
+				"b.go":      "package main\n\nvar pkgB = pkgC * 2\n\nvar pkgF = f\n\nfunc f() { var x = pkgD }\n\nfunc main() {}\n",
+				"c.go":      "package main\n\nvar pkgC, pkgD = 1, 2\n",
+				"c_test.go": "package main\n\nvar pkgA = 0\n",
+				"d.go":      "// +build ignore\n\npackage main\n\nvar pkgA = 0\n",
+			},
+			map[string]object.Object{
+				"pkgA": &object.IntegerLiteral{
+					Value: 3,
+				},
+			},
+			false,
+		},
+		{
+			"initialization cycle",
+			map[string]string{
+				"a.go": "package main\n\nvar pkgA = pkgB\n\nvar pkgB = pkgA\n\nfunc main() {}\n",
+			},
+			nil,
+			true,
+		},
+		{
+			"self initialization cycle",
+			map[string]string{
+				"a.go": "package main\n\nvar pkgA = pkgA + 1\n\nfunc main() {}\n",
+			},
+			nil,
+			true,
+		},
+		{
+			"self initialization cycle through function",
+			map[string]string{
+				"a.go": "package main\n\nvar pkgA = f\n\nfunc f() {\n\tprintln(pkgA)\n}\n\nfunc main() {}\n",
+			},
+			nil,
+			true,
+		},
+		{
+			"not main package",
+			map[string]string{
+				"a.go": "package pkg\n",
+			},
+			nil,
+			true,
+		},
+		{
+			"module packages",
+			map[string]string{
+				"go.mod":                 "module example.com/m\n\nreplace example.com/dep => ./third_party/dep\n",
+				"main.go":                "package main\n\nimport (\n\t\"example.com/dep\"\n\t\"example.com/m/lib\"\n)\n\nvar pkgA = lib.Exported + dep.Value\n\nfunc main() {}\n",
+				"lib/lib.go":             "package lib\n\nimport \"example.com/dep\"\n\nvar Exported = unexported * dep.Value\n\nvar unexported = 2\n",
+				"third_party/dep/dep.go": "package dep\n\nvar Value = 3\n",
+			},
+			map[string]object.Object{
+				"pkgA": &object.IntegerLiteral{
+					Value: 9,
+				},
+			},
+			false,
+		},
+		{
+			"unexported name",
+			map[string]string{
+				"go.mod":     "module example.com/m\n",
+				"main.go":    "package main\n\nimport \"example.com/m/lib\"\n\nvar pkgA = lib.unexported\n\nfunc main() {}\n",
+				"lib/lib.go": "package lib\n\nvar unexported = 2\n",
+			},
+			nil,
+			true,
+		},
+		{
+			"import cycle",
+			map[string]string{
+				"go.mod":  "module example.com/m\n",
+				"main.go": "package main\n\nimport \"example.com/m/a\"\n\nvar pkgA = a.A\n\nfunc main() {}\n",
+				"a/a.go":  "package a\n\nimport \"example.com/m/b\"\n\nvar A = b.B\n",
+				"b/b.go":  "package b\n\nimport \"example.com/m/a\"\n\nvar B = a.A\n",
+			},
+			nil,
+			true,
+		},
+		{
+			"missing package",
+			map[string]string{
+				"go.mod":  "module example.com/m\n",
+				"main.go": "package main\n\nimport \"example.com/missing\"\n\nfunc main() {}\n",
+			},
+			nil,
+			true,
+		},
+		{
+			"unsupported standard package",
+			map[string]string{
+				"main.go": "package main\n\nimport \"strings\"\n\nfunc main() {}\n",
+			},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "warabi")
+			if err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+			defer os.RemoveAll(dir)
+			for name, src := range test.files {
+				filename := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+					t.Fatalf("unexpected error: %s\n", err)
+				}
+				if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+					t.Fatalf("unexpected error: %s\n", err)
+				}
+			}
+
+			interpreter := NewInterpreter(TreeWalk)
+			err = interpreter.RunPackage(context.Background(), dir)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("unexpected error: got %v, expected error: %t\n", err, test.wantErr)
+			}
+			for name, want := range test.wants {
+				got, _ := interpreter.Env().Get(name)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("unexpected object of %s: got %#v, expected %#v\n", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInitializationCycle(t *testing.T) {
+	tests := []string{
+		"var a = a",
+		"var a = a + 1",
+		"var a, b = b, a",
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			_, err := NewInterpreter(TreeWalk).Evaluate(src)
+			if err == nil || !strings.Contains(err.Error(), "initialization cycle") {
+				t.Errorf("unexpected error: got %v, expected initialization cycle\n", err)
+			}
+		})
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{
+			"calls",
+			`package main
+
+import "fmt"
+
+func greet(name string, n int) {
+	fmt.Println("hello,", name, n+1)
+}
+
+func main() {
+	greet("go", 1)
+	fmt.Printf("%d %t\n", 2*3, 1 == 1)
+}
+`,
+			"hello, go 2\n6 true\n",
+			false,
+		},
+		{
+			"if statements",
+			`package main
+
+import "fmt"
+
+func classify(n int) {
+	if n < 0 {
+		fmt.Println("negative")
+	} else if m := n % 2; m == 0 {
+		fmt.Println("even")
+	} else {
+		fmt.Println("odd")
+	}
+}
+
+func main() {
+	classify(-1)
+	classify(2)
+	classify(3)
+}
+`,
+			"negative\neven\nodd\n",
+			false,
+		},
+		{
+			"function literals",
+			`package main
+
+import "fmt"
+
+func apply(f func(int), n int) {
+	var m = n * 10
+	f(m)
+}
+
+func main() {
+	var offset = 1
+	apply(func(n int) {
+		{
+			var offset = 2
+			fmt.Println(n + offset)
+		}
+		fmt.Println(n + offset)
+	}, 4)
+}
+`,
+			"42\n41\n",
+			false,
+		},
+		{
+			"not enough arguments",
+			`package main
+
+func f(n int) {}
+
+func main() {
+	f()
+}
+`,
+			"",
+			true,
+		},
+		{
+			"non-boolean condition",
+			`package main
+
+func main() {
+	if 1 {
+	}
+}
+`,
+			"",
+			true,
+		},
+		{
+			"unbounded recursion",
+			`package main
+
+func main() {
+	main()
+}
+`,
+			"",
+			true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+
+	backends := []Backend{TreeWalk, VM, Closure}
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					var w strings.Builder
+					interpreter := NewInterpreter(backend)
+					interpreter.SetOutput(&w)
+					err := interpreter.RunFile(context.Background(), filename, []byte(test.source))
+					if (err != nil) != test.wantErr {
+						t.Fatalf("unexpected error: got %v, expected error: %t\n", err, test.wantErr)
+					}
+					if got := w.String(); got != test.want {
+						t.Errorf("unexpected output: got %q, expected %q\n", got, test.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestEvaluateLimits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		source  string
+		limits  Limits
+		wantErr error
+	}{
+		{
+			"steps",
+			context.Background(),
+			"var a = 1 + 2 + 3",
+			Limits{
+				MaxSteps: 3,
+			},
+			&StepLimitError{},
+		},
+		{
+			"allocation",
+			context.Background(),
+			`var a = "hello, " + "world"`,
+			Limits{
+				MaxAllocation: 5,
+			},
+			&AllocationLimitError{},
+		},
+		{
+			"packages",
+			context.Background(),
+			`import "os"`,
+			Limits{
+				AllowedPackages: []string{"fmt"},
+			},
+			&PackageNotAllowedError{},
+		},
+		{
+			"context",
+			canceled,
+			"var a = 1",
+			Limits{},
+			&ContextError{},
+		},
+		{
+			"within limits",
+			context.Background(),
+			`import "fmt"; var a = "a" + "b"`,
+			Limits{
+				MaxSteps:        10,
+				MaxDepth:        2,
+				MaxAllocation:   2,
+				AllowedPackages: []string{"fmt"},
+			},
+			nil,
+		},
+	}
+
+	backends := []Backend{TreeWalk, VM, Closure}
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					interpreter := NewInterpreter(backend)
+					interpreter.SetLimits(test.limits)
+					_, err := interpreter.EvaluateContext(test.ctx, test.source)
+					if reflect.TypeOf(err) != reflect.TypeOf(test.wantErr) {
+						t.Errorf("unexpected error: got %v, expected %T\n", err, test.wantErr)
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestDepthLimit checks that the depth is of the calls in progress rather
+// than of the nesting of expressions, whichever backend evaluates them.
+func TestDepthLimit(t *testing.T) {
+	for _, backend := range []Backend{TreeWalk, VM, Closure} {
+		t.Run(backend.String(), func(t *testing.T) {
+			interpreter := NewInterpreter(backend)
+			interpreter.SetLimits(Limits{
+				MaxDepth: 3,
+			})
+			if _, err := interpreter.Evaluate("func f(n int) { if 0 < n { f(n - 1) } }; var a = ((((((1))))))"); err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+			if _, err := interpreter.EvaluateExpression(context.Background(), "f(2)"); err != nil {
+				t.Errorf("unexpected error: %s\n", err)
+			}
+			_, err := interpreter.EvaluateExpression(context.Background(), "f(3)")
+			if _, ok := err.(*DepthLimitError); !ok {
+				t.Errorf("unexpected error: got %v, expected %T\n", err, &DepthLimitError{})
+			}
+		})
 	}
+}
+
+func TestPanicAndExit(t *testing.T) {
+	for _, backend := range []Backend{TreeWalk, VM, Closure} {
+		t.Run(backend.String(), func(t *testing.T) {
+			interpreter := NewInterpreter(backend)
+			if _, err := interpreter.Evaluate(`import "os"; func f(n int) { panic(n) }; func g() { os.Exit(3) }`); err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
 
+			_, err := interpreter.EvaluateExpression(context.Background(), "f(7)")
+			panicErr, ok := err.(*PanicError)
+			if !ok || panicErr.Error() != "panic: 7" || len(panicErr.Frames) != 2 || panicErr.Frames[0].Function != "f" {
+				t.Errorf("unexpected error: got %#v, expected the panic of 7 in f\n", err)
+			}
+			_, err = interpreter.EvaluateExpression(context.Background(), "g()")
+			if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != 3 {
+				t.Errorf("unexpected error: got %v, expected the exit with 3\n", err)
+			}
+		})
+	}
+}
+
+func TestEvaluateSnippet(t *testing.T) {
+	interpreter := NewInterpreter(TreeWalk)
+	tests := []struct {
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{"var a, b = 1, 2", "1, 2", false},
+		{"a + b", "3", false},
+		{"func f() {}", "", false},
+		{"f()", "", false},
+		{"var c = 3 / 0", "", true},
+		{"undefined", "", true},
+	}
 	for _, test := range tests {
-		t.Run(test.source, func(t *testing.T) {
-			gots := Evaluate(test.source)
-			if len(gots) != len(test.wants) {
-				t.Fatalf("unexpected object length: got %d, expected %d\n", len(gots), len(test.wants))
+		got, err := interpreter.EvaluateSnippet(context.Background(), test.src)
+		if (err != nil) != test.wantErr {
+			t.Errorf("unexpected error of %q: got %v, expected error: %t\n", test.src, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("unexpected result of %q: got %q, expected %q\n", test.src, got, test.want)
+		}
+	}
+}
+
+func TestInterpreterFileSet(t *testing.T) {
+	interpreter := NewInterpreter(TreeWalk)
+	if _, err := interpreter.Evaluate("func f() {\n\tvar a = 1 / 0\n}"); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	base := interpreter.fileSet.Base()
+
+	forked := interpreter.Fork()
+	if _, err := forked.Evaluate("var a = 1"); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if got := interpreter.fileSet.Base(); got != base {
+		t.Errorf("unexpected base of the file set: got %d, expected %d\n", got, base)
+	}
+
+	err := interpreter.Call(context.Background(), "f")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("unexpected error: got %v, expected %T\n", err, runtimeErr)
+	}
+	if got, want := runtimeErr.Pos.String(), "main.go:3:12"; got != want {
+		t.Errorf("unexpected position: got %s, expected %s\n", got, want)
+	}
+}
+
+func TestVMStackOverflow(t *testing.T) {
+	src := "var a = " + strings.Repeat("1 + (", stackSize) + "1" + strings.Repeat(")", stackSize)
+	interpreter := NewInterpreter(VM)
+	_, err := interpreter.Evaluate(src)
+	if _, ok := err.(*ValueStackOverflowError); !ok {
+		t.Errorf("unexpected error: got %v, expected %T\n", err, &ValueStackOverflowError{})
+	}
+}
+
+// TestVMWideOperands checks the programs with more names and arguments
+// than a narrow operand could index.
+func TestVMWideOperands(t *testing.T) {
+	globals := make([]string, 70000)
+	for i := range globals {
+		globals[i] = fmt.Sprintf("var v%d = %d", i, i)
+	}
+	params, args := make([]string, 300), make([]string, 300)
+	for i := range params {
+		params[i], args[i] = fmt.Sprintf("p%d int", i), strconv.Itoa(i)
+	}
+	src := strings.Join(globals, "\n") + "\nfunc f(" + strings.Join(params, ", ") + ") { fmt.Print(p299) }"
+
+	var w strings.Builder
+	interpreter := NewInterpreter(VM)
+	interpreter.SetOutput(&w)
+	if _, err := interpreter.Evaluate(`import "fmt"` + "\n" + src); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if obj, err := interpreter.EvaluateExpression(context.Background(), "v69999"); err != nil || obj.String() != "69999" {
+		t.Errorf("unexpected result: got %v, %v, expected 69999\n", obj, err)
+	}
+	if _, err := interpreter.EvaluateExpression(context.Background(), "f("+strings.Join(args, ", ")+")"); err != nil {
+		t.Errorf("unexpected error: %s\n", err)
+	}
+	if got := w.String(); got != "299" {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, "299")
+	}
+}
+
+// TestFunctionCache checks that a function literal evaluated over and over
+// is compiled once, even across evaluations.
+func TestFunctionCache(t *testing.T) {
+	src := "func apply(f func()) { f() }; func loop(n int) { if 0 < n { apply(func() {}); loop(n - 1) } }"
+	for _, backend := range []Backend{VM, Closure} {
+		t.Run(backend.String(), func(t *testing.T) {
+			interpreter := NewInterpreter(backend)
+			if _, err := interpreter.Evaluate(src); err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := interpreter.EvaluateExpression(context.Background(), "loop(10)"); err != nil {
+					t.Fatalf("unexpected error: %s\n", err)
+				}
 			}
-			for i := 0; i < len(test.wants); i++ {
-				if !reflect.DeepEqual(gots[i], test.wants[i]) {
-					t.Errorf("unexpected object: got %#v, expected %#v\n", gots[i], test.wants[i])
+			cache := interpreter.functions
+			if got := len(cache.bytecodes) + len(cache.closures); got != 3 {
+				t.Errorf("unexpected compiled functions: got %d, expected 3\n", got)
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	arithmetics := make([]string, 500)
+	for i := range arithmetics {
+		arithmetics[i] = fmt.Sprintf("(%d * 2 - a) %% 7", i)
+	}
+	strs := make([]string, 500)
+	for i := range strs {
+		strs[i] = fmt.Sprintf("s%d", i%10)
+	}
+	sources := []struct {
+		name   string
+		source string
+	}{
+		{
+			"arithmetic",
+			"var a = 3\nvar b = " + strings.Join(arithmetics, " + "),
+		},
+		{
+			"string building",
+			`var s0, s1, s2, s3, s4, s5, s6, s7, s8, s9 = "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"` +
+				"\nvar s = " + strings.Join(strs, " + "),
+		},
+	}
+
+	env := object.NewEnclosedEnvironment(object.Universe)
+	for _, source := range sources {
+		file, err := parse(token.NewFileSet(), source.source)
+		if err != nil {
+			b.Fatalf("unexpected error: %s\n", err)
+		}
+		b.Run(source.name, func(b *testing.B) {
+			b.Run(TreeWalk.String(), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					walker := &treeWalker{
+						env: env,
+					}
+					walker.evaluateDeclarations(file.Decls)
+				}
+			})
+			b.Run(VM.String(), func(b *testing.B) {
+				bytecode := compile(file.Decls)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					newVM(bytecode, env, nil, newFunctionCache()).run()
+				}
+			})
+			b.Run(Closure.String(), func(b *testing.B) {
+				program := compileClosures(file.Decls)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					program.run(env, nil, newFunctionCache())
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCall benchmarks calls, counting loops down by recursion as
+// the language has no loop statements.
+func BenchmarkCall(b *testing.B) {
+	sources := []struct {
+		name   string
+		source string
+	}{
+		{
+			"fib",
+			`
+			func fib(n int) {
+				if 1 < n {
+					fib(n - 1)
+					fib(n - 2)
+				}
+			}
+			func main() { fib(25) }`,
+		},
+		{
+			"nested loops",
+			`
+			func inner(j int) {
+				if 0 < j {
+					inner(j - 1)
 				}
 			}
+			func outer(i int) {
+				if 0 < i {
+					inner(100)
+					outer(i - 1)
+				}
+			}
+			func main() { outer(100) }`,
+		},
+	}
+
+	backends := []Backend{TreeWalk, VM, Closure}
+	for _, source := range sources {
+		b.Run(source.name, func(b *testing.B) {
+			for _, backend := range backends {
+				b.Run(backend.String(), func(b *testing.B) {
+					interpreter := NewInterpreter(backend)
+					if _, err := interpreter.Evaluate(source.source); err != nil {
+						b.Fatalf("unexpected error: %s\n", err)
+					}
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if err := interpreter.Call(context.Background(), "main"); err != nil {
+							b.Fatalf("unexpected error: %s\n", err)
+						}
+					}
+				})
+			}
 		})
 	}
 }
@@ -298,7 +1124,10 @@ func TestEvaluateFunctionLiteral(t *testing.T) {
 		},
 	}
 
-	gots := Evaluate(source)
+	gots, err := Evaluate(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
 	if len(gots) != 1 {
 		t.Fatalf("unexpected object length: got %d, expected 1\n", len(gots))
 	}
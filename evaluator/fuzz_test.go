@@ -0,0 +1,299 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// FuzzEvaluateExpression evaluates expressions generated from the input
+// and compares the results with the constants go/types folds them into.
+func FuzzEvaluateExpression(f *testing.F) {
+	seeds := [][]byte{
+		{},
+		{1, 0, 1, 2, 3},
+		{1, 3, 0, 4, 0, 1},
+		{1, 4, 2, 0, 5, 0, 9},
+		{2, 1, 0, 3},
+		{1, 11, 1, 12, 0, 4, 0, 4},
+		{1, 0, 0, 2, 0, 5},
+		{3, 1, 5, 0, 3, 0, 0},
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		src := (&expressionGenerator{data: data}).source()
+		want, err := foldConstant(src)
+		if err == errNotComparable {
+			return
+		}
+
+		for _, backend := range []Backend{TreeWalk, VM, Closure} {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			got, gotErr := NewInterpreter(backend).EvaluateExpression(ctx, src)
+			cancel()
+			switch {
+			case err != nil && gotErr == nil:
+				// warabi checks the operands only when it evaluates them, and
+				// divides floats by zero as Go does at run time.
+				if hasLogicalOperation(src) || isFloatDivisionByZero(src, err) {
+					continue
+				}
+				t.Errorf("%s: %s: unexpected result %s, expected error: %s\n", backend, src, got, err)
+			case err == nil && gotErr != nil:
+				t.Errorf("%s: %s: unexpected error: %s, expected %s\n", backend, src, gotErr, want.value)
+			case err == nil && !equalConstant(got, want):
+				t.Errorf("%s: %s: unexpected result: got %s (%s), expected %s (%s)\n", backend, src, got, got.Kind(), want.value, want.typ)
+			}
+		}
+	})
+}
+
+// FuzzEvaluate evaluates the input as source and checks that every backend
+// evaluates it to the same result without panicking.
+func FuzzEvaluate(f *testing.F) {
+	seeds := []string{
+		"var a = 1 + 2",
+		"var a = 1 / 0",
+		`var a, b = "a" + "b", 'a' + 1`,
+		"var a = b; var b = 1.5 * 2",
+		"var a = true && !false || 1 < 2",
+		"var a int; var b bool; var c float64",
+		"func f(n int) { f(n) }; var a = 1",
+		"func f() {}; var a = f()",
+		"var a = -'a' + ^1",
+		`import "fmt"; var a = fmt.Sprint(1, "a")`,
+		"var a = x.y",
+		"var a = []int{}",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		backends := []Backend{TreeWalk, VM, Closure}
+		results := make([]string, len(backends))
+		errs := make([]error, len(backends))
+		for i, backend := range backends {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			interpreter := NewInterpreter(backend)
+			interpreter.SetLimits(Limits{
+				MaxSteps: 10000,
+				MaxDepth: 100,
+			})
+			objs, err := interpreter.EvaluateContext(ctx, src)
+			cancel()
+			if isLimitError(err) {
+				// The backends count steps in their own ways.
+				return
+			}
+			strs := make([]string, len(objs))
+			for j, obj := range objs {
+				if obj == nil {
+					t.Fatalf("%s: %q: unexpected nil result\n", backend, src)
+				}
+				strs[j] = obj.String()
+			}
+			results[i], errs[i] = strings.Join(strs, ", "), err
+		}
+
+		for i, backend := range backends[1:] {
+			if (errs[i+1] != nil) != (errs[0] != nil) {
+				t.Errorf("%s: %q: unexpected error: got %v, expected %v\n", backend, src, errs[i+1], errs[0])
+			}
+			if results[i+1] != results[0] {
+				t.Errorf("%s: %q: unexpected results: got %q, expected %q\n", backend, src, results[i+1], results[0])
+			}
+		}
+	})
+}
+
+func isLimitError(err error) bool {
+	switch err.(type) {
+	case *StepLimitError, *DepthLimitError, *AllocationLimitError, *StackOverflowError, *ValueStackOverflowError, *ContextError:
+		return true
+	default:
+		return false
+	}
+}
+
+// expressionGenerator generates an expression, choosing how to by
+// consuming data.
+type expressionGenerator struct {
+	data []byte
+}
+
+const maxGeneratedDepth = 5
+
+var (
+	generatedLiterals = []ast.Expr{
+		&ast.BasicLit{Kind: token.INT, Value: "0"},
+		&ast.BasicLit{Kind: token.INT, Value: "1"},
+		&ast.BasicLit{Kind: token.INT, Value: "7"},
+		&ast.BasicLit{Kind: token.INT, Value: "42"},
+		&ast.BasicLit{Kind: token.INT, Value: "0x7fffffff"},
+		&ast.BasicLit{Kind: token.FLOAT, Value: "0.5"},
+		&ast.BasicLit{Kind: token.FLOAT, Value: "2.0"},
+		&ast.BasicLit{Kind: token.CHAR, Value: "'a'"},
+		&ast.BasicLit{Kind: token.CHAR, Value: `'\x00'`},
+		&ast.BasicLit{Kind: token.STRING, Value: `""`},
+		&ast.BasicLit{Kind: token.STRING, Value: `"go"`},
+		ast.NewIdent("true"),
+		ast.NewIdent("false"),
+	}
+	generatedBinaryOperators = []token.Token{
+		token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+		token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+		token.LAND, token.LOR,
+	}
+	generatedUnaryOperators = []token.Token{
+		token.ADD, token.SUB, token.XOR, token.NOT,
+	}
+)
+
+func (g *expressionGenerator) source() string {
+	var b bytes.Buffer
+	printer.Fprint(&b, token.NewFileSet(), g.generate(0))
+	return b.String()
+}
+
+func (g *expressionGenerator) generate(depth int) ast.Expr {
+	choice := 0
+	if depth < maxGeneratedDepth {
+		choice = g.choose(4)
+	}
+
+	switch choice {
+	case 1:
+		return &ast.BinaryExpr{
+			X:  g.generate(depth + 1),
+			Op: generatedBinaryOperators[g.choose(len(generatedBinaryOperators))],
+			Y:  g.generate(depth + 1),
+		}
+	case 2:
+		return &ast.UnaryExpr{
+			Op: generatedUnaryOperators[g.choose(len(generatedUnaryOperators))],
+			X:  g.generate(depth + 1),
+		}
+	case 3:
+		return &ast.ParenExpr{
+			X: g.generate(depth + 1),
+		}
+	default:
+		return generatedLiterals[g.choose(len(generatedLiterals))]
+	}
+}
+
+func (g *expressionGenerator) choose(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+
+	return int(b) % n
+}
+
+type foldedConstant struct {
+	value constant.Value
+	typ   types.Type
+}
+
+var errNotComparable = errors.New("not comparable")
+
+// foldConstant folds src into a constant as the type checker does. It
+// returns errNotComparable if a value in src does not fit into the type
+// warabi evaluates it in, or if it is a float, which warabi evaluates in
+// float32 instead of exactly.
+func foldConstant(src string) (foldedConstant, error) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "fuzz.go", "package p\n\nconst c = "+src+"\n", 0)
+	if err != nil {
+		return foldedConstant{}, errNotComparable
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+	}
+	var firstErr error
+	config := types.Config{
+		Error: func(err error) {
+			if firstErr == nil {
+				firstErr = err
+			}
+		},
+	}
+	config.Check("p", fileSet, []*ast.File{file}, info)
+	if firstErr != nil {
+		return foldedConstant{}, firstErr
+	}
+
+	for _, tv := range info.Types {
+		if tv.Value == nil || !fitsIn(tv) {
+			return foldedConstant{}, errNotComparable
+		}
+	}
+	value := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Values[0]
+	tv := info.Types[value]
+
+	return foldedConstant{
+		value: tv.Value,
+		typ:   tv.Type,
+	}, nil
+}
+
+func fitsIn(tv types.TypeAndValue) bool {
+	switch tv.Type {
+	case types.Typ[types.UntypedInt]:
+		_, exact := constant.Int64Val(tv.Value)
+		return exact
+	case types.Typ[types.UntypedRune]:
+		value, exact := constant.Int64Val(tv.Value)
+		return exact && math.MinInt32 <= value && value <= math.MaxInt32
+	case types.Typ[types.UntypedFloat]:
+		return false
+	default:
+		return true
+	}
+}
+
+func equalConstant(obj object.Object, want foldedConstant) bool {
+	switch obj := obj.(type) {
+	case *object.IntegerLiteral:
+		value, _ := constant.Int64Val(want.value)
+		return want.typ == types.Typ[types.UntypedInt] && int64(obj.Value) == value
+	case *object.CharacterLiteral:
+		value, _ := constant.Int64Val(want.value)
+		return want.typ == types.Typ[types.UntypedRune] && int64(obj.Value) == value
+	case *object.StringLiteral:
+		return want.typ == types.Typ[types.UntypedString] && obj.Value == constant.StringVal(want.value)
+	case *object.BooleanLiteral:
+		return want.typ == types.Typ[types.UntypedBool] && (obj == object.True) == constant.BoolVal(want.value)
+	default:
+		return false
+	}
+}
+
+func hasLogicalOperation(src string) bool {
+	return strings.Contains(src, "&&") || strings.Contains(src, "||")
+}
+
+// isFloatDivisionByZero reports whether err may be of a division of a float
+// by zero, assuming that the floats generated have decimal points.
+func isFloatDivisionByZero(src string, err error) bool {
+	return strings.Contains(err.Error(), "division by zero") && strings.Contains(src, ".")
+}
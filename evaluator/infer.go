@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// InferKind infers the kind of the expression src from the literals, the
+// bindings in the environment and the signatures of the functions called
+// without evaluating it, so nothing it calls is run. It returns Unknown
+// for a call of a function without results.
+func (i Interpreter) InferKind(src string) (kind object.Kind, err error) {
+	expr, err := parser.ParseExprFrom(i.fileSet, "main.go", src, 0)
+	if err != nil {
+		return object.Unknown, err
+	}
+
+	defer recoverBailout(&err, i.fileSet)
+	return inferKind(i.env, expr), nil
+}
+
+func inferKind(env *object.Environment, expr ast.Expr) object.Kind {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return inferKind(env, expr.X)
+	case *ast.BasicLit:
+		return inferBasicLiteralKind(expr)
+	case *ast.Ident, *ast.SelectorExpr:
+		obj := resolve(env, expr)
+		if obj == nil {
+			return object.Unknown
+		}
+		return obj.Kind()
+	case *ast.FuncLit:
+		return object.Function
+	case *ast.UnaryExpr:
+		return inferUnaryOperationKind(env, expr)
+	case *ast.BinaryExpr:
+		return inferBinaryOperationKind(env, expr)
+	case *ast.CallExpr:
+		return inferCallKind(env, expr)
+	default:
+		bailUnsupportedExpression(expr)
+		return object.Unknown
+	}
+}
+
+// inferValueKind infers the kind of expr whose value is used, which
+// exists unless expr is a call of a function without results.
+func inferValueKind(env *object.Environment, expr ast.Expr) object.Kind {
+	kind := inferKind(env, expr)
+	if kind == object.Unknown {
+		bail(errorAt(expr.Pos(), "%s (no value) used as value", types.ExprString(expr)))
+	}
+
+	return kind
+}
+
+func inferBasicLiteralKind(expr *ast.BasicLit) object.Kind {
+	switch expr.Kind {
+	case token.INT:
+		return object.Integer
+	case token.STRING:
+		return object.String
+	case token.CHAR:
+		return object.Character
+	case token.FLOAT:
+		return object.FloatingPoint
+	default:
+		bailUnsupportedExpression(expr)
+		return object.Unknown
+	}
+}
+
+// resolve looks up the object which the identifier or the selector of
+// an identifier refers to, which has no side effect.
+func resolve(env *object.Environment, expr ast.Expr) object.Object {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return lookUp(env, expr)
+	case *ast.SelectorExpr:
+		return selectMember(resolve(env, expr.X), expr)
+	case *ast.ParenExpr:
+		return resolve(env, expr.X)
+	default:
+		bail(errorAt(expr.Pos(), "cannot infer the type of %s without evaluating it", types.ExprString(expr)))
+		return nil
+	}
+}
+
+func inferUnaryOperationKind(env *object.Environment, expr *ast.UnaryExpr) object.Kind {
+	kind := inferValueKind(env, expr.X)
+	switch {
+	case expr.Op == token.NOT && kind == object.Boolean:
+		return kind
+	case expr.Op == token.ADD || expr.Op == token.SUB:
+		if _, ok := numericRanks[kind]; ok {
+			return kind
+		}
+	case expr.Op == token.XOR && (kind == object.Integer || kind == object.Character):
+		return kind
+	}
+
+	bail(errorAt(
+		expr.OpPos, "invalid operation: operator %s not defined on %s (value of type %s)", expr.Op, types.ExprString(expr.X), kind,
+	))
+	return object.Unknown
+}
+
+// inferBinaryOperationKind infers the kind as operateBinary promotes the
+// operands, leaving which operators the kinds define to the evaluation.
+func inferBinaryOperationKind(env *object.Environment, expr *ast.BinaryExpr) object.Kind {
+	leftKind, rightKind := inferValueKind(env, expr.X), inferValueKind(env, expr.Y)
+	leftRank, leftOK := numericRanks[leftKind]
+	rightRank, rightOK := numericRanks[rightKind]
+	if leftOK && rightOK && leftRank < rightRank {
+		leftKind = rightKind
+	} else if leftOK && rightOK {
+		rightKind = leftKind
+	}
+	if leftKind != rightKind {
+		bail(errorAt(
+			expr.OpPos, "invalid operation: %s (mismatched types %s and %s)", types.ExprString(expr), leftKind, rightKind,
+		))
+	}
+
+	switch expr.Op {
+	case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ, token.LAND, token.LOR:
+		return object.Boolean
+	default:
+		return leftKind
+	}
+}
+
+// inferCallKind infers the kind of the result of the function called
+// from its signature.
+func inferCallKind(env *object.Environment, expr *ast.CallExpr) object.Kind {
+	var fn object.Object
+	if lit, ok := expr.Fun.(*ast.FuncLit); ok {
+		fn = newFunctionLiteral(lit.Type, lit.Body, env)
+	} else {
+		fn = resolve(env, expr.Fun)
+	}
+
+	switch fn := fn.(type) {
+	case *object.Builtin:
+		return fn.Result
+	case *object.FunctionLiteral:
+		var results []ast.Expr
+		for _, field := range fn.Results {
+			for range field.Names {
+				results = append(results, field.Type)
+			}
+			if len(field.Names) == 0 {
+				results = append(results, field.Type)
+			}
+		}
+		switch len(results) {
+		case 0:
+			return object.Unknown
+		case 1:
+			return kindOfType(results[0])
+		default:
+			bail(errorAt(expr.Pos(), "multiple-value %s in single-value context", types.ExprString(expr)))
+			return object.Unknown
+		}
+	default:
+		bail(errorAt(expr.Lparen, "cannot call non-function %s", types.ExprString(expr.Fun)))
+		return object.Unknown
+	}
+}
+
+// kindOfType returns the kind of the values of the type, which is the
+// kind of its zero value.
+func kindOfType(typ ast.Expr) object.Kind {
+	if _, ok := typ.(*ast.FuncType); ok {
+		return object.Function
+	}
+	ident, ok := typ.(*ast.Ident)
+	if !ok {
+		bail(errorAt(typ.Pos(), "unsupported type: %s", types.ExprString(typ)))
+	}
+	zero, ok := zeroValues[ident.Name]
+	if !ok {
+		bail(errorAt(ident.Pos(), "unsupported type: %s", ident.Name))
+	}
+
+	return inferKind(object.Universe, zero)
+}
@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tomocy/warabi/object"
+)
+
+func TestInferKind(t *testing.T) {
+	interpreter := NewInterpreter(TreeWalk)
+	var w bytes.Buffer
+	interpreter.SetOutput(&w)
+	src := `import "fmt"
+
+var a, s = 1, "a"
+
+func f() { fmt.Println("SIDE EFFECT") }
+
+func g(n int) float64 { f() }
+
+func h() (a, b int) {}
+`
+	if _, err := interpreter.Evaluate(src); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	tests := []struct {
+		src     string
+		want    object.Kind
+		wantErr string
+	}{
+		{src: "1 + 2", want: object.Integer},
+		{src: "a + 2.0", want: object.FloatingPoint},
+		{src: "'a' + 1", want: object.Character},
+		{src: "s + s", want: object.String},
+		{src: "a < 2 && !true", want: object.Boolean},
+		{src: "-a", want: object.Integer},
+		{src: "f", want: object.Function},
+		{src: "f()", want: object.Unknown},
+		{src: "(g(a))", want: object.FloatingPoint},
+		{src: `fmt.Sprint(f())`, want: object.String},
+		{src: "fmt.Println(1)", want: object.Unknown},
+		{src: "func() bool {}()", want: object.Boolean},
+		{src: "fmt", want: object.Package},
+		{src: "b", wantErr: "main.go:1:1: undefined: b"},
+		{src: `s + 1`, wantErr: "main.go:1:3: invalid operation: s + 1 (mismatched types string and int)"},
+		{src: "!a", wantErr: "main.go:1:1: invalid operation: operator ! not defined on a (value of type int)"},
+		{src: "f() + 1", wantErr: "main.go:1:1: f() (no value) used as value"},
+		{src: "h()", wantErr: "main.go:1:1: multiple-value h() in single-value context"},
+		{src: "a()", wantErr: "main.go:1:2: cannot call non-function a"},
+		{src: "fmt.x", wantErr: "main.go:1:5: cannot refer to unexported name fmt.x"},
+	}
+	for _, test := range tests {
+		got, err := interpreter.InferKind(test.src)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("unexpected error of %s: got %v, expected %s\n", test.src, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error of %s: %s\n", test.src, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("unexpected kind of %s: got %s, expected %s\n", test.src, got, test.want)
+		}
+	}
+	if w.Len() != 0 {
+		t.Errorf("unexpected output: %q\n", w.String())
+	}
+}
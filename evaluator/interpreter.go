@@ -0,0 +1,348 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomocy/warabi/object"
+)
+
+type Backend int
+
+const (
+	TreeWalk Backend = iota
+	VM
+	Closure
+)
+
+func (b Backend) String() string {
+	switch b {
+	case TreeWalk:
+		return "tree-walk"
+	case VM:
+		return "vm"
+	case Closure:
+		return "closure"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseBackend(name string) (Backend, error) {
+	for _, backend := range []Backend{TreeWalk, VM, Closure} {
+		if backend.String() == name {
+			return backend, nil
+		}
+	}
+
+	return TreeWalk, fmt.Errorf("unknown backend: %s", name)
+}
+
+type Interpreter struct {
+	backend   Backend
+	limits    Limits
+	output    io.Writer
+	args      []string
+	observers []Observer
+	env       *object.Environment
+	// fileSet has the files the interpreter has parsed, which are as many
+	// as the evaluations, so it is not shared with other interpreters,
+	// and neither is functions, which has the functions in the files.
+	fileSet   *token.FileSet
+	functions *functionCache
+}
+
+// NewInterpreter returns an interpreter with an empty environment and
+// file set of its own, which the interpreters copied from it share.
+func NewInterpreter(backend Backend) *Interpreter {
+	return &Interpreter{
+		backend:   backend,
+		env:       object.NewEnclosedEnvironment(object.Universe),
+		fileSet:   token.NewFileSet(),
+		functions: newFunctionCache(),
+	}
+}
+
+// Fork returns an interpreter configured as i is but with an empty
+// environment and file set of its own.
+func (i Interpreter) Fork() *Interpreter {
+	i.env = object.NewEnclosedEnvironment(object.Universe)
+	i.fileSet = token.NewFileSet()
+	i.functions = newFunctionCache()
+	return &i
+}
+
+// Env returns the environment where the interpreter evaluates
+// the top-level declarations.
+func (i Interpreter) Env() *object.Environment {
+	return i.env
+}
+
+func (i *Interpreter) SetLimits(limits Limits) {
+	i.limits = limits
+}
+
+// SetOutput sets the destination of what programs print,
+// which is os.Stdout by default.
+func (i *Interpreter) SetOutput(w io.Writer) {
+	i.output = w
+}
+
+// SetArgs sets os.Args of programs, the first of which is the name of
+// the program.
+func (i *Interpreter) SetArgs(args []string) {
+	i.args = args
+}
+
+func (i Interpreter) stdout() io.Writer {
+	if i.output == nil {
+		return os.Stdout
+	}
+
+	return i.output
+}
+
+func (i Interpreter) newLimiter(ctx context.Context) *limiter {
+	limiter := newLimiter(ctx, i.fileSet, i.limits)
+	limiter.observers = i.observers
+	return limiter
+}
+
+// evaluationBackend is the backend i evaluates on, which is tree-walk
+// if i is observed.
+func (i Interpreter) evaluationBackend() Backend {
+	if len(i.observers) != 0 {
+		return TreeWalk
+	}
+
+	return i.backend
+}
+
+func (i Interpreter) Evaluate(src string) ([]object.Object, error) {
+	return i.EvaluateContext(context.Background(), src)
+}
+
+func (i Interpreter) EvaluateContext(ctx context.Context, src string) ([]object.Object, error) {
+	file, err := parse(i.fileSet, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.evaluateFile(ctx, file)
+}
+
+func (i Interpreter) EvaluateFile(ctx context.Context, filename string, src []byte) ([]object.Object, error) {
+	file, err := parser.ParseFile(i.fileSet, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.evaluateFile(ctx, file)
+}
+
+// evaluateFile evaluates a snippet, whose imports are bound in
+// the environment for the later ones as well.
+func (i Interpreter) evaluateFile(ctx context.Context, file *ast.File) ([]object.Object, error) {
+	if len(file.Imports) != 0 {
+		module, err := findModule(".")
+		if err != nil {
+			return nil, err
+		}
+		if err := newPackageLoader(ctx, i, module).importPackages(i.env, []*ast.File{file}); err != nil {
+			return nil, err
+		}
+	}
+
+	return i.evaluateFiles(ctx, i.env, []*ast.File{file})
+}
+
+func (i Interpreter) evaluateFiles(ctx context.Context, env *object.Environment, files []*ast.File) (objs []object.Object, err error) {
+	limiter := i.newLimiter(ctx)
+	decls, err := orderDeclarations(files)
+	if err != nil {
+		return nil, err
+	}
+
+	defer recoverBailout(&err, i.fileSet)
+	switch i.evaluationBackend() {
+	case VM:
+		bytecode := compile(decls)
+		return newVM(bytecode, env, limiter, i.functions).run(), nil
+	case Closure:
+		program := compileClosures(decls)
+		return program.run(env, limiter, i.functions), nil
+	default:
+		walker := &treeWalker{
+			env:     env,
+			limiter: limiter,
+		}
+		return walker.evaluateDeclarations(decls), nil
+	}
+}
+
+// EvaluateExpression evaluates src as an expression. It returns nil
+// for a call of a function without results, which is evaluated as
+// a statement.
+func (i Interpreter) EvaluateExpression(ctx context.Context, src string) (obj object.Object, err error) {
+	expr, err := parser.ParseExprFrom(i.fileSet, "main.go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := i.newLimiter(ctx)
+	defer recoverBailout(&err, i.fileSet)
+	switch i.evaluationBackend() {
+	case VM:
+		bytecode := compileExpression(expr)
+		return resultOf(newVM(bytecode, i.env, limiter, i.functions).run(), expr), nil
+	case Closure:
+		program := compileClosuresOfExpression(expr)
+		return resultOf(program.run(i.env, limiter, i.functions), expr), nil
+	default:
+		walker := &treeWalker{
+			env:     i.env,
+			limiter: limiter,
+		}
+		return resultOf([]object.Object{walker.evaluateExpression(expr)}, expr), nil
+	}
+}
+
+// EvaluateSnippet evaluates src as an expression if it is one, or as
+// declarations otherwise, as warabi -e does. It returns the results
+// joined by commas, which are none for a call without results.
+func (i Interpreter) EvaluateSnippet(ctx context.Context, src string) (string, error) {
+	if _, err := parser.ParseExpr(src); err == nil {
+		obj, err := i.EvaluateExpression(ctx, src)
+		if err != nil || obj == nil {
+			return "", err
+		}
+		return obj.String(), nil
+	}
+
+	objs, err := i.EvaluateContext(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	strs := make([]string, len(objs))
+	for i, obj := range objs {
+		strs[i] = obj.String()
+	}
+	return strings.Join(strs, ", "), nil
+}
+
+// resultOf returns the result of expr, which may be nil only if expr
+// is a call.
+func resultOf(objs []object.Object, expr ast.Expr) object.Object {
+	var obj object.Object
+	if len(objs) != 0 {
+		obj = objs[0]
+	}
+	if _, ok := expr.(*ast.CallExpr); ok {
+		return obj
+	}
+
+	return valueOf(obj, expr)
+}
+
+func (i Interpreter) Call(ctx context.Context, name string) (err error) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return fmt.Errorf("undefined: %s", name)
+	}
+	fn, ok := obj.(*object.FunctionLiteral)
+	if !ok {
+		return fmt.Errorf("cannot call non-function %s", name)
+	}
+	if len(fn.Params) != 0 {
+		return fmt.Errorf("not enough arguments in call to %s", name)
+	}
+
+	_, err = i.call(ctx, i.env, name, fn)
+	return err
+}
+
+func (i Interpreter) call(
+	ctx context.Context,
+	env *object.Environment,
+	name string,
+	fn object.Object,
+	args ...object.Object,
+) (obj object.Object, err error) {
+	limiter := i.newLimiter(ctx)
+	defer recoverBailout(&err, i.fileSet)
+
+	return callObjectAt(i.functionCaller(env, limiter), limiter, name, token.NoPos, fn, args), nil
+}
+
+func (i Interpreter) functionCaller(env *object.Environment, limiter *limiter) functionCaller {
+	switch i.evaluationBackend() {
+	case VM:
+		return newVM(bytecode{}, env, limiter, i.functions)
+	case Closure:
+		return newClosureFrame(env, limiter, i.functions)
+	default:
+		return &treeWalker{
+			env:     env,
+			limiter: limiter,
+		}
+	}
+}
+
+func (i Interpreter) RunPackage(ctx context.Context, dir string) error {
+	files, err := parsePackage(i.fileSet, dir)
+	if err != nil {
+		return err
+	}
+
+	return i.run(ctx, dir, files)
+}
+
+func (i Interpreter) RunFile(ctx context.Context, filename string, src []byte) error {
+	file, err := parser.ParseFile(i.fileSet, filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	return i.run(ctx, filepath.Dir(filename), []*ast.File{file})
+}
+
+func (i Interpreter) run(ctx context.Context, dir string, files []*ast.File) error {
+	if name := files[0].Name.Name; name != "main" {
+		return fmt.Errorf("package %s is not a main package", name)
+	}
+	module, err := findModule(dir)
+	if err != nil {
+		return err
+	}
+
+	loader := newPackageLoader(ctx, i, module)
+	if err := loader.importPackages(i.env, files); err != nil {
+		return err
+	}
+	if err := i.initialize(ctx, i.env, files); err != nil {
+		return err
+	}
+
+	return i.Call(ctx, "main")
+}
+
+func (i Interpreter) initialize(ctx context.Context, env *object.Environment, files []*ast.File) error {
+	if _, err := i.evaluateFiles(ctx, env, files); err != nil {
+		return err
+	}
+	for _, decl := range initFunctions(files) {
+		fn := newFunctionLiteral(decl.Type, decl.Body, env)
+		if _, err := i.call(ctx, env, decl.Name.Name, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// Limits bounds an evaluation. A zero value in any field means no limit,
+// and a nil AllowedPackages allows every import. MaxDepth bounds the calls
+// in progress, and MaxAllocation bounds the bytes of the strings built.
+// Other values and environments are not counted.
+type Limits struct {
+	MaxSteps        int
+	MaxDepth        int
+	MaxAllocation   int
+	AllowedPackages []string
+}
+
+type StepLimitError struct {
+	Limit int
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit exceeded: %d", e.Limit)
+}
+
+type DepthLimitError struct {
+	Limit int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("depth limit exceeded: %d", e.Limit)
+}
+
+type AllocationLimitError struct {
+	Limit int
+}
+
+func (e *AllocationLimitError) Error() string {
+	return fmt.Sprintf("allocation limit exceeded: %d bytes", e.Limit)
+}
+
+type PackageNotAllowedError struct {
+	Path string
+}
+
+func (e *PackageNotAllowedError) Error() string {
+	return fmt.Sprintf("package not allowed: %s", e.Path)
+}
+
+type ContextError struct {
+	Err error
+}
+
+func (e *ContextError) Error() string {
+	return fmt.Sprintf("evaluation interrupted: %s", e.Err)
+}
+
+func (e *ContextError) Unwrap() error {
+	return e.Err
+}
+
+type bailout struct {
+	err error
+}
+
+func bail(err error) {
+	panic(bailout{
+		err: err,
+	})
+}
+
+// positionError is an error at pos, which is resolved into the error
+// at the position with the file set of the interpreter when the bailout
+// is recovered, as the functions bailing out do not know the file set.
+type positionError struct {
+	pos token.Pos
+	at  func(token.Position) error
+}
+
+func (e *positionError) Error() string {
+	return e.at(token.Position{}).Error()
+}
+
+func errorAt(pos token.Pos, format string, args ...interface{}) error {
+	return &positionError{
+		pos: pos,
+		at: func(position token.Position) error {
+			return fmt.Errorf("%s: "+format, append([]interface{}{position}, args...)...)
+		},
+	}
+}
+
+func resolveError(err error, fileSet *token.FileSet) error {
+	positioned, ok := err.(*positionError)
+	if !ok {
+		return err
+	}
+	var position token.Position
+	if fileSet != nil {
+		position = fileSet.Position(positioned.pos)
+	}
+
+	return positioned.at(position)
+}
+
+func bailUnsupported(stmt ast.Stmt) {
+	bail(errorAt(stmt.Pos(), "unsupported statement: %T", stmt))
+}
+
+func bailUnsupportedExpression(expr ast.Expr) {
+	bail(errorAt(expr.Pos(), "unsupported expression: %s", types.ExprString(expr)))
+}
+
+func bailUnsupportedNode(node ast.Node) {
+	if stmt, ok := node.(ast.Stmt); ok {
+		bailUnsupported(stmt)
+	}
+	bailUnsupportedExpression(node.(ast.Expr))
+}
+
+func recoverBailout(err *error, fileSet *token.FileSet) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	b, ok := r.(bailout)
+	if !ok {
+		panic(r)
+	}
+
+	*err = resolveError(b.err, fileSet)
+}
+
+// maxCalls bounds the calls in progress so that unbounded recursion
+// reports an error rather than exhausting the stack of the interpreter.
+const maxCalls = 10000
+
+type StackOverflowError struct {
+	Limit int
+}
+
+func (e *StackOverflowError) Error() string {
+	return fmt.Sprintf("stack overflow: more than %d calls in progress", e.Limit)
+}
+
+// ValueStackOverflowError is reported by the vm backend when the values
+// on its stack exceed its size, which is independent of the calls.
+type ValueStackOverflowError struct {
+	Size int
+}
+
+func (e *ValueStackOverflowError) Error() string {
+	return fmt.Sprintf("stack overflow: more than %d values on the stack", e.Size)
+}
+
+type limiter struct {
+	ctx        context.Context
+	fileSet    *token.FileSet
+	limits     Limits
+	steps      int
+	depth      int
+	allocation int
+	calls      []call
+	observers  []Observer
+	panicking  error
+}
+
+type call struct {
+	name string
+	pos  token.Pos
+}
+
+func newLimiter(ctx context.Context, fileSet *token.FileSet, limits Limits) *limiter {
+	return &limiter{
+		ctx:     ctx,
+		fileSet: fileSet,
+		limits:  limits,
+	}
+}
+
+func (l *limiter) step() {
+	if l == nil {
+		return
+	}
+
+	select {
+	case <-l.ctx.Done():
+		bail(&ContextError{
+			Err: l.ctx.Err(),
+		})
+	default:
+	}
+
+	l.steps++
+	if l.limits.MaxSteps != 0 && l.limits.MaxSteps < l.steps {
+		bail(&StepLimitError{
+			Limit: l.limits.MaxSteps,
+		})
+	}
+}
+
+func (l *limiter) enter() {
+	if l == nil {
+		return
+	}
+
+	l.depth++
+	if l.limits.MaxDepth != 0 && l.limits.MaxDepth < l.depth {
+		bail(&DepthLimitError{
+			Limit: l.limits.MaxDepth,
+		})
+	}
+}
+
+func (l *limiter) leave() {
+	if l == nil {
+		return
+	}
+
+	l.depth--
+}
+
+func (l *limiter) pushCall(name string, pos token.Pos) {
+	if l == nil {
+		return
+	}
+
+	if maxCalls <= len(l.calls) {
+		bail(&StackOverflowError{
+			Limit: maxCalls,
+		})
+	}
+	l.calls = append(l.calls, call{
+		name: name,
+		pos:  pos,
+	})
+}
+
+func (l *limiter) popCall() {
+	if l == nil {
+		return
+	}
+
+	l.calls = l.calls[:len(l.calls)-1]
+}
+
+func (l *limiter) files() *token.FileSet {
+	if l == nil {
+		return nil
+	}
+
+	return l.fileSet
+}
+
+func (l *limiter) frames() []object.Frame {
+	if l == nil {
+		return nil
+	}
+
+	frames := make([]object.Frame, len(l.calls))
+	for i, call := range l.calls {
+		frames[i] = object.Frame{
+			Function: call.name,
+			Position: l.fileSet.Position(call.pos),
+		}
+	}
+
+	return frames
+}
+
+type limiterMark struct {
+	depth int
+	calls int
+}
+
+// mark and restore rewind the depth and the calls after a bailout
+// has been recovered in the middle of an evaluation.
+func (l *limiter) mark() limiterMark {
+	if l == nil {
+		return limiterMark{}
+	}
+
+	return limiterMark{
+		depth: l.depth,
+		calls: len(l.calls),
+	}
+}
+
+func (l *limiter) restore(mark limiterMark) {
+	if l == nil {
+		return
+	}
+
+	l.depth = mark.depth
+	l.calls = l.calls[:mark.calls]
+}
+
+// allocate counts the bytes of obj if it is a string.
+func (l *limiter) allocate(obj object.Object) {
+	if l == nil {
+		return
+	}
+
+	str, ok := obj.(*object.StringLiteral)
+	if !ok {
+		return
+	}
+
+	l.allocation += len(str.Value)
+	if l.limits.MaxAllocation != 0 && l.limits.MaxAllocation < l.allocation {
+		bail(&AllocationLimitError{
+			Limit: l.limits.MaxAllocation,
+		})
+	}
+}
+
+// checkImports reports the first of the imports which l does not allow.
+func (l Limits) checkImports(imports []*ast.ImportSpec) error {
+	if l.AllowedPackages == nil {
+		return nil
+	}
+
+	allowed := make(map[string]bool)
+	for _, path := range l.AllowedPackages {
+		allowed[path] = true
+	}
+	for _, spec := range imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return err
+		}
+		if !allowed[path] {
+			return &PackageNotAllowedError{
+				Path: path,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package evaluator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tomocy/warabi/object"
+)
+
+type module struct {
+	path     string
+	dir      string
+	replaces map[string]string
+}
+
+// findModule finds the go.mod in dir or its parents.
+// It returns nil if there is none.
+func findModule(dir string) (*module, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		filename := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(filename); err == nil {
+			return parseModuleFile(filename)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// parseModuleFile reads the module path and the replace directives which
+// point to local directories. Other directives need the network and are
+// ignored.
+func parseModuleFile(filename string) (*module, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &module{
+		dir:      filepath.Dir(filename),
+		replaces: make(map[string]string),
+	}
+	var block string
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s:%d: usage: module module/path", filename, n)
+			}
+			m.path = unquoteModulePath(fields[1])
+		case "replace":
+			if err := m.addReplace(fields[1:]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", filename, n, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.path == "" {
+		return nil, fmt.Errorf("%s: no module declaration", filename)
+	}
+
+	return m, nil
+}
+
+func (m *module) addReplace(fields []string) error {
+	arrow := -1
+	for i, field := range fields {
+		if field == "=>" {
+			arrow = i
+		}
+	}
+	if arrow < 1 || arrow == len(fields)-1 {
+		return fmt.Errorf("usage: replace module/path [v1.2.3] => other/module v1.4 | local/dir")
+	}
+
+	from, to := unquoteModulePath(fields[0]), unquoteModulePath(fields[arrow+1])
+	if !isLocalPath(to) {
+		return nil
+	}
+	if !filepath.IsAbs(to) {
+		to = filepath.Join(m.dir, to)
+	}
+	m.replaces[from] = to
+
+	return nil
+}
+
+func unquoteModulePath(path string) string {
+	if unquoted, err := strconv.Unquote(path); err == nil {
+		return unquoted
+	}
+
+	return path
+}
+
+func isLocalPath(path string) bool {
+	return filepath.IsAbs(path) || strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+// resolve finds the directory of the package of the import path
+// in the module, the local replacements or the vendor directory.
+func (m *module) resolve(path string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	if rest, ok := trimModulePath(path, m.path); ok {
+		return filepath.Join(m.dir, rest), true
+	}
+
+	var replaced, dir string
+	for from, to := range m.replaces {
+		if _, ok := trimModulePath(path, from); ok && len(replaced) < len(from) {
+			replaced, dir = from, to
+		}
+	}
+	if replaced != "" {
+		rest, _ := trimModulePath(path, replaced)
+		return filepath.Join(dir, rest), true
+	}
+
+	vendored := filepath.Join(m.dir, "vendor", filepath.FromSlash(path))
+	if info, err := os.Stat(vendored); err == nil && info.IsDir() {
+		return vendored, true
+	}
+
+	return "", false
+}
+
+// importPath returns the import path of the package in dir. Packages
+// outside of any module are named after their directories as go does.
+func (m *module) importPath(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err == nil && m != nil {
+		if rel, err := filepath.Rel(m.dir, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if rel == "." {
+				return m.path
+			}
+			return m.path + "/" + filepath.ToSlash(rel)
+		}
+	}
+
+	return "_" + filepath.ToSlash(dir)
+}
+
+func trimModulePath(path, modulePath string) (string, bool) {
+	if path == modulePath {
+		return "", true
+	}
+	if strings.HasPrefix(path, modulePath+"/") {
+		return filepath.FromSlash(path[len(modulePath)+1:]), true
+	}
+
+	return "", false
+}
+
+// isStandard reports whether the import path looks like the one of
+// a standard package, whose first element has no dot.
+func isStandard(path string) bool {
+	first := strings.SplitN(path, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
+
+type packageLoader struct {
+	ctx         context.Context
+	interpreter Interpreter
+	module      *module
+	packages    map[string]*object.ImportedPackage
+	loading     map[string]bool
+}
+
+func newPackageLoader(ctx context.Context, interpreter Interpreter, module *module) *packageLoader {
+	return &packageLoader{
+		ctx:         ctx,
+		interpreter: interpreter,
+		module:      module,
+		packages:    make(map[string]*object.ImportedPackage),
+		loading:     make(map[string]bool),
+	}
+}
+
+// importPackages loads the packages imported by the files and binds them
+// in env. Standard packages can not be interpreted, so importing ones
+// which are not implemented in Go is an error, and so is importing ones
+// which the limits of the interpreter do not allow.
+func (l *packageLoader) importPackages(env *object.Environment, files []*ast.File) error {
+	for _, file := range files {
+		if err := l.interpreter.limits.checkImports(file.Imports); err != nil {
+			return err
+		}
+		for _, spec := range file.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return err
+			}
+			pkg, err := l.importPackage(path)
+			if err != nil {
+				return fmt.Errorf("%s: %s", l.interpreter.fileSet.Position(spec.Pos()), err)
+			}
+			name := pkg.Name
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			switch name {
+			case "_":
+			case ".":
+				return fmt.Errorf("%s: dot imports are not supported", l.interpreter.fileSet.Position(spec.Pos()))
+			default:
+				env.Set(name, pkg)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *packageLoader) importPackage(path string) (*object.ImportedPackage, error) {
+	if dir, ok := l.module.resolve(path); ok {
+		return l.load(path, dir)
+	}
+	if !isStandard(path) {
+		return nil, fmt.Errorf("cannot find package %q", path)
+	}
+	newPackage, ok := standardPackages[path]
+	if !ok {
+		return nil, fmt.Errorf("package %q is not supported", path)
+	}
+	if _, ok := l.packages[path]; !ok {
+		l.packages[path] = newPackage(l.interpreter)
+	}
+
+	return l.packages[path], nil
+}
+
+func (l *packageLoader) load(path, dir string) (*object.ImportedPackage, error) {
+	if pkg, ok := l.packages[path]; ok {
+		return pkg, nil
+	}
+	if l.loading[path] {
+		return nil, fmt.Errorf("import cycle not allowed: %s", path)
+	}
+	l.loading[path] = true
+	defer delete(l.loading, path)
+
+	files, err := parsePackage(l.interpreter.fileSet, dir)
+	if err != nil {
+		return nil, err
+	}
+	if files[0].Name.Name == "main" {
+		return nil, fmt.Errorf("import %q is a program, not an importable package", path)
+	}
+	pkg := &object.ImportedPackage{
+		Name: files[0].Name.Name,
+		Path: path,
+		Env:  object.NewEnclosedEnvironment(object.Universe),
+	}
+	if err := l.importPackages(pkg.Env, files); err != nil {
+		return nil, err
+	}
+	if err := l.interpreter.initialize(l.ctx, pkg.Env, files); err != nil {
+		return nil, err
+	}
+	l.packages[path] = pkg
+
+	return pkg, nil
+}
@@ -0,0 +1,171 @@
+package evaluator
+
+import (
+	"go/ast"
+	"go/token"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// Observer observes evaluations as events. Only the tree-walk backend
+// reports events, so interpreters with observers evaluate on it whichever
+// backend they have.
+type Observer interface {
+	Observe(event Event)
+}
+
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+type EventKind int
+
+const (
+	// EnterNode and ExitNode are reported before and after a statement or
+	// an expression is evaluated. ExitNode is not reported if the evaluation
+	// is aborted by a panic or an error.
+	EnterNode EventKind = iota
+	ExitNode
+	// CallFunction and ReturnFunction are reported when a function or
+	// a builtin is called and returns, even by a panic or an error.
+	CallFunction
+	ReturnFunction
+	// AssignVariable is reported when a variable is declared with its value.
+	AssignVariable
+	// Panic is reported once where a run-time panic occurs.
+	Panic
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EnterNode:
+		return "enter"
+	case ExitNode:
+		return "exit"
+	case CallFunction:
+		return "call"
+	case ReturnFunction:
+		return "return"
+	case AssignVariable:
+		return "assign"
+	case Panic:
+		return "panic"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is what happens in an evaluation. Depth is the number of
+// the calls in progress, including the one called or returning.
+// The other fields are set depending on Kind:
+//
+//   - EnterNode: Node, Position and Env, the scope Node is evaluated in
+//   - ExitNode: Node, Position and Value, the result of an expression
+//   - CallFunction: Function, Position of the call if any, and Args
+//   - ReturnFunction: Function, Position of the call if any, and Value
+//   - AssignVariable: Node, the identifier, Position, Name and Value
+//   - Panic: Position and Err
+type Event struct {
+	Kind     EventKind
+	Depth    int
+	Node     ast.Node
+	Position token.Position
+	Env      *object.Environment
+	Function string
+	Name     string
+	Value    object.Object
+	Args     []object.Object
+	Err      error
+}
+
+// AddObserver adds an observer of the evaluations by i.
+func (i *Interpreter) AddObserver(observer Observer) {
+	i.observers = append(i.observers[:len(i.observers):len(i.observers)], observer)
+}
+
+func (l *limiter) observing() bool {
+	return l != nil && len(l.observers) != 0
+}
+
+func (l *limiter) observe(event Event) {
+	event.Depth = len(l.calls)
+	for _, observer := range l.observers {
+		observer.Observe(event)
+	}
+}
+
+func (l *limiter) observeEnter(node ast.Node, env *object.Environment) {
+	if !l.observing() {
+		return
+	}
+
+	l.observe(Event{
+		Kind:     EnterNode,
+		Node:     node,
+		Position: l.fileSet.Position(node.Pos()),
+		Env:      env,
+	})
+}
+
+func (l *limiter) observeExit(node ast.Node, obj object.Object) {
+	if !l.observing() {
+		return
+	}
+
+	l.observe(Event{
+		Kind:     ExitNode,
+		Node:     node,
+		Position: l.fileSet.Position(node.Pos()),
+		Value:    obj,
+	})
+}
+
+func (l *limiter) observeAssign(ident *ast.Ident, obj object.Object) {
+	if !l.observing() {
+		return
+	}
+
+	l.observe(Event{
+		Kind:     AssignVariable,
+		Node:     ident,
+		Position: l.fileSet.Position(ident.Pos()),
+		Name:     ident.Name,
+		Value:    obj,
+	})
+}
+
+func (l *limiter) observeCall(name string, pos token.Pos, args []object.Object) {
+	l.observe(Event{
+		Kind:     CallFunction,
+		Position: l.fileSet.Position(pos),
+		Function: name,
+		Args:     args,
+	})
+}
+
+// observeReturn is deferred with what is recovered, if any, which it
+// panics with again after it reports the panic if it has not been.
+func (l *limiter) observeReturn(name string, pos token.Pos, obj object.Object, recovered interface{}) {
+	if b, ok := recovered.(bailout); ok {
+		if err, ok := resolveError(b.err, l.fileSet).(*RuntimeError); ok && l.panicking != b.err {
+			l.panicking = b.err
+			l.observe(Event{
+				Kind:     Panic,
+				Position: err.Pos,
+				Err:      err,
+			})
+		}
+	}
+
+	l.observe(Event{
+		Kind:     ReturnFunction,
+		Position: l.fileSet.Position(pos),
+		Function: name,
+		Value:    obj,
+	})
+	if recovered != nil {
+		panic(recovered)
+	}
+}
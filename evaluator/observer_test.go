@@ -0,0 +1,148 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const observedSource = `package main
+
+import "fmt"
+
+func show(n int) {
+	doubled := n * 2
+	fmt.Println(doubled)
+}
+
+func main() {
+	show(1)
+	n := 1 / 0
+}
+`
+
+func TestObserver(t *testing.T) {
+	var events []string
+	observer := ObserverFunc(func(event Event) {
+		var desc string
+		switch event.Kind {
+		case EnterNode, ExitNode:
+			switch node := event.Node.(type) {
+			case ast.Stmt:
+				desc = summarize(node)
+			case ast.Expr:
+				desc = types.ExprString(node)
+				if event.Kind == ExitNode {
+					desc += fmt.Sprintf(" = %v", event.Value)
+				}
+			}
+		case CallFunction:
+			desc = fmt.Sprintf("%s%v", event.Function, event.Args)
+		case ReturnFunction:
+			desc = event.Function
+		case AssignVariable:
+			desc = fmt.Sprintf("%s = %s", event.Name, event.Value)
+		case Panic:
+			desc = fmt.Sprintf("%d: %s", event.Position.Line, event.Err)
+		}
+		events = append(events, fmt.Sprintf("%d %s %s", event.Depth, event.Kind, desc))
+	})
+
+	var w strings.Builder
+	interpreter := NewInterpreter(VM)
+	interpreter.SetOutput(&w)
+	interpreter.AddObserver(observer)
+	err := interpreter.RunFile(context.Background(), "main.go", []byte(observedSource))
+	if err == nil {
+		t.Fatalf("unexpected nil error\n")
+	}
+
+	want := []string{
+		"1 call main[]",
+		"1 enter show(1)",
+		"1 enter show(1)",
+		"1 enter show",
+		"1 exit show = ",
+		"1 enter 1",
+		"1 exit 1 = 1",
+		"2 call show[1]",
+		"2 enter doubled := n * 2",
+		"2 enter n * 2",
+		"2 enter n",
+		"2 exit n = 1",
+		"2 enter 2",
+		"2 exit 2 = 2",
+		"2 exit n * 2 = 2",
+		"2 assign doubled = 2",
+		"2 exit doubled := n * 2",
+		"2 enter fmt.Println(doubled)",
+		"2 enter fmt.Println(doubled)",
+		"2 enter fmt.Println",
+		"2 enter fmt",
+		`2 exit fmt = package fmt ("fmt")`,
+		"2 exit fmt.Println = Println",
+		"2 enter doubled",
+		"2 exit doubled = 2",
+		"3 call fmt.Println[2]",
+		"3 return fmt.Println",
+		"2 exit fmt.Println(doubled) = <nil>",
+		"2 exit fmt.Println(doubled)",
+		"2 return show",
+		"1 exit show(1) = <nil>",
+		"1 exit show(1)",
+		"1 enter n := 1 / 0",
+		"1 enter 1 / 0",
+		"1 enter 1",
+		"1 exit 1 = 1",
+		"1 enter 0",
+		"1 exit 0 = 0",
+		"1 panic 12: main.go:12:9: runtime error: integer divide by zero",
+		"1 return main",
+	}
+	if got, want := strings.Join(events, "\n"), strings.Join(want, "\n"); got != want {
+		t.Errorf("unexpected events:\n%s\nexpected:\n%s\n", got, want)
+	}
+	if got, want := w.String(), "2\n"; got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+
+	var w, traceW strings.Builder
+	interpreter := NewInterpreter(TreeWalk)
+	interpreter.SetOutput(&w)
+	interpreter.AddObserver(NewTracer(&traceW))
+	if err := interpreter.RunFile(context.Background(), filename, []byte(observedSource)); err == nil {
+		t.Fatalf("unexpected nil error\n")
+	}
+
+	want := `call main()
+  main.go:11: show(1)
+  call show(1)
+    main.go:6: doubled := n * 2
+    doubled = 2
+    main.go:7: fmt.Println(doubled)
+    call fmt.Println(2)
+    return fmt.Println
+  return show
+  main.go:12: n := 1 / 0
+  panic: main.go:12:9: runtime error: integer divide by zero
+return main
+`
+	if got := strings.ReplaceAll(traceW.String(), filename, "main.go"); got != want {
+		t.Errorf("unexpected trace: got %q, expected %q\n", got, want)
+	}
+}
@@ -0,0 +1,268 @@
+package evaluator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// parsePackage parses the files in dir which the go tool would build,
+// leaving out test files and files excluded by build constraints.
+func parsePackage(fileSet *token.FileSet, dir string) ([]*ast.File, error) {
+	files, _, err := parsePackageFiles(fileSet, dir, false)
+	return files, err
+}
+
+// parseTestPackage parses the files in dir which the go tool would build
+// for testing. The files of the external test package, whose name has
+// the _test suffix, are returned separately.
+func parseTestPackage(fileSet *token.FileSet, dir string) ([]*ast.File, []*ast.File, error) {
+	return parsePackageFiles(fileSet, dir, true)
+}
+
+func parsePackageFiles(fileSet *token.FileSet, dir string, tests bool) ([]*ast.File, []*ast.File, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files, xtestFiles []*ast.File
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		isTest := strings.HasSuffix(name, "_test.go")
+		if isTest && !tests {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			continue
+		}
+
+		file, err := parser.ParseFile(fileSet, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isTest && strings.HasSuffix(file.Name.Name, "_test") {
+			xtestFiles = append(xtestFiles, file)
+			continue
+		}
+		if len(files) != 0 && files[0].Name.Name != file.Name.Name {
+			return nil, nil, fmt.Errorf("found packages %s and %s in %s", files[0].Name.Name, file.Name.Name, dir)
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 && len(xtestFiles) == 0 {
+		return nil, nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	for _, file := range xtestFiles {
+		if len(files) != 0 && file.Name.Name != files[0].Name.Name+"_test" {
+			return nil, nil, fmt.Errorf("found packages %s and %s in %s", files[0].Name.Name, file.Name.Name, dir)
+		}
+	}
+
+	return files, xtestFiles, nil
+}
+
+func initFunctions(files []*ast.File) []*ast.FuncDecl {
+	var decls []*ast.FuncDecl
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if ok && decl.Recv == nil && !isReferable(decl) {
+				decls = append(decls, decl)
+			}
+		}
+	}
+
+	return decls
+}
+
+type initializer struct {
+	decl  *ast.GenDecl
+	names []string
+	refs  map[string]bool
+}
+
+// orderDeclarations arranges the package-level declarations of the files
+// so that they can be evaluated one by one: functions come first, and
+// variables follow in the package initialization order of the spec.
+func orderDeclarations(files []*ast.File) ([]ast.Decl, error) {
+	var others, funcs []ast.Decl
+	var inits []*initializer
+	funcDecls := make(map[string]*ast.FuncDecl)
+	packageLevels := make(map[interface{}]bool)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				funcs = append(funcs, decl)
+				if decl.Recv == nil && isReferable(decl) {
+					funcDecls[decl.Name.Name] = decl
+					packageLevels[decl] = true
+				}
+			case *ast.GenDecl:
+				if decl.Tok != token.VAR && decl.Tok != token.CONST {
+					others = append(others, decl)
+					continue
+				}
+				for _, spec := range decl.Specs {
+					packageLevels[spec] = true
+					inits = append(inits, splitValueSpecification(decl.Tok, spec.(*ast.ValueSpec))...)
+				}
+			}
+		}
+	}
+
+	referencesOf := func(node ast.Node) map[string]bool {
+		return packageLevelReferences(node, packageLevels)
+	}
+	for _, init := range inits {
+		init.refs = make(map[string]bool)
+		for _, value := range init.decl.Specs[0].(*ast.ValueSpec).Values {
+			addReferences(init.refs, referencesOf(value), funcDecls, referencesOf)
+		}
+	}
+
+	ordered, err := orderInitializers(inits)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(others, funcs...), ordered...), nil
+}
+
+func splitValueSpecification(tok token.Token, spec *ast.ValueSpec) []*initializer {
+	if len(spec.Values) != 0 && len(spec.Values) != len(spec.Names) {
+		names := make([]string, len(spec.Names))
+		for i, name := range spec.Names {
+			names[i] = name.Name
+		}
+		return []*initializer{
+			{
+				decl: &ast.GenDecl{
+					Tok:   tok,
+					Specs: []ast.Spec{spec},
+				},
+				names: names,
+			},
+		}
+	}
+
+	inits := make([]*initializer, len(spec.Names))
+	for i, name := range spec.Names {
+		split := &ast.ValueSpec{
+			Names: []*ast.Ident{name},
+			Type:  spec.Type,
+		}
+		if len(spec.Values) != 0 {
+			split.Values = []ast.Expr{spec.Values[i]}
+		}
+		inits[i] = &initializer{
+			decl: &ast.GenDecl{
+				Tok:   tok,
+				Specs: []ast.Spec{split},
+			},
+			names: []string{name.Name},
+		}
+	}
+
+	return inits
+}
+
+func packageLevelReferences(node ast.Node, packageLevels map[interface{}]bool) map[string]bool {
+	refs := make(map[string]bool)
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(node.X, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Ident); ok && (ident.Obj == nil || packageLevels[ident.Obj.Decl]) {
+					refs[ident.Name] = true
+				}
+				return true
+			})
+			return false
+		case *ast.Ident:
+			if node.Obj == nil || packageLevels[node.Obj.Decl] {
+				refs[node.Name] = true
+			}
+		}
+		return true
+	})
+
+	return refs
+}
+
+// addReferences adds refs to dst, following references to functions
+// through their bodies.
+func addReferences(
+	dst map[string]bool,
+	refs map[string]bool,
+	funcDecls map[string]*ast.FuncDecl,
+	referencesOf func(ast.Node) map[string]bool,
+) {
+	for name := range refs {
+		if dst[name] {
+			continue
+		}
+		dst[name] = true
+		if decl, ok := funcDecls[name]; ok && decl.Body != nil {
+			addReferences(dst, referencesOf(decl.Body), funcDecls, referencesOf)
+		}
+	}
+}
+
+func orderInitializers(inits []*initializer) ([]ast.Decl, error) {
+	declared := make(map[string]bool)
+	for _, init := range inits {
+		for _, name := range init.names {
+			declared[name] = true
+		}
+	}
+
+	initialized := make(map[string]bool)
+	var ordered []ast.Decl
+	for len(inits) != 0 {
+		next := -1
+		for i, init := range inits {
+			if init.isReady(declared, initialized) {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			var names []string
+			for _, init := range inits {
+				names = append(names, init.names...)
+			}
+			return nil, fmt.Errorf("initialization cycle: %s", strings.Join(names, ", "))
+		}
+
+		for _, name := range inits[next].names {
+			initialized[name] = true
+		}
+		ordered = append(ordered, inits[next].decl)
+		inits = append(inits[:next], inits[next+1:]...)
+	}
+
+	return ordered, nil
+}
+
+func (i initializer) isReady(declared, initialized map[string]bool) bool {
+	for name := range i.refs {
+		if !declared[name] || initialized[name] {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,224 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// standardPackages are the standard packages implemented in Go,
+// keyed by their import paths.
+var standardPackages = map[string]func(i Interpreter) *object.ImportedPackage{
+	"fmt":     newFmtPackage,
+	"os":      newOSPackage,
+	"testing": newTestingPackage,
+}
+
+// panic is predeclared, so it is set in the universe rather than in
+// a package.
+func init() {
+	object.Universe.Set("panic", &object.Builtin{
+		Name: "panic",
+		Fn: func(caller object.Caller, args []object.Object) (object.Object, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("wrong number of arguments in call to panic: %d", len(args))
+			}
+			return nil, &PanicError{
+				Value:  args[0],
+				Frames: caller.Frames(),
+			}
+		},
+	})
+}
+
+// PanicError is the error of a call of panic. Frames are the calls in
+// progress, outermost first, ending with the call of panic.
+type PanicError struct {
+	Value  object.Object
+	Frames []object.Frame
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprint("panic: ", nativeValue(e.Value))
+}
+
+// ExitError is the error of a call of os.Exit, which exits with Code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func newStandardPackage(name string, builtins ...*object.Builtin) *object.ImportedPackage {
+	pkg := &object.ImportedPackage{
+		Name: name,
+		Path: name,
+		Env:  object.NewEnclosedEnvironment(object.Universe),
+	}
+	for _, builtin := range builtins {
+		pkg.Env.Set(builtin.Name, builtin)
+	}
+
+	return pkg
+}
+
+func newFmtPackage(i Interpreter) *object.ImportedPackage {
+	w := i.stdout()
+	return newStandardPackage(
+		"fmt",
+		&object.Builtin{
+			Name: "Print",
+			Fn: func(_ object.Caller, args []object.Object) (object.Object, error) {
+				_, err := fmt.Fprint(w, nativeValues(args)...)
+				return nil, err
+			},
+		},
+		&object.Builtin{
+			Name: "Println",
+			Fn: func(_ object.Caller, args []object.Object) (object.Object, error) {
+				_, err := fmt.Fprintln(w, nativeValues(args)...)
+				return nil, err
+			},
+		},
+		&object.Builtin{
+			Name: "Printf",
+			Fn: func(_ object.Caller, args []object.Object) (object.Object, error) {
+				format, args, err := formatArguments("Printf", args)
+				if err != nil {
+					return nil, err
+				}
+				_, err = fmt.Fprintf(w, format, nativeValues(args)...)
+				return nil, err
+			},
+		},
+		&object.Builtin{
+			Name:   "Sprint",
+			Result: object.String,
+			Fn: func(_ object.Caller, args []object.Object) (object.Object, error) {
+				return &object.StringLiteral{
+					Value: fmt.Sprint(nativeValues(args)...),
+				}, nil
+			},
+		},
+		&object.Builtin{
+			Name:   "Sprintln",
+			Result: object.String,
+			Fn: func(_ object.Caller, args []object.Object) (object.Object, error) {
+				return &object.StringLiteral{
+					Value: fmt.Sprintln(nativeValues(args)...),
+				}, nil
+			},
+		},
+		&object.Builtin{
+			Name:   "Sprintf",
+			Result: object.String,
+			Fn: func(_ object.Caller, args []object.Object) (object.Object, error) {
+				format, args, err := formatArguments("Sprintf", args)
+				if err != nil {
+					return nil, err
+				}
+				return &object.StringLiteral{
+					Value: fmt.Sprintf(format, nativeValues(args)...),
+				}, nil
+			},
+		},
+	)
+}
+
+// newOSPackage returns os, which has only Args and Exit.
+func newOSPackage(i Interpreter) *object.ImportedPackage {
+	pkg := newStandardPackage(
+		"os",
+		&object.Builtin{
+			Name: "Exit",
+			Fn: func(_ object.Caller, args []object.Object) (object.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("wrong number of arguments in call to os.Exit: %d", len(args))
+				}
+				code, ok := args[0].(*object.IntegerLiteral)
+				if !ok {
+					return nil, fmt.Errorf("cannot use %s as int value in argument to os.Exit", args[0])
+				}
+				return nil, &ExitError{
+					Code: code.Value,
+				}
+			},
+		},
+	)
+	pkg.Env.Set("Args", stringsObject(i.args))
+
+	return pkg
+}
+
+// stringsObject is []string, which is formatted as Go formats it.
+type stringsObject []string
+
+func (o stringsObject) Kind() object.Kind {
+	return object.Native
+}
+
+func (o stringsObject) String() string {
+	return fmt.Sprint([]string(o))
+}
+
+func newTestingPackage(Interpreter) *object.ImportedPackage {
+	return newStandardPackage(
+		"testing",
+		&object.Builtin{
+			Name:   "Short",
+			Result: object.Boolean,
+			Fn: func(object.Caller, []object.Object) (object.Object, error) {
+				return object.False, nil
+			},
+		},
+	)
+}
+
+func formatArguments(name string, args []object.Object) (string, []object.Object, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("not enough arguments in call to %s", name)
+	}
+	format, ok := args[0].(*object.StringLiteral)
+	if !ok {
+		return "", nil, fmt.Errorf("cannot use %s as string value in argument to %s", args[0], name)
+	}
+
+	return format.Value, args[1:], nil
+}
+
+// nativeValues converts objs into Go values so that they are formatted
+// as Go formats values of the same types.
+func nativeValues(objs []object.Object) []interface{} {
+	values := make([]interface{}, len(objs))
+	for i, obj := range objs {
+		values[i] = nativeValue(obj)
+	}
+
+	return values
+}
+
+func nativeValue(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.IntegerLiteral:
+		return obj.Value
+	case *object.StringLiteral:
+		return obj.Value
+	case *object.CharacterLiteral:
+		return obj.Value
+	case *object.FloatingPointLiteral:
+		return obj.Value
+	case *object.BooleanLiteral:
+		return obj == object.True
+	case nil:
+		return nil
+	default:
+		return obj.String()
+	}
+}
+
+func sprintln(args []object.Object) string {
+	return strings.TrimSuffix(fmt.Sprintln(nativeValues(args)...), "\n")
+}
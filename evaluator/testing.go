@@ -0,0 +1,992 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// TestOptions are the options of Test named after the flags of go test.
+type TestOptions struct {
+	Run       string
+	Bench     string
+	Benchtime time.Duration
+	Verbose   bool
+	JSON      bool
+	// Coverage counts the statements of the package executed by the tests
+	// if it is not nil.
+	Coverage *Coverage
+}
+
+var (
+	errFailNow = errors.New("test executed FailNow")
+	errSkipNow = errors.New("test executed SkipNow")
+)
+
+// Test runs the tests, the examples, the seed corpora of the fuzz targets
+// and the benchmarks of the package in dir, and reports them to w as
+// go test does. It reports whether all of them passed.
+func (i Interpreter) Test(ctx context.Context, dir string, w io.Writer, opts TestOptions) (bool, error) {
+	r, err := newTestRunner(ctx, i, opts)
+	if err != nil {
+		return false, err
+	}
+	r.interpreter.output = r
+	if opts.Coverage != nil {
+		if err := opts.Coverage.AddPackage(dir); err != nil {
+			return false, err
+		}
+		r.interpreter.AddObserver(opts.Coverage)
+	}
+
+	start := time.Now()
+	pkg, tests, err := r.interpreter.loadTests(ctx, dir)
+	if err != nil {
+		return false, err
+	}
+	r.pkg = pkg
+	results := r.runAll(tests)
+
+	report := newTestReport(w, pkg, opts)
+	if opts.Coverage != nil {
+		report.coverage = fmt.Sprintf("coverage: %.1f%% of statements", opts.Coverage.Percent(dir))
+	}
+	return report.write(r.stray, results, time.Since(start)), nil
+}
+
+func (i Interpreter) loadTests(ctx context.Context, dir string) (string, []*testFunction, error) {
+	files, xtestFiles, err := parseTestPackage(i.fileSet, dir)
+	if err != nil {
+		return "", nil, err
+	}
+	module, err := findModule(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	path := module.importPath(dir)
+
+	loader := newPackageLoader(ctx, i, module)
+	var tests []*testFunction
+	if len(files) != 0 {
+		pkg := &object.ImportedPackage{
+			Name: files[0].Name.Name,
+			Path: path,
+			Env:  object.NewEnclosedEnvironment(object.Universe),
+		}
+		if err := loader.importPackages(pkg.Env, files); err != nil {
+			return "", nil, err
+		}
+		if err := i.initialize(ctx, pkg.Env, files); err != nil {
+			return "", nil, err
+		}
+		// The external test package imports the package with its tests.
+		loader.packages[path] = pkg
+		tests = append(tests, findTests(pkg.Env, testFiles(i.fileSet, files))...)
+	}
+	if len(xtestFiles) != 0 {
+		env := object.NewEnclosedEnvironment(object.Universe)
+		if err := loader.importPackages(env, xtestFiles); err != nil {
+			return "", nil, err
+		}
+		if err := i.initialize(ctx, env, xtestFiles); err != nil {
+			return "", nil, err
+		}
+		tests = append(tests, findTests(env, xtestFiles)...)
+	}
+
+	for _, test := range tests {
+		test.dir = dir
+	}
+
+	return path, tests, nil
+}
+
+func testFiles(fileSet *token.FileSet, files []*ast.File) []*ast.File {
+	var tests []*ast.File
+	for _, file := range files {
+		if strings.HasSuffix(fileSet.Position(file.Pos()).Filename, "_test.go") {
+			tests = append(tests, file)
+		}
+	}
+
+	return tests
+}
+
+type testKind int
+
+const (
+	kindTest testKind = iota
+	kindFuzz
+	kindExample
+	kindBenchmark
+)
+
+type testFunction struct {
+	kind    testKind
+	name    string
+	fn      object.Object
+	env     *object.Environment
+	dir     string
+	example *doc.Example
+}
+
+// findTests finds the test functions in files in the order go test runs
+// them: tests, fuzz targets, examples and benchmarks.
+func findTests(env *object.Environment, files []*ast.File) []*testFunction {
+	found := make(map[testKind][]*testFunction)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Recv != nil {
+				continue
+			}
+			for _, kind := range []testKind{kindTest, kindFuzz, kindBenchmark} {
+				if !isTestFunction(kind, decl) {
+					continue
+				}
+				fn, _ := env.Get(decl.Name.Name)
+				found[kind] = append(found[kind], &testFunction{
+					kind: kind,
+					name: decl.Name.Name,
+					fn:   fn,
+					env:  env,
+				})
+			}
+		}
+	}
+	for _, example := range doc.Examples(files...) {
+		if example.Output == "" && !example.EmptyOutput {
+			continue
+		}
+		name := "Example" + example.Name
+		fn, _ := env.Get(name)
+		found[kindExample] = append(found[kindExample], &testFunction{
+			kind:    kindExample,
+			name:    name,
+			fn:      fn,
+			env:     env,
+			example: example,
+		})
+	}
+
+	var tests []*testFunction
+	for _, kind := range []testKind{kindTest, kindFuzz, kindExample, kindBenchmark} {
+		tests = append(tests, found[kind]...)
+	}
+
+	return tests
+}
+
+var testPrefixes = map[testKind]string{
+	kindTest:      "Test",
+	kindFuzz:      "Fuzz",
+	kindBenchmark: "Benchmark",
+}
+
+// isTestFunction reports whether decl is a test function of kind,
+// whose name is not followed by a lower case letter after the prefix
+// and which takes a single parameter.
+func isTestFunction(kind testKind, decl *ast.FuncDecl) bool {
+	name := decl.Name.Name
+	prefix := testPrefixes[kind]
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if rest := name[len(prefix):]; rest != "" {
+		r, _ := utf8.DecodeRuneInString(rest)
+		if unicode.IsLower(r) {
+			return false
+		}
+	}
+
+	return decl.Type.Params != nil && len(decl.Type.Params.List) == 1 && len(decl.Type.Params.List[0].Names) <= 1
+}
+
+type testResult struct {
+	name      string
+	benchmark bool
+	failed    bool
+	skipped   bool
+	elapsed   time.Duration
+	entries   []testEntry
+	// summary replaces the result line of benchmarks and explains
+	// the failures of examples.
+	summary string
+}
+
+// testEntry is either a line logged by the test, text printed by it
+// or one of its subtests.
+type testEntry struct {
+	log     string
+	printed string
+	sub     *testResult
+}
+
+func (r testResult) action() string {
+	switch {
+	case r.failed:
+		return "fail"
+	case r.skipped:
+		return "skip"
+	default:
+		return "pass"
+	}
+}
+
+type testRunner struct {
+	ctx         context.Context
+	interpreter Interpreter
+	opts        TestOptions
+	pkg         string
+	runPatterns []*regexp.Regexp
+	bench       *regexp.Regexp
+	current     *testResult
+	capture     *bytes.Buffer
+	stray       string
+}
+
+func newTestRunner(ctx context.Context, interpreter Interpreter, opts TestOptions) (*testRunner, error) {
+	r := &testRunner{
+		ctx:         ctx,
+		interpreter: interpreter,
+		opts:        opts,
+	}
+	if opts.Run != "" {
+		for _, pattern := range strings.Split(opts.Run, "/") {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regexp for -run: %s", err)
+			}
+			r.runPatterns = append(r.runPatterns, re)
+		}
+	}
+	if opts.Bench != "" {
+		re, err := regexp.Compile(opts.Bench)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp for -bench: %s", err)
+		}
+		r.bench = re
+	}
+	if r.opts.Benchtime == 0 {
+		r.opts.Benchtime = time.Second
+	}
+
+	return r, nil
+}
+
+// Write receives what tests print.
+func (r *testRunner) Write(p []byte) (int, error) {
+	switch {
+	case r.capture != nil:
+		r.capture.Write(p)
+	case r.current != nil:
+		r.current.entries = append(r.current.entries, testEntry{
+			printed: string(p),
+		})
+	default:
+		r.stray += string(p)
+	}
+
+	return len(p), nil
+}
+
+func (r *testRunner) matches(name string, level int) bool {
+	if len(r.runPatterns) <= level {
+		return true
+	}
+
+	return r.runPatterns[level].MatchString(name)
+}
+
+func (r *testRunner) runAll(tests []*testFunction) []*testResult {
+	var results []*testResult
+	for _, test := range tests {
+		if test.kind == kindBenchmark {
+			if r.bench == nil || !r.bench.MatchString(test.name) {
+				continue
+			}
+		} else if !r.matches(test.name, 0) {
+			continue
+		}
+
+		result := &testResult{
+			name: test.name,
+		}
+		start := time.Now()
+		switch test.kind {
+		case kindExample:
+			r.runExample(test, result)
+		case kindBenchmark:
+			r.runBenchmark(test, result)
+		default:
+			state := r.newTopLevelState(test, result)
+			state.run(test.fn)
+		}
+		if test.kind != kindBenchmark {
+			result.elapsed = time.Since(start)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (r *testRunner) newTopLevelState(test *testFunction, result *testResult) *testState {
+	s := &testState{
+		runner: r,
+		kind:   test.kind,
+		result: result,
+		dir:    test.dir,
+	}
+	s.call = func(fn object.Object, args ...object.Object) error {
+		_, err := r.interpreter.call(r.ctx, test.env, test.name, fn, args...)
+		return err
+	}
+
+	return s
+}
+
+func (r *testRunner) runExample(test *testFunction, result *testResult) {
+	var captured bytes.Buffer
+	r.capture = &captured
+	_, err := r.interpreter.call(r.ctx, test.env, test.name, test.fn)
+	r.capture = nil
+
+	got := strings.TrimSpace(strings.ReplaceAll(captured.String(), "\r\n", "\n"))
+	want := strings.TrimSpace(strings.ReplaceAll(test.example.Output, "\r\n", "\n"))
+	if test.example.Unordered {
+		got, want = sortLines(got), sortLines(want)
+	}
+	switch {
+	case err != nil:
+		result.failed = true
+		result.summary = fmt.Sprintf("panic: %s\n", err)
+	case got != want:
+		result.failed = true
+		result.summary = fmt.Sprintf("got:\n%s\nwant:\n%s\n", got, want)
+	}
+}
+
+func sortLines(text string) string {
+	lines := strings.Split(text, "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func (r *testRunner) runBenchmark(test *testFunction, result *testResult) {
+	s := r.newTopLevelState(test, result)
+	name := fmt.Sprintf("%s-%d", test.name, runtime.GOMAXPROCS(0))
+	result.name = name
+	result.benchmark = true
+	for s.n = 1; ; {
+		s.resetTimer()
+		s.run(test.fn)
+		if s.failed || s.skipped {
+			return
+		}
+		elapsed := s.elapsed()
+		if r.opts.Benchtime <= elapsed || 1e9 <= s.n {
+			result.elapsed = elapsed
+			break
+		}
+		s.n = predictIterations(s.n, elapsed, r.opts.Benchtime)
+		result.entries = nil
+	}
+
+	nsPerOp := float64(result.elapsed.Nanoseconds()) / float64(s.n)
+	result.summary = fmt.Sprintf("%s\t%8d\t%s ns/op\n", name, s.n, formatNanoseconds(nsPerOp))
+}
+
+// predictIterations predicts the iterations to take goal as testing does,
+// growing them at most 100 times at once.
+func predictIterations(n int, elapsed, goal time.Duration) int {
+	prev := n
+	if elapsed <= 0 {
+		n *= 100
+	} else {
+		n = int(float64(goal.Nanoseconds()) * 1.2 * float64(n) / float64(elapsed.Nanoseconds()))
+	}
+	if 100*prev < n {
+		n = 100 * prev
+	}
+	if n <= prev {
+		n = prev + 1
+	}
+	if 1e9 < n {
+		n = 1e9
+	}
+
+	return n
+}
+
+func formatNanoseconds(ns float64) string {
+	switch {
+	case 100 <= ns:
+		return fmt.Sprintf("%10.0f", ns)
+	case 10 <= ns:
+		return fmt.Sprintf("%12.1f", ns)
+	default:
+		return fmt.Sprintf("%13.2f", ns)
+	}
+}
+
+// testState is the state behind testing.T, testing.B and testing.F.
+type testState struct {
+	runner   *testRunner
+	parent   *testState
+	kind     testKind
+	result   *testResult
+	dir      string
+	call     func(fn object.Object, args ...object.Object) error
+	failed   bool
+	skipped  bool
+	helpers  map[string]bool
+	cleanups []object.Object
+	subNames map[string]int
+	level    int
+	args     []object.Object
+	seeds    [][]object.Object
+	n        int
+	start    time.Time
+	duration time.Duration
+	timing   bool
+}
+
+// run runs the test function fn with the object of s as the argument.
+func (s *testState) run(fn object.Object) {
+	previous := s.runner.current
+	s.runner.current = s.result
+	defer func() {
+		s.runner.current = previous
+	}()
+
+	args := append([]object.Object{
+		&testingObject{
+			state: s,
+		},
+	}, s.args...)
+	err := s.call(fn, args...)
+	if err != nil && err != errFailNow && err != errSkipNow {
+		s.log("", fmt.Sprintf("panic: %s", err))
+		s.fail()
+	}
+	for i := len(s.cleanups) - 1; 0 <= i; i-- {
+		if err := s.call(s.cleanups[i]); err != nil && err != errFailNow && err != errSkipNow {
+			s.log("", fmt.Sprintf("panic: %s", err))
+			s.fail()
+		}
+	}
+	s.result.failed, s.result.skipped = s.failed, s.skipped && !s.failed
+}
+
+func (s *testState) fail() {
+	for state := s; state != nil; state = state.parent {
+		state.failed = true
+	}
+}
+
+func (s *testState) isHelper(name string) bool {
+	for state := s; state != nil; state = state.parent {
+		if state.helpers[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// log logs text at the position of the innermost call which is not in
+// a helper function.
+func (s *testState) log(position, text string) {
+	if position != "" {
+		text = position + ": " + text
+	}
+	s.result.entries = append(s.result.entries, testEntry{
+		log: text,
+	})
+}
+
+func (s *testState) positionOf(caller object.Caller) string {
+	frames := caller.Frames()
+	k := len(frames) - 1
+	for 0 < k && s.isHelper(frames[k-1].Function) {
+		k--
+	}
+	if k < 0 || !frames[k].Position.IsValid() {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%d", filepath.Base(frames[k].Position.Filename), frames[k].Position.Line)
+}
+
+func (s *testState) resetTimer() {
+	s.duration = 0
+	s.start = time.Now()
+	s.timing = true
+}
+
+func (s *testState) elapsed() time.Duration {
+	if s.timing {
+		return s.duration + time.Since(s.start)
+	}
+
+	return s.duration
+}
+
+// runSubtest runs fn as a subtest of s with args following the object
+// of the subtest.
+func (s *testState) runSubtest(caller object.Caller, name string, fn object.Object, args ...object.Object) (bool, error) {
+	name = s.uniqueName(name)
+	if !s.runner.matches(name[strings.LastIndex(name, "/")+1:], s.level+1) {
+		return true, nil
+	}
+
+	sub := &testState{
+		runner: s.runner,
+		parent: s,
+		kind:   kindTest,
+		result: &testResult{
+			name: name,
+		},
+		dir:   s.dir,
+		level: s.level + 1,
+		args:  args,
+		call: func(fn object.Object, args ...object.Object) error {
+			_, err := caller.Call(fn, args...)
+			return err
+		},
+	}
+	s.result.entries = append(s.result.entries, testEntry{
+		sub: sub.result,
+	})
+	start := time.Now()
+	sub.run(fn)
+	sub.result.elapsed = time.Since(start)
+
+	return !sub.failed, nil
+}
+
+// uniqueName names a subtest as testing does, replacing spaces and
+// numbering duplicates.
+func (s *testState) uniqueName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if s.subNames == nil {
+		s.subNames = make(map[string]int)
+	}
+	full := s.result.name + "/" + name
+	count := s.subNames[full]
+	s.subNames[full]++
+	if count != 0 {
+		full = fmt.Sprintf("%s#%02d", full, count)
+	}
+
+	return full
+}
+
+// testingObject is *testing.T, *testing.B or *testing.F.
+type testingObject struct {
+	state *testState
+}
+
+func (o testingObject) Kind() object.Kind {
+	return object.Native
+}
+
+func (o testingObject) String() string {
+	switch o.state.kind {
+	case kindBenchmark:
+		return "*testing.B"
+	case kindFuzz:
+		return "*testing.F"
+	default:
+		return "*testing.T"
+	}
+}
+
+func (o testingObject) Select(name string) (object.Object, bool) {
+	s := o.state
+	if name == "N" && s.kind == kindBenchmark {
+		return &object.IntegerLiteral{
+			Value: s.n,
+		}, true
+	}
+
+	fn, ok := o.method(name)
+	if !ok {
+		return nil, false
+	}
+
+	return &object.Builtin{
+		Name:   name,
+		Fn:     fn,
+		Result: testingResults[name],
+	}, true
+}
+
+// testingResults are the kinds of the results of the methods which
+// return something.
+var testingResults = map[string]object.Kind{
+	"Failed":  object.Boolean,
+	"Skipped": object.Boolean,
+	"Name":    object.String,
+}
+
+// testingMembers are the names of the members of *testing.T, *testing.B
+// and *testing.F, which have some of them.
+var testingMembers = []string{
+	"Add", "Cleanup", "Error", "Errorf", "Fail", "FailNow", "Failed", "Fatal", "Fatalf", "Fuzz",
+	"Helper", "Log", "Logf", "N", "Name", "ReportAllocs", "ResetTimer", "Run", "Skip", "SkipNow",
+	"Skipf", "Skipped", "StartTimer", "StopTimer",
+}
+
+func (o testingObject) Members() []string {
+	var names []string
+	for _, name := range testingMembers {
+		if _, ok := o.Select(name); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+type builtinFunction func(object.Caller, []object.Object) (object.Object, error)
+
+func (o testingObject) method(name string) (builtinFunction, bool) {
+	s := o.state
+	logf := func(caller object.Caller, args []object.Object) error {
+		format, args, err := formatArguments(name, args)
+		if err != nil {
+			return err
+		}
+		s.log(s.positionOf(caller), fmt.Sprintf(format, nativeValues(args)...))
+		return nil
+	}
+	log := func(caller object.Caller, args []object.Object) error {
+		s.log(s.positionOf(caller), sprintln(args))
+		return nil
+	}
+
+	switch name {
+	case "Log":
+		return func(caller object.Caller, args []object.Object) (object.Object, error) {
+			return nil, log(caller, args)
+		}, true
+	case "Logf":
+		return func(caller object.Caller, args []object.Object) (object.Object, error) {
+			return nil, logf(caller, args)
+		}, true
+	case "Error", "Fatal", "Skip":
+		return func(caller object.Caller, args []object.Object) (object.Object, error) {
+			if err := log(caller, args); err != nil {
+				return nil, err
+			}
+			return nil, s.stop(name)
+		}, true
+	case "Errorf", "Fatalf", "Skipf":
+		return func(caller object.Caller, args []object.Object) (object.Object, error) {
+			if err := logf(caller, args); err != nil {
+				return nil, err
+			}
+			return nil, s.stop(name)
+		}, true
+	case "Fail", "FailNow", "SkipNow":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			return nil, s.stop(name)
+		}, true
+	case "Failed":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			return convertToBooleanLiteral(s.failed), nil
+		}, true
+	case "Skipped":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			return convertToBooleanLiteral(s.skipped), nil
+		}, true
+	case "Name":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			return &object.StringLiteral{
+				Value: s.result.name,
+			}, nil
+		}, true
+	case "Helper":
+		return func(caller object.Caller, _ []object.Object) (object.Object, error) {
+			frames := caller.Frames()
+			if 2 <= len(frames) {
+				if s.helpers == nil {
+					s.helpers = make(map[string]bool)
+				}
+				s.helpers[frames[len(frames)-2].Function] = true
+			}
+			return nil, nil
+		}, true
+	case "Cleanup":
+		return func(_ object.Caller, args []object.Object) (object.Object, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("wrong number of arguments in call to Cleanup")
+			}
+			s.cleanups = append(s.cleanups, args[0])
+			return nil, nil
+		}, true
+	}
+
+	switch s.kind {
+	case kindTest:
+		return o.testMethod(name)
+	case kindBenchmark:
+		return o.benchmarkMethod(name)
+	case kindFuzz:
+		return o.fuzzMethod(name)
+	default:
+		return nil, false
+	}
+}
+
+// stop marks s after the method of name, and returns the error which
+// stops the test if the method does so.
+func (s *testState) stop(name string) error {
+	switch name {
+	case "Error", "Errorf", "Fail":
+		s.fail()
+		return nil
+	case "Fatal", "Fatalf", "FailNow":
+		s.fail()
+		return errFailNow
+	default:
+		s.skipped = true
+		return errSkipNow
+	}
+}
+
+func (o testingObject) testMethod(name string) (builtinFunction, bool) {
+	s := o.state
+	switch name {
+	case "Run":
+		return func(caller object.Caller, args []object.Object) (object.Object, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("wrong number of arguments in call to Run")
+			}
+			name, ok := args[0].(*object.StringLiteral)
+			if !ok {
+				return nil, fmt.Errorf("cannot use %s as string value in argument to Run", args[0])
+			}
+			passed, err := s.runSubtest(caller, name.Value, args[1])
+			return convertToBooleanLiteral(passed), err
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+func (o testingObject) benchmarkMethod(name string) (builtinFunction, bool) {
+	s := o.state
+	switch name {
+	case "ResetTimer":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			timing := s.timing
+			s.resetTimer()
+			s.timing = timing
+			return nil, nil
+		}, true
+	case "StartTimer":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			if !s.timing {
+				s.start = time.Now()
+				s.timing = true
+			}
+			return nil, nil
+		}, true
+	case "StopTimer":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			if s.timing {
+				s.duration += time.Since(s.start)
+				s.timing = false
+			}
+			return nil, nil
+		}, true
+	case "ReportAllocs":
+		return func(object.Caller, []object.Object) (object.Object, error) {
+			return nil, nil
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+func (o testingObject) fuzzMethod(name string) (builtinFunction, bool) {
+	s := o.state
+	switch name {
+	case "Add":
+		return func(_ object.Caller, args []object.Object) (object.Object, error) {
+			s.seeds = append(s.seeds, args)
+			return nil, nil
+		}, true
+	case "Fuzz":
+		return func(caller object.Caller, args []object.Object) (object.Object, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("wrong number of arguments in call to Fuzz")
+			}
+			corpus, err := readFuzzCorpus(filepath.Join(s.dir, "testdata", "fuzz", s.result.name))
+			if err != nil {
+				return nil, err
+			}
+			seeds := make([]fuzzSeed, len(s.seeds))
+			for i, seed := range s.seeds {
+				seeds[i] = fuzzSeed{
+					name: fmt.Sprintf("seed#%d", i),
+					args: seed,
+				}
+			}
+			for _, seed := range append(seeds, corpus...) {
+				if _, err := s.runSubtest(caller, seed.name, args[0], seed.args...); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+type fuzzSeed struct {
+	name string
+	args []object.Object
+}
+
+// readFuzzCorpus reads the files of the seed corpus in dir, which are
+// written in the format of go test fuzz v1.
+func readFuzzCorpus(dir string) ([]fuzzSeed, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var seeds []fuzzSeed
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		src, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		args, err := parseFuzzInput(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filepath.Join(dir, info.Name()), err)
+		}
+		seeds = append(seeds, fuzzSeed{
+			name: info.Name(),
+			args: args,
+		})
+	}
+
+	return seeds, nil
+}
+
+const fuzzInputHeader = "go test fuzz v1"
+
+func parseFuzzInput(src string) ([]object.Object, error) {
+	lines := strings.Split(strings.TrimSpace(src), "\n")
+	if lines[0] != fuzzInputHeader {
+		return nil, fmt.Errorf("missing header %q", fuzzInputHeader)
+	}
+
+	var args []object.Object
+	for _, line := range lines[1:] {
+		expr, err := parser.ParseExpr(line)
+		if err != nil {
+			return nil, err
+		}
+		call, ok := expr.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return nil, fmt.Errorf("malformed line: %s", line)
+		}
+		arg, err := evaluateFuzzValue(types.ExprString(call.Fun), call.Args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", line, err)
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+func evaluateFuzzValue(typ string, expr ast.Expr) (object.Object, error) {
+	if ident, ok := expr.(*ast.Ident); ok && typ == "bool" {
+		switch ident.Name {
+		case "true":
+			return object.True, nil
+		case "false":
+			return object.False, nil
+		}
+	}
+
+	var obj object.Object
+	err := func() (err error) {
+		// The position in the error is of no file as expr is parsed alone.
+		defer recoverBailout(&err, nil)
+		obj = new(treeWalker).evaluateExpression(expr)
+		return nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "byte":
+		if char, ok := obj.(*object.CharacterLiteral); ok {
+			obj = &object.IntegerLiteral{
+				Value: int(char.Value),
+			}
+		}
+		if _, ok := obj.(*object.IntegerLiteral); ok {
+			return obj, nil
+		}
+	case "rune":
+		if _, ok := obj.(*object.CharacterLiteral); ok {
+			return obj, nil
+		}
+	case "string":
+		if _, ok := obj.(*object.StringLiteral); ok {
+			return obj, nil
+		}
+	case "float32", "float64":
+		switch value := obj.(type) {
+		case *object.FloatingPointLiteral:
+			return obj, nil
+		case *object.IntegerLiteral:
+			return &object.FloatingPointLiteral{
+				Value: float32(value.Value),
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported value of %s", typ)
+}
@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var testPackageFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"calc/calc.go": `package calc
+
+import "fmt"
+
+var Base = 40
+
+func Show(n int) {
+	fmt.Println("value:", n)
+}
+`,
+	"calc/calc_test.go": `package calc
+
+import "testing"
+
+func TestPass(t *testing.T) {
+	if got := Base + 2; got != 42 {
+		t.Errorf("got %d, expected %d", got, 42)
+	}
+}
+
+func check(t *testing.T, got int, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %d, expected %d", got, want)
+	}
+}
+
+func TestFail(t *testing.T) {
+	t.Run("sub test", func(t *testing.T) {
+		check(t, Base, 1)
+	})
+	t.Fatal("stop")
+	t.Error("unreachable")
+}
+
+func TestSkip(t *testing.T) {
+	t.Skip("later")
+}
+
+func FuzzDouble(f *testing.F) {
+	f.Add(1)
+	f.Add(2)
+	f.Fuzz(func(t *testing.T, n int) {
+		if n == 2 {
+			t.Errorf("n is %d", n)
+		}
+	})
+}
+`,
+	"calc/example_test.go": `package calc_test
+
+import "example.com/m/calc"
+
+func ExampleShow() {
+	calc.Show(calc.Base)
+	// Output: value: 40
+}
+
+func ExampleShow_wrong() {
+	calc.Show(1)
+	// Output: value: 2
+}
+`,
+	"calc/testdata/fuzz/FuzzDouble/corpus": "go test fuzz v1\nint(3)\n",
+}
+
+func TestTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range testPackageFiles {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts TestOptions
+		want string
+	}{
+		{
+			"failures",
+			TestOptions{},
+			`--- FAIL: TestFail (0.00s)
+    --- FAIL: TestFail/sub_test (0.00s)
+        calc_test.go:20: got 40, expected 1
+    calc_test.go:22: stop
+--- FAIL: FuzzDouble (0.00s)
+    --- FAIL: FuzzDouble/seed#1 (0.00s)
+        calc_test.go:35: n is 2
+--- FAIL: ExampleShow_wrong (0.00s)
+got:
+value: 1
+want:
+value: 2
+FAIL
+FAIL	example.com/m/calc	0.00s
+`,
+		},
+		{
+			"verbose",
+			TestOptions{
+				Run:     "Pass|Skip|Fuzz",
+				Verbose: true,
+			},
+			`=== RUN   TestPass
+--- PASS: TestPass (0.00s)
+=== RUN   TestSkip
+    calc_test.go:27: later
+--- SKIP: TestSkip (0.00s)
+=== RUN   FuzzDouble
+=== RUN   FuzzDouble/seed#0
+=== RUN   FuzzDouble/seed#1
+    calc_test.go:35: n is 2
+=== RUN   FuzzDouble/corpus
+--- FAIL: FuzzDouble (0.00s)
+    --- PASS: FuzzDouble/seed#0 (0.00s)
+    --- FAIL: FuzzDouble/seed#1 (0.00s)
+    --- PASS: FuzzDouble/corpus (0.00s)
+FAIL
+FAIL	example.com/m/calc	0.00s
+`,
+		},
+		{
+			"passing",
+			TestOptions{
+				Run: "TestPass|ExampleShow$",
+			},
+			"ok  \texample.com/m/calc\t0.00s\n",
+		},
+	}
+
+	durations := regexp.MustCompile(`\d+\.\d+s`)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var w bytes.Buffer
+			_, err := NewInterpreter(TreeWalk).Test(context.Background(), filepath.Join(dir, "calc"), &w, test.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+			if got := durations.ReplaceAllString(w.String(), "0.00s"); got != test.want {
+				t.Errorf("unexpected output: got %q, expected %q\n", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTestJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	src := "package calc\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {\n\tt.Run(\"b\", func(t *testing.T) {\n\t\tt.Log(\"c\")\n\t})\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "calc_test.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	var w bytes.Buffer
+	passed, err := NewInterpreter(TreeWalk).Test(context.Background(), dir, &w, TestOptions{
+		JSON: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if !passed {
+		t.Errorf("unexpected failure\n")
+	}
+
+	var actions []string
+	decoder := json.NewDecoder(&w)
+	for decoder.More() {
+		var event testEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+		action := event.Action
+		if event.Test != "" {
+			action += " " + event.Test
+		}
+		if event.Action == "output" {
+			action += " " + strings.TrimSpace(event.Output)
+		}
+		actions = append(actions, action)
+	}
+	want := []string{
+		"start",
+		"run TestA",
+		"output TestA === RUN   TestA",
+		"run TestA/b",
+		"output TestA/b === RUN   TestA/b",
+		"output TestA/b calc_test.go:7: c",
+		"output TestA --- PASS: TestA (0.00s)",
+		"output TestA/b --- PASS: TestA/b (0.00s)",
+		"pass TestA/b",
+		"pass TestA",
+		"output PASS",
+	}
+	for i, action := range want {
+		if len(actions) <= i || actions[i] != action {
+			t.Fatalf("unexpected events: got %q, expected %q\n", actions, want)
+		}
+	}
+}
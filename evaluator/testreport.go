@@ -0,0 +1,214 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// testEvent is an event of go test -json.
+type testEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string   `json:",omitempty"`
+	Elapsed *float64 `json:",omitempty"`
+	Output  string   `json:",omitempty"`
+}
+
+type testReport struct {
+	w       io.Writer
+	pkg     string
+	verbose bool
+	json    bool
+	// coverage is the summary of the coverage as go test -cover writes,
+	// if it is measured.
+	coverage string
+}
+
+func newTestReport(w io.Writer, pkg string, opts TestOptions) *testReport {
+	return &testReport{
+		w:       w,
+		pkg:     pkg,
+		verbose: opts.Verbose || opts.JSON,
+		json:    opts.JSON,
+	}
+}
+
+// write writes the results and the summary of the package,
+// and reports whether all the tests passed.
+func (r *testReport) write(printed string, results []*testResult, elapsed time.Duration) bool {
+	r.event("start", "", nil)
+	r.output("", printed)
+
+	passed := true
+	for _, result := range results {
+		if result.failed {
+			passed = false
+		}
+		if r.verbose {
+			r.writeVerbose(result)
+		} else {
+			r.writeFailures(result)
+		}
+	}
+
+	seconds := elapsed.Seconds()
+	if passed {
+		if r.verbose {
+			r.output("", "PASS\n")
+			r.writeCoverage()
+		}
+		if r.coverage != "" {
+			r.output("", fmt.Sprintf("ok  \t%s\t%.3fs\t%s\n", r.pkg, seconds, r.coverage))
+		} else {
+			r.output("", fmt.Sprintf("ok  \t%s\t%.3fs\n", r.pkg, seconds))
+		}
+		r.event("pass", "", &seconds)
+	} else {
+		r.output("", "FAIL\n")
+		r.writeCoverage()
+		r.output("", fmt.Sprintf("FAIL\t%s\t%.3fs\n", r.pkg, seconds))
+		r.event("fail", "", &seconds)
+	}
+
+	return passed
+}
+
+func (r *testReport) writeCoverage() {
+	if r.coverage != "" {
+		r.output("", r.coverage+"\n")
+	}
+}
+
+func (r *testReport) writeVerbose(result *testResult) {
+	r.writeRun(result)
+	r.writeResult(result, 0)
+}
+
+func (r *testReport) writeRun(result *testResult) {
+	r.event("run", result.name, nil)
+	if result.benchmark && !result.failed {
+		return
+	}
+	r.output(result.name, fmt.Sprintf("=== RUN   %s\n", result.name))
+	for _, entry := range result.entries {
+		switch {
+		case entry.sub != nil:
+			r.writeRun(entry.sub)
+		case entry.printed != "":
+			r.output(result.name, entry.printed)
+		default:
+			r.output(result.name, indentLog(entry.log, "    "))
+		}
+	}
+}
+
+func (r *testReport) writeResult(result *testResult, depth int) {
+	indent := strings.Repeat("    ", depth)
+	if result.benchmark && !result.failed {
+		r.output(result.name, result.summary)
+	} else {
+		r.output(result.name, fmt.Sprintf(
+			"%s--- %s: %s (%.2fs)\n",
+			indent, strings.ToUpper(result.action()), result.name, result.elapsed.Seconds(),
+		))
+		r.output(result.name, result.summary)
+	}
+	for _, entry := range result.entries {
+		if entry.sub != nil {
+			r.writeResult(entry.sub, depth+1)
+		}
+	}
+
+	elapsed := result.elapsed.Seconds()
+	r.event(result.action(), result.name, &elapsed)
+}
+
+// writeFailures writes what go test writes without -v: what tests print,
+// and the logs of the tests which failed.
+func (r *testReport) writeFailures(result *testResult) {
+	r.writePrinted(result)
+	if result.benchmark && !result.failed {
+		r.output(result.name, result.summary)
+		return
+	}
+	if result.failed {
+		r.writeFailure(result, 0)
+	}
+}
+
+func (r *testReport) writePrinted(result *testResult) {
+	for _, entry := range result.entries {
+		switch {
+		case entry.sub != nil:
+			r.writePrinted(entry.sub)
+		case entry.printed != "":
+			r.output(result.name, entry.printed)
+		}
+	}
+}
+
+func (r *testReport) writeFailure(result *testResult, depth int) {
+	indent := strings.Repeat("    ", depth)
+	r.output(result.name, fmt.Sprintf("%s--- FAIL: %s (%.2fs)\n", indent, result.name, result.elapsed.Seconds()))
+	r.output(result.name, result.summary)
+	for _, entry := range result.entries {
+		switch {
+		case entry.sub != nil:
+			if entry.sub.failed {
+				r.writeFailure(entry.sub, depth+1)
+			}
+		case entry.printed == "":
+			r.output(result.name, indentLog(entry.log, indent+"    "))
+		}
+	}
+}
+
+// indentLog indents the lines of log as testing does, indenting lines
+// after the first further.
+func indentLog(log, indent string) string {
+	lines := strings.Split(log, "\n")
+	return indent + strings.Join(lines, "\n"+indent+"    ") + "\n"
+}
+
+func (r *testReport) output(test, text string) {
+	if text == "" {
+		return
+	}
+	if !r.json {
+		io.WriteString(r.w, text)
+		return
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		r.encode(testEvent{
+			Action: "output",
+			Test:   test,
+			Output: line,
+		})
+	}
+}
+
+func (r *testReport) event(action, test string, elapsed *float64) {
+	if !r.json {
+		return
+	}
+
+	r.encode(testEvent{
+		Action:  action,
+		Test:    test,
+		Elapsed: elapsed,
+	})
+}
+
+func (r *testReport) encode(event testEvent) {
+	event.Time = time.Now()
+	event.Package = r.pkg
+	json.NewEncoder(r.w).Encode(event)
+}
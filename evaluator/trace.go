@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Tracer writes the statements executed, the calls, the assignments
+// and the panics, indented by the depth of the calls.
+type Tracer struct {
+	w io.Writer
+}
+
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{
+		w: w,
+	}
+}
+
+func (t *Tracer) Observe(event Event) {
+	switch event.Kind {
+	case EnterNode:
+		stmt, ok := event.Node.(ast.Stmt)
+		if !ok || !isPausable(stmt) {
+			return
+		}
+		t.printf(event.Depth, "%s:%d: %s", filepath.Base(event.Position.Filename), event.Position.Line, summarize(stmt))
+	case CallFunction:
+		args := make([]string, len(event.Args))
+		for i, arg := range event.Args {
+			args[i] = arg.String()
+		}
+		t.printf(event.Depth-1, "call %s(%s)", event.Function, strings.Join(args, ", "))
+	case ReturnFunction:
+		t.printf(event.Depth-1, "return %s", event.Function)
+	case AssignVariable:
+		t.printf(event.Depth, "%s = %s", event.Name, event.Value)
+	case Panic:
+		t.printf(event.Depth, "panic: %s", event.Err)
+	}
+}
+
+func (t *Tracer) printf(depth int, format string, a ...interface{}) {
+	fmt.Fprintf(t.w, "%s%s\n", strings.Repeat("  ", depth), fmt.Sprintf(format, a...))
+}
+
+// summarize returns the first line of stmt without the brace opening
+// the block.
+func summarize(stmt ast.Stmt) string {
+	var b bytes.Buffer
+	// The positions are only to lay out the lines, which the printer
+	// does as well without the file of stmt.
+	printer.Fprint(&b, token.NewFileSet(), stmt)
+	line := strings.SplitN(b.String(), "\n", 2)[0]
+
+	return strings.TrimSpace(strings.TrimSuffix(line, "{"))
+}
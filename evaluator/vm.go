@@ -0,0 +1,202 @@
+package evaluator
+
+import (
+	"encoding/binary"
+
+	"github.com/tomocy/warabi/object"
+)
+
+const stackSize = 2048
+
+type vm struct {
+	stack     []object.Object
+	sp        int
+	frames    []*frame
+	results   []object.Object
+	functions *functionCache
+	limiter   *limiter
+}
+
+// frame is a call of the bytecode, which has its own tables, in env.
+type frame struct {
+	*bytecode
+	ip     int
+	locals []object.Object
+	env    *object.Environment
+}
+
+func newVM(code bytecode, env *object.Environment, limiter *limiter, functions *functionCache) *vm {
+	return &vm{
+		stack: make([]object.Object, stackSize),
+		frames: []*frame{
+			{
+				bytecode: &code,
+				locals:   make([]object.Object, code.locals),
+				env:      env,
+			},
+		},
+		functions: functions,
+		limiter:   limiter,
+	}
+}
+
+func (vm *vm) run() []object.Object {
+	vm.execute(0)
+	return vm.results
+}
+
+// execute runs the instructions until the frames above the first base
+// ones have returned.
+func (vm *vm) execute(base int) {
+	for base < len(vm.frames) {
+		frame := vm.currentFrame()
+		if len(frame.instructions) <= frame.ip {
+			vm.popFrame()
+			continue
+		}
+
+		vm.limiter.step()
+		op := opcode(frame.instructions[frame.ip])
+		frame.ip++
+		switch op {
+		case opConstant:
+			index := vm.readOperand()
+			vm.push(frame.constants[index])
+		case opGetGlobal:
+			index := vm.readOperand()
+			vm.push(lookUp(frame.env, frame.identifiers[index]))
+		case opSetGlobal:
+			index := vm.readOperand()
+			frame.env.Set(frame.names[index], vm.pop())
+		case opGetLocal:
+			index := vm.readOperand()
+			vm.push(frame.locals[index])
+		case opSetLocal:
+			index := vm.readOperand()
+			frame.locals[index] = vm.pop()
+		case opSelect:
+			index := vm.readOperand()
+			vm.push(selectMember(vm.pop(), frame.selectors[index]))
+		case opCall:
+			size := vm.readOperand()
+			index := vm.readOperand()
+			args := make([]object.Object, size)
+			for i := size - 1; 0 <= i; i-- {
+				args[i] = vm.pop()
+			}
+			fn := vm.pop()
+			vm.push(callObject(vm, vm.limiter, frame.calls[index], fn, args))
+		case opFunction:
+			index := vm.readOperand()
+			scope := vm.readOperand()
+			vm.push(vm.newFunction(frame.constants[index].(*object.FunctionLiteral), frame.scopes[scope]))
+		case opBinary:
+			index := vm.readOperand()
+			rightObj := vm.pop()
+			leftObj := vm.pop()
+			obj := operateBinary(frame.binaries[index], leftObj, rightObj)
+			vm.limiter.allocate(obj)
+			vm.push(obj)
+		case opShortCircuit:
+			destination := vm.readOperand()
+			index := vm.readOperand()
+			if _, ok := shortCircuit(frame.binaries[index], vm.stack[vm.sp-1]); ok {
+				frame.ip = destination
+			}
+		case opUnary:
+			index := vm.readOperand()
+			vm.push(operateUnary(frame.unaries[index], vm.pop()))
+		case opValue:
+			index := vm.readOperand()
+			valueOf(vm.stack[vm.sp-1], frame.values[index])
+		case opJump:
+			frame.ip = vm.readOperand()
+		case opJumpIfFalse:
+			destination := vm.readOperand()
+			index := vm.readOperand()
+			if !condition(vm.pop(), frame.conditions[index]) {
+				frame.ip = destination
+			}
+		case opDuplicate:
+			vm.push(vm.stack[vm.sp-1])
+		case opPop:
+			vm.pop()
+		case opYield:
+			vm.results = append(vm.results, vm.pop())
+		case opUnsupported:
+			bailUnsupportedNode(frame.unsupported[vm.readOperand()])
+		}
+	}
+}
+
+// newFunction makes a function of fn declared in the current frame.
+// The locals in scope are captured by value, which is safe as long as
+// they can not be assigned after their declarations.
+func (vm *vm) newFunction(fn *object.FunctionLiteral, scope map[string]int) *object.FunctionLiteral {
+	frame := vm.currentFrame()
+	env := frame.env
+	if scope != nil {
+		env = object.NewEnclosedEnvironment(frame.env)
+		for name, index := range scope {
+			env.Set(name, frame.locals[index])
+		}
+	}
+
+	declared := *fn
+	declared.Env = env
+	return &declared
+}
+
+// callFunction runs fn in a new frame on the stack of the vm, compiling
+// its body on the first call. The frames and the stack are rewound even
+// if it bails out, which a builtin calling fn may recover from.
+func (vm *vm) callFunction(fn *object.FunctionLiteral, args []object.Object) {
+	code := vm.functions.bytecode(fn)
+	base, sp := len(vm.frames), vm.sp
+	defer func() {
+		vm.frames = vm.frames[:base]
+		for ; sp < vm.sp; vm.sp-- {
+			vm.stack[vm.sp-1] = nil
+		}
+	}()
+	locals := make([]object.Object, code.locals)
+	copy(locals, args)
+	vm.frames = append(vm.frames, &frame{
+		bytecode: code,
+		locals:   locals,
+		env:      scopeOf(fn, vm.currentFrame().env),
+	})
+	vm.execute(base)
+}
+
+func (vm *vm) currentFrame() *frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *vm) popFrame() {
+	vm.frames = vm.frames[:len(vm.frames)-1]
+}
+
+func (vm *vm) readOperand() int {
+	frame := vm.currentFrame()
+	operand := binary.BigEndian.Uint32(frame.instructions[frame.ip:])
+	frame.ip += 4
+	return int(operand)
+}
+
+func (vm *vm) push(obj object.Object) {
+	if len(vm.stack) <= vm.sp {
+		bail(&ValueStackOverflowError{
+			Size: len(vm.stack),
+		})
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *vm) pop() object.Object {
+	vm.sp--
+	obj := vm.stack[vm.sp]
+	vm.stack[vm.sp] = nil
+	return obj
+}
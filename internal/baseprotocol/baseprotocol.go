@@ -0,0 +1,50 @@
+// Package baseprotocol reads and writes JSON messages framed by the
+// Content-Length header as the base protocol of the language server
+// protocol and the debug adapter protocol does.
+package baseprotocol
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// MaxMessageSize bounds the body of a message so that a peer can not make
+// the reader allocate as much as it claims.
+const MaxMessageSize = 64 << 20
+
+// ReadMessage reads a message and decodes its body into msg.
+func ReadMessage(r *bufio.Reader, msg interface{}) error {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	if length < 0 || MaxMessageSize < length {
+		return fmt.Errorf("Content-Length out of range: %d", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, msg)
+}
+
+// WriteMessage encodes msg and writes it as a message.
+func WriteMessage(w io.Writer, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -0,0 +1,40 @@
+package baseprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteMessage(&b, map[string]int{"seq": 1}); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if err := WriteMessage(&b, map[string]int{"seq": 2}); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if want := "Content-Length: 9\r\n\r\n{\"seq\":1}"; !strings.HasPrefix(b.String(), want) {
+		t.Errorf("unexpected message: got %q, expected %q\n", b.String(), want)
+	}
+
+	r := bufio.NewReader(&b)
+	for _, want := range []int{1, 2} {
+		var msg map[string]int
+		if err := ReadMessage(r, &msg); err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+		if msg["seq"] != want {
+			t.Errorf("unexpected seq: got %d, expected %d\n", msg["seq"], want)
+		}
+	}
+
+	for _, length := range []string{"x", "-1", "9223372036854775807"} {
+		var msg map[string]int
+		r := bufio.NewReader(strings.NewReader("Content-Length: " + length + "\r\n\r\n{}"))
+		if err := ReadMessage(r, &msg); err == nil {
+			t.Errorf("unexpected nil error of Content-Length %s\n", length)
+		}
+	}
+}
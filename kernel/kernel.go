@@ -0,0 +1,559 @@
+package kernel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/object"
+)
+
+// ConnectionInfo is what Jupyter passes to kernels in connection files.
+type ConnectionInfo struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	StdinPort       int    `json:"stdin_port"`
+	ControlPort     int    `json:"control_port"`
+	HeartbeatPort   int    `json:"hb_port"`
+	Key             string `json:"key"`
+	SignatureScheme string `json:"signature_scheme"`
+	KernelName      string `json:"kernel_name,omitempty"`
+}
+
+func ReadConnectionInfo(filename string) (ConnectionInfo, error) {
+	var info ConnectionInfo
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(src, &info); err != nil {
+		return info, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	return info, nil
+}
+
+// Kernel is a Jupyter kernel, which evaluates the code of a notebook
+// in a session of the interpreter.
+type Kernel struct {
+	info        ConnectionInfo
+	interpreter evaluator.Interpreter
+	timeout     time.Duration
+	signer      signer
+	session     string
+
+	shell, control, stdin, iopub, heartbeat *socket
+	requests                                chan request
+
+	mu             sync.Mutex
+	cancel         context.CancelFunc
+	executing      *message
+	executionCount int
+	done           chan struct{}
+	shutdown       sync.Once
+}
+
+type request struct {
+	conn   *zmtpConn
+	frames [][]byte
+}
+
+type Option func(*Kernel)
+
+// WithTimeout limits the time of each execution.
+func WithTimeout(timeout time.Duration) Option {
+	return func(k *Kernel) {
+		k.timeout = timeout
+	}
+}
+
+// Listen listens on the ports in info, choosing ones for the ports of 0,
+// which Info reports.
+func Listen(info ConnectionInfo, interpreter *evaluator.Interpreter, opts ...Option) (*Kernel, error) {
+	if info.Transport != "" && info.Transport != "tcp" {
+		return nil, fmt.Errorf("unsupported transport: %s", info.Transport)
+	}
+	if info.Key != "" && info.SignatureScheme != "" && info.SignatureScheme != "hmac-sha256" {
+		return nil, fmt.Errorf("unsupported signature scheme: %s", info.SignatureScheme)
+	}
+
+	k := &Kernel{
+		info:        info,
+		interpreter: *interpreter,
+		signer:      signer{key: []byte(info.Key)},
+		session:     newID(),
+		requests:    make(chan request),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	// The output is set once since imported packages keep the one at the
+	// time they are imported.
+	k.interpreter.SetOutput(&streamWriter{kernel: k})
+	sockets := []struct {
+		dst  **socket
+		port *int
+		typ  string
+	}{
+		{&k.shell, &k.info.ShellPort, "ROUTER"},
+		{&k.control, &k.info.ControlPort, "ROUTER"},
+		{&k.stdin, &k.info.StdinPort, "ROUTER"},
+		{&k.iopub, &k.info.IOPubPort, "PUB"},
+		{&k.heartbeat, &k.info.HeartbeatPort, "REP"},
+	}
+	for i, s := range sockets {
+		socket, err := listen(net.JoinHostPort(info.IP, strconv.Itoa(*s.port)), s.typ)
+		if err != nil {
+			for _, s := range sockets[:i] {
+				(*s.dst).close()
+			}
+			return nil, err
+		}
+		*s.dst = socket
+		*s.port = socket.port()
+	}
+
+	return k, nil
+}
+
+func (k *Kernel) Info() ConnectionInfo {
+	return k.info
+}
+
+// Serve serves clients until one of them requests to shut down
+// the kernel.
+func (k *Kernel) Serve() error {
+	go k.shell.serve(func(c *zmtpConn, frames [][]byte) {
+		select {
+		case k.requests <- request{conn: c, frames: frames}:
+		case <-k.done:
+		}
+	})
+	go k.control.serve(k.handleControl)
+	go k.stdin.serve(nil)
+	go k.iopub.serve(nil)
+	go k.heartbeat.serve(func(c *zmtpConn, frames [][]byte) {
+		c.writeMessage(frames)
+	})
+
+	for {
+		select {
+		case req := <-k.requests:
+			k.handle(req.conn, req.frames)
+		case <-k.done:
+			for _, s := range []*socket{k.shell, k.control, k.stdin, k.iopub, k.heartbeat} {
+				s.close()
+			}
+			return nil
+		}
+	}
+}
+
+// Close shuts down the kernel.
+func (k *Kernel) Close() {
+	k.shutdown.Do(func() {
+		k.interrupt()
+		close(k.done)
+	})
+}
+
+func (k *Kernel) interrupt() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.cancel != nil {
+		k.cancel()
+	}
+}
+
+// handleControl handles only the requests which are meant for the control
+// channel, since the others are handled by the shell loop one by one and
+// would race with it on the interpreter.
+func (k *Kernel) handleControl(c *zmtpConn, frames [][]byte) {
+	msg, err := k.signer.decode(frames)
+	if err != nil {
+		return
+	}
+	switch msg.header.Type {
+	case "kernel_info_request", "interrupt_request", "shutdown_request":
+		k.dispatch(c, msg)
+	}
+}
+
+// handle handles a request. Requests which are not signed correctly are
+// ignored.
+func (k *Kernel) handle(c *zmtpConn, frames [][]byte) {
+	msg, err := k.signer.decode(frames)
+	if err != nil {
+		return
+	}
+	k.dispatch(c, msg)
+}
+
+// dispatch handles a request, reporting that the kernel is busy while it
+// does.
+func (k *Kernel) dispatch(c *zmtpConn, msg *message) {
+	k.publish(msg, "status", status{State: "busy"})
+	defer k.publish(msg, "status", status{State: "idle"})
+
+	switch msg.header.Type {
+	case "kernel_info_request":
+		k.reply(c, msg, "kernel_info_reply", newKernelInfo())
+	case "execute_request":
+		k.execute(c, msg)
+	case "complete_request":
+		var req cursorRequest
+		json.Unmarshal(msg.content, &req)
+		k.reply(c, msg, "complete_reply", complete(&k.interpreter, req.Code, req.CursorPos))
+	case "inspect_request":
+		var req cursorRequest
+		json.Unmarshal(msg.content, &req)
+		k.reply(c, msg, "inspect_reply", inspect(k.interpreter.Env(), req.Code, req.CursorPos))
+	case "is_complete_request":
+		var req cursorRequest
+		json.Unmarshal(msg.content, &req)
+		k.reply(c, msg, "is_complete_reply", isComplete(req.Code))
+	case "comm_info_request":
+		k.reply(c, msg, "comm_info_reply", commInfo{Status: "ok", Comms: map[string]interface{}{}})
+	case "history_request":
+		k.reply(c, msg, "history_reply", history{Status: "ok", History: []interface{}{}})
+	case "interrupt_request":
+		k.interrupt()
+		k.reply(c, msg, "interrupt_reply", status{Status: "ok"})
+	case "shutdown_request":
+		var req shutdownRequest
+		json.Unmarshal(msg.content, &req)
+		k.reply(c, msg, "shutdown_reply", shutdownReply{Status: "ok", Restart: req.Restart})
+		k.Close()
+	}
+}
+
+func (k *Kernel) reply(c *zmtpConn, parent *message, typ string, content interface{}) {
+	msg := newMessage(k.session, typ, parent, content)
+	msg.identities = parent.identities
+	c.writeMessage(k.signer.encode(msg))
+}
+
+// publish publishes a message on IOPub with the topic as ipykernel does.
+func (k *Kernel) publish(parent *message, typ string, content interface{}) {
+	msg := newMessage(k.session, typ, parent, content)
+	msg.identities = [][]byte{[]byte("kernel." + k.session + "." + typ)}
+	k.iopub.broadcast(k.signer.encode(msg))
+}
+
+type status struct {
+	Status string `json:"status,omitempty"`
+	State  string `json:"execution_state,omitempty"`
+}
+
+type kernelInfo struct {
+	Status                string       `json:"status"`
+	ProtocolVersion       string       `json:"protocol_version"`
+	Implementation        string       `json:"implementation"`
+	ImplementationVersion string       `json:"implementation_version"`
+	LanguageInfo          languageInfo `json:"language_info"`
+	Banner                string       `json:"banner"`
+}
+
+type languageInfo struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	MIMEType      string `json:"mimetype"`
+	FileExtension string `json:"file_extension"`
+}
+
+func newKernelInfo() kernelInfo {
+	return kernelInfo{
+		Status:                "ok",
+		ProtocolVersion:       protocolVersion,
+		Implementation:        "warabi",
+		ImplementationVersion: "0.1.0",
+		LanguageInfo: languageInfo{
+			Name:          "go",
+			Version:       "1",
+			MIMEType:      "text/x-go",
+			FileExtension: ".go",
+		},
+		Banner: "warabi, an interpreter of Go",
+	}
+}
+
+type executeRequest struct {
+	Code   string `json:"code"`
+	Silent bool   `json:"silent"`
+}
+
+type executeInput struct {
+	Code           string `json:"code"`
+	ExecutionCount int    `json:"execution_count"`
+}
+
+type executeResult struct {
+	ExecutionCount int                    `json:"execution_count"`
+	Data           map[string]string      `json:"data"`
+	Metadata       map[string]interface{} `json:"metadata"`
+}
+
+type executeReply struct {
+	Status          string                 `json:"status"`
+	ExecutionCount  int                    `json:"execution_count"`
+	UserExpressions map[string]interface{} `json:"user_expressions,omitempty"`
+	Payload         []interface{}          `json:"payload,omitempty"`
+	executionError
+}
+
+type executionError struct {
+	Name      string   `json:"ename,omitempty"`
+	Value     string   `json:"evalue,omitempty"`
+	Traceback []string `json:"traceback,omitempty"`
+}
+
+type stream struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+// execute executes the code, publishing the input, what it prints and
+// the result or the error.
+func (k *Kernel) execute(c *zmtpConn, msg *message) {
+	var req executeRequest
+	json.Unmarshal(msg.content, &req)
+	if !req.Silent {
+		k.executionCount++
+		k.publish(msg, "execute_input", executeInput{
+			Code:           req.Code,
+			ExecutionCount: k.executionCount,
+		})
+	}
+
+	result, err := k.evaluate(msg, req.Code)
+	if err != nil {
+		execErr := executionError{
+			Name:      "error",
+			Value:     err.Error(),
+			Traceback: []string{err.Error()},
+		}
+		var runtimeErr *evaluator.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			execErr.Name = "panic"
+		}
+		k.publish(msg, "error", execErr)
+		k.reply(c, msg, "execute_reply", executeReply{
+			Status:         "error",
+			ExecutionCount: k.executionCount,
+			executionError: execErr,
+		})
+		return
+	}
+
+	if result != "" && !req.Silent {
+		k.publish(msg, "execute_result", executeResult{
+			ExecutionCount: k.executionCount,
+			Data:           map[string]string{"text/plain": result},
+			Metadata:       map[string]interface{}{},
+		})
+	}
+	k.reply(c, msg, "execute_reply", executeReply{
+		Status:          "ok",
+		ExecutionCount:  k.executionCount,
+		UserExpressions: map[string]interface{}{},
+		Payload:         []interface{}{},
+	})
+}
+
+// evaluate evaluates the code as an expression or declarations as
+// warabi -e does, publishing what it prints as stdout.
+func (k *Kernel) evaluate(parent *message, code string) (string, error) {
+	ctx, cancel := k.context()
+	k.mu.Lock()
+	k.cancel = cancel
+	k.executing = parent
+	k.mu.Unlock()
+	defer func() {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		k.cancel = nil
+		k.executing = nil
+		cancel()
+	}()
+
+	return k.interpreter.EvaluateSnippet(ctx, code)
+}
+
+func (k *Kernel) context() (context.Context, context.CancelFunc) {
+	if k.timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), k.timeout)
+}
+
+// streamWriter publishes what is printed in reply to the request
+// being executed.
+type streamWriter struct {
+	kernel *Kernel
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.kernel.mu.Lock()
+	parent := w.kernel.executing
+	w.kernel.mu.Unlock()
+	w.kernel.publish(parent, "stream", stream{
+		Name: "stdout",
+		Text: string(p),
+	})
+
+	return len(p), nil
+}
+
+// cursorRequest is the content of the requests about the code at the
+// cursor, which is counted in characters.
+type cursorRequest struct {
+	Code      string `json:"code"`
+	CursorPos int    `json:"cursor_pos"`
+}
+
+type completeReply struct {
+	Status      string                 `json:"status"`
+	Matches     []string               `json:"matches"`
+	CursorStart int                    `json:"cursor_start"`
+	CursorEnd   int                    `json:"cursor_end"`
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+// complete completes the identifier before the cursor as the REPL does.
+func complete(interpreter *evaluator.Interpreter, code string, cursor int) completeReply {
+	offset := byteOffset(code, cursor)
+	start := evaluator.IdentifierStart(code, offset)
+	matches := []string{}
+	for _, candidate := range interpreter.Complete(code, offset) {
+		matches = append(matches, candidate.Name)
+	}
+
+	return completeReply{
+		Status:      "ok",
+		Matches:     matches,
+		CursorStart: utf8.RuneCountInString(code[:start]),
+		CursorEnd:   cursor,
+		Metadata:    map[string]interface{}{},
+	}
+}
+
+type inspectReply struct {
+	Status   string                 `json:"status"`
+	Found    bool                   `json:"found"`
+	Data     map[string]string      `json:"data"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// inspect describes the variable at the cursor as :env of the REPL does.
+func inspect(env *object.Environment, code string, cursor int) inspectReply {
+	reply := inspectReply{
+		Status:   "ok",
+		Data:     map[string]string{},
+		Metadata: map[string]interface{}{},
+	}
+	start, end := evaluator.IdentifierAt(code, byteOffset(code, cursor))
+	name := code[start:end]
+	obj, ok := env.Get(name)
+	if name == "" || !ok {
+		return reply
+	}
+
+	reply.Found = true
+	switch {
+	case obj == nil:
+		reply.Data["text/plain"] = fmt.Sprintf("%s = <nil>", name)
+	case obj.Kind() == object.Function:
+		reply.Data["text/plain"] = fmt.Sprintf("%s %s", name, obj.Kind())
+	default:
+		reply.Data["text/plain"] = fmt.Sprintf("%s %s = %s", name, obj.Kind(), obj)
+	}
+	return reply
+}
+
+// byteOffset converts the cursor in characters into the offset in bytes.
+func byteOffset(code string, cursor int) int {
+	offset := 0
+	for i := 0; i < cursor && offset < len(code); i++ {
+		_, size := utf8.DecodeRuneInString(code[offset:])
+		offset += size
+	}
+
+	return offset
+}
+
+type isCompleteReply struct {
+	Status string `json:"status"`
+	Indent string `json:"indent,omitempty"`
+}
+
+// isComplete reports whether the code is complete as an expression or
+// declarations, or needs more lines, for which the parsers stop at
+// the end of the code.
+func isComplete(code string) isCompleteReply {
+	if strings.TrimSpace(code) == "" {
+		return isCompleteReply{Status: "complete"}
+	}
+	_, exprErr := parser.ParseExpr(code)
+	if exprErr == nil {
+		return isCompleteReply{Status: "complete"}
+	}
+	src := "package main\n" + code
+	_, fileErr := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if fileErr == nil {
+		return isCompleteReply{Status: "complete"}
+	}
+
+	if endsEarly(exprErr) || endsEarly(fileErr) {
+		return isCompleteReply{Status: "incomplete"}
+	}
+	return isCompleteReply{Status: "invalid"}
+}
+
+func endsEarly(err error) bool {
+	var errs scanner.ErrorList
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, err := range errs {
+		if strings.Contains(err.Msg, "EOF") || strings.Contains(err.Msg, "not terminated") {
+			return true
+		}
+	}
+
+	return false
+}
+
+type shutdownRequest struct {
+	Restart bool `json:"restart"`
+}
+
+type shutdownReply struct {
+	Status  string `json:"status"`
+	Restart bool   `json:"restart"`
+}
+
+type commInfo struct {
+	Status string                 `json:"status"`
+	Comms  map[string]interface{} `json:"comms"`
+}
+
+type history struct {
+	Status  string        `json:"status"`
+	History []interface{} `json:"history"`
+}
@@ -0,0 +1,246 @@
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomocy/warabi/evaluator"
+)
+
+func TestKernel(t *testing.T) {
+	k, err := Listen(ConnectionInfo{
+		Transport:       "tcp",
+		IP:              "127.0.0.1",
+		Key:             "secret",
+		SignatureScheme: "hmac-sha256",
+	}, evaluator.NewInterpreter(evaluator.TreeWalk))
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- k.Serve()
+	}()
+
+	c := &client{
+		t:       t,
+		signer:  signer{key: []byte("secret")},
+		session: newID(),
+	}
+	info := k.Info()
+	shell := c.dial(info.ShellPort, "DEALER")
+	control := c.dial(info.ControlPort, "DEALER")
+	heartbeat := c.dial(info.HeartbeatPort, "REQ")
+	c.iopub = c.dial(info.IOPubPort, "SUB")
+	c.iopub.writeMessage([][]byte{{1}})
+
+	req := c.request(shell, "kernel_info_request", struct{}{})
+	if got := c.expectReply(shell, "kernel_info_reply"); got["protocol_version"] != protocolVersion {
+		t.Errorf("unexpected kernel info: %v\n", got)
+	}
+	c.expectPublished(req, "status busy", "status idle")
+
+	heartbeat.writeMessage([][]byte{{}, []byte("ping")})
+	if got, err := heartbeat.readMessage(); err != nil || len(got) != 2 || string(got[1]) != "ping" {
+		t.Errorf("unexpected heartbeat: %q, %v\n", got, err)
+	}
+
+	tests := []struct {
+		code       string
+		wantReply  string
+		wantOutput []string
+	}{
+		{`import "fmt"`, "ok 1", []string{"status busy", "execute_input 1", "status idle"}},
+		{"var apple = 1 + 2", "ok 2", []string{"status busy", "execute_input 2", "execute_result 2 3", "status idle"}},
+		{`fmt.Println("apple:", apple)`, "ok 3", []string{"status busy", "execute_input 3", "stream apple: 3\n", "status idle"}},
+		{"banana", "error 4", []string{"status busy", "execute_input 4", "error main.go:1:1: undefined: banana", "status idle"}},
+	}
+	for _, test := range tests {
+		req := c.request(shell, "execute_request", map[string]interface{}{"code": test.code})
+		got := c.expectReply(shell, "execute_reply")
+		if got := fmt.Sprintf("%v %v", got["status"], got["execution_count"]); got != test.wantReply {
+			t.Errorf("unexpected reply of %q: got %s, expected %s\n", test.code, got, test.wantReply)
+		}
+		c.expectPublished(req, test.wantOutput...)
+	}
+
+	c.request(shell, "complete_request", map[string]interface{}{"code": "1 + ap", "cursor_pos": 6})
+	if got := c.expectReply(shell, "complete_reply"); fmt.Sprint(got["matches"], got["cursor_start"], got["cursor_end"]) != "[apple] 4 6" {
+		t.Errorf("unexpected completion: %v\n", got)
+	}
+	c.request(shell, "inspect_request", map[string]interface{}{"code": "apple * 2", "cursor_pos": 2})
+	if got := c.expectReply(shell, "inspect_reply"); fmt.Sprint(got["found"], got["data"]) != "true map[text/plain:apple int = 3]" {
+		t.Errorf("unexpected inspection: %v\n", got)
+	}
+	for code, want := range map[string]string{
+		"apple * 2":  "complete",
+		"func f() {": "incomplete",
+		"1 +":        "incomplete",
+		"}":          "invalid",
+	} {
+		c.request(shell, "is_complete_request", map[string]interface{}{"code": code})
+		if got := c.expectReply(shell, "is_complete_reply"); got["status"] != want {
+			t.Errorf("unexpected completeness of %q: got %v, expected %s\n", code, got["status"], want)
+		}
+	}
+
+	forged := c.signer.encode(newMessage(c.session, "kernel_info_request", nil, struct{}{}))
+	forged[1] = []byte("forged")
+	shell.writeMessage(forged)
+	c.request(shell, "comm_info_request", struct{}{})
+	c.expectReply(shell, "comm_info_reply")
+
+	huge := c.dial(info.ShellPort, "DEALER")
+	huge.conn.Write([]byte{frameLong, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if _, err := huge.readMessage(); err == nil {
+		t.Errorf("unexpected nil error of the connection sending a huge frame\n")
+	}
+	c.request(shell, "comm_info_request", struct{}{})
+	c.expectReply(shell, "comm_info_reply")
+
+	c.request(control, "execute_request", map[string]interface{}{"code": "var banana = 1"})
+	c.request(control, "kernel_info_request", struct{}{})
+	c.expectReply(control, "kernel_info_reply")
+	if _, ok := k.interpreter.Env().Get("banana"); ok {
+		t.Errorf("unexpected execution of the request on the control channel\n")
+	}
+
+	c.request(control, "shutdown_request", map[string]interface{}{"restart": false})
+	c.expectReply(control, "shutdown_reply")
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("unexpected error: %s\n", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("kernel is not shut down\n")
+	}
+}
+
+func TestIsComplete(t *testing.T) {
+	tests := map[string]string{
+		"":                   "complete",
+		"var a = 1":          "complete",
+		"var s = `raw":       "incomplete",
+		"func f() {\n\ta :=": "incomplete",
+		"var = 1":            "invalid",
+	}
+	for code, want := range tests {
+		if got := isComplete(code).Status; got != want {
+			t.Errorf("unexpected completeness of %q: got %s, expected %s\n", code, got, want)
+		}
+	}
+}
+
+// client is a client of Jupyter, which fails the test on what
+// it does not expect.
+type client struct {
+	t       *testing.T
+	signer  signer
+	session string
+	iopub   *zmtpConn
+}
+
+func (c *client) dial(port int, socketType string) *zmtpConn {
+	c.t.Helper()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	zc, err := dialZMTP(conn, socketType)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	return zc
+}
+
+func (c *client) request(conn *zmtpConn, typ string, content interface{}) *message {
+	c.t.Helper()
+
+	msg := newMessage(c.session, typ, nil, content)
+	if err := conn.writeMessage(c.signer.encode(msg)); err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	return msg
+}
+
+func (c *client) read(conn *zmtpConn) *message {
+	c.t.Helper()
+
+	frames, err := conn.readMessage()
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+	msg, err := c.signer.decode(frames)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	return msg
+}
+
+func (c *client) expectReply(conn *zmtpConn, typ string) map[string]interface{} {
+	c.t.Helper()
+
+	msg := c.read(conn)
+	if msg.header.Type != typ {
+		c.t.Fatalf("unexpected message: got %s, expected %s\n", msg.header.Type, typ)
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal(msg.content, &content); err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	return content
+}
+
+// expectPublished expects the messages published in reply to parent
+// until the kernel is idle.
+func (c *client) expectPublished(parent *message, want ...string) {
+	c.t.Helper()
+
+	var got []string
+	for {
+		msg := c.read(c.iopub)
+		var content map[string]interface{}
+		json.Unmarshal(msg.content, &content)
+		var desc string
+		switch msg.header.Type {
+		case "status":
+			desc = fmt.Sprintf("status %v", content["execution_state"])
+		case "execute_input":
+			desc = fmt.Sprintf("execute_input %v", content["execution_count"])
+		case "execute_result":
+			desc = fmt.Sprintf("execute_result %v %v", content["execution_count"], content["data"].(map[string]interface{})["text/plain"])
+		case "stream":
+			desc = fmt.Sprintf("stream %v", content["text"])
+		case "error":
+			desc = fmt.Sprintf("error %v", content["evalue"])
+		default:
+			desc = msg.header.Type
+		}
+		got = append(got, desc)
+
+		var parentHeader header
+		json.Unmarshal(msg.parent, &parentHeader)
+		if parentHeader.MessageID != parent.header.MessageID {
+			c.t.Fatalf("unexpected parent of %s: %s\n", desc, msg.parent)
+		}
+		if desc == "status idle" {
+			break
+		}
+	}
+
+	if got, want := strings.Join(got, "\n"), strings.Join(want, "\n"); got != want {
+		c.t.Errorf("unexpected messages:\n%s\nexpected:\n%s\n", got, want)
+	}
+}
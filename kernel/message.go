@@ -0,0 +1,134 @@
+package kernel
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// protocolVersion is the version of the Jupyter messaging protocol.
+const protocolVersion = "5.3"
+
+// delimiter separates the identities of a message from its signature
+// and its parts.
+const delimiter = "<IDS|MSG>"
+
+type header struct {
+	MessageID string `json:"msg_id"`
+	Session   string `json:"session"`
+	Username  string `json:"username"`
+	Date      string `json:"date"`
+	Type      string `json:"msg_type"`
+	Version   string `json:"version"`
+}
+
+// message is a message of the Jupyter messaging protocol. The parent
+// header and the content are kept raw as they are received.
+type message struct {
+	identities [][]byte
+	header     header
+	parent     json.RawMessage
+	metadata   json.RawMessage
+	content    json.RawMessage
+}
+
+var errInvalidSignature = errors.New("invalid signature")
+
+// signer signs and verifies messages with HMAC-SHA256, or does
+// nothing if the key is empty.
+type signer struct {
+	key []byte
+}
+
+func (s signer) sign(parts [][]byte) string {
+	if len(s.key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.key)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s signer) decode(frames [][]byte) (*message, error) {
+	i := 0
+	for i < len(frames) && string(frames[i]) != delimiter {
+		i++
+	}
+	if len(frames) < i+6 {
+		return nil, errors.New("malformed message")
+	}
+	parts := frames[i+2 : i+6]
+	if len(s.key) != 0 && !hmac.Equal([]byte(s.sign(parts)), frames[i+1]) {
+		return nil, errInvalidSignature
+	}
+
+	msg := &message{
+		identities: frames[:i],
+		parent:     parts[1],
+		metadata:   parts[2],
+		content:    parts[3],
+	}
+	if err := json.Unmarshal(parts[0], &msg.header); err != nil {
+		return nil, fmt.Errorf("malformed header: %s", err)
+	}
+
+	return msg, nil
+}
+
+func (s signer) encode(msg *message) [][]byte {
+	header, _ := json.Marshal(msg.header)
+	parts := [][]byte{header, orEmpty(msg.parent), orEmpty(msg.metadata), orEmpty(msg.content)}
+
+	frames := append([][]byte(nil), msg.identities...)
+	frames = append(frames, []byte(delimiter), []byte(s.sign(parts)))
+	return append(frames, parts...)
+}
+
+func orEmpty(raw json.RawMessage) []byte {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return []byte("{}")
+	}
+
+	return raw
+}
+
+// newMessage returns a message of typ in reply to parent, if any,
+// with the content.
+func newMessage(session, typ string, parent *message, content interface{}) *message {
+	msg := &message{
+		header: header{
+			MessageID: newID(),
+			Session:   session,
+			Username:  "warabi",
+			Date:      time.Now().UTC().Format(time.RFC3339Nano),
+			Type:      typ,
+			Version:   protocolVersion,
+		},
+	}
+	if parent != nil {
+		msg.header.Username = parent.header.Username
+		msg.parent, _ = json.Marshal(parent.header)
+	}
+	msg.content, _ = json.Marshal(content)
+
+	return msg
+}
+
+// newID returns a random UUID.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
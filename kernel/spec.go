@@ -0,0 +1,74 @@
+package kernel
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Name is the name of the kernel spec.
+const Name = "warabi"
+
+// Spec is the kernel spec, kernel.json, by which Jupyter starts kernels.
+type Spec struct {
+	Argv          []string `json:"argv"`
+	DisplayName   string   `json:"display_name"`
+	Language      string   `json:"language"`
+	InterruptMode string   `json:"interrupt_mode"`
+}
+
+// NewSpec returns the spec which starts the kernel with the executable
+// of warabi. Interrupts are requested as messages since the kernel does
+// not handle signals.
+func NewSpec(executable string) Spec {
+	return Spec{
+		Argv:          []string{executable, "kernel", "-f", "{connection_file}"},
+		DisplayName:   "Go (warabi)",
+		Language:      "go",
+		InterruptMode: "message",
+	}
+}
+
+// UserKernelsDir returns the directory where jupyter kernelspec install
+// --user installs kernel specs.
+func UserKernelsDir() (string, error) {
+	if dir := os.Getenv("JUPYTER_DATA_DIR"); dir != "" {
+		return filepath.Join(dir, "kernels"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Jupyter", "kernels"), nil
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "jupyter", "kernels"), nil
+	default:
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+			return filepath.Join(dir, "jupyter", "kernels"), nil
+		}
+		return filepath.Join(home, ".local", "share", "jupyter", "kernels"), nil
+	}
+}
+
+// InstallSpec writes the spec in the directory named after the kernel
+// in dir, and returns the directory.
+func InstallSpec(dir string, spec Spec) (string, error) {
+	dir = filepath.Join(dir, Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	src, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kernel.json"), append(src, '\n'), 0644); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
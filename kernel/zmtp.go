@@ -0,0 +1,332 @@
+package kernel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// zmtpConn is a connection of ZMTP 3.0, the wire protocol of ZeroMQ,
+// with the NULL mechanism, which is all Jupyter needs.
+type zmtpConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+	// established is closed when the handshake is done, which messages
+	// wait for.
+	established chan struct{}
+}
+
+const (
+	frameMore    = 0x01
+	frameLong    = 0x02
+	frameCommand = 0x04
+)
+
+// maxMessageSize bounds the frames of a message, which are read before
+// their signatures are checked.
+const maxMessageSize = 8 << 20
+
+// acceptZMTP shakes hands with a peer connecting to a socket of
+// socketType. It calls ready after it reads the metadata of the peer and
+// before it sends its own, so that the peer can not send messages before
+// ready returns.
+func acceptZMTP(conn net.Conn, socketType string, ready func(*zmtpConn)) (*zmtpConn, error) {
+	c := newZMTPConn(conn)
+	if err := c.writeGreeting(true); err != nil {
+		return nil, err
+	}
+	if err := c.readGreeting(); err != nil {
+		return nil, err
+	}
+	if err := c.readReady(); err != nil {
+		return nil, err
+	}
+	ready(c)
+	err := c.writeReady(socketType)
+	close(c.established)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// dialZMTP shakes hands with a socket which conn is connected to
+// as a socket of socketType.
+func dialZMTP(conn net.Conn, socketType string) (*zmtpConn, error) {
+	c := newZMTPConn(conn)
+	if err := c.writeGreeting(false); err != nil {
+		return nil, err
+	}
+	if err := c.readGreeting(); err != nil {
+		return nil, err
+	}
+	if err := c.writeReady(socketType); err != nil {
+		return nil, err
+	}
+	if err := c.readReady(); err != nil {
+		return nil, err
+	}
+	close(c.established)
+
+	return c, nil
+}
+
+func newZMTPConn(conn net.Conn) *zmtpConn {
+	return &zmtpConn{
+		conn:        conn,
+		r:           bufio.NewReader(conn),
+		established: make(chan struct{}),
+	}
+}
+
+// writeGreeting writes the signature, the version 3.0 and the NULL
+// mechanism, padded to 64 bytes.
+func (c *zmtpConn) writeGreeting(asServer bool) error {
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9] = 0xff, 0x7f
+	greeting[10], greeting[11] = 3, 0
+	copy(greeting[12:32], "NULL")
+	if asServer {
+		greeting[32] = 1
+	}
+
+	_, err := c.conn.Write(greeting)
+	return err
+}
+
+func (c *zmtpConn) readGreeting() error {
+	greeting := make([]byte, 64)
+	if _, err := io.ReadFull(c.r, greeting); err != nil {
+		return err
+	}
+	if greeting[0] != 0xff || greeting[9] != 0x7f {
+		return errors.New("zmtp: invalid signature")
+	}
+	if greeting[10] < 3 {
+		return fmt.Errorf("zmtp: unsupported version %d.%d", greeting[10], greeting[11])
+	}
+	if mechanism := string(bytes.TrimRight(greeting[12:32], "\x00")); mechanism != "NULL" {
+		return fmt.Errorf("zmtp: unsupported mechanism %s", mechanism)
+	}
+
+	return nil
+}
+
+func (c *zmtpConn) writeReady(socketType string) error {
+	var body bytes.Buffer
+	body.WriteByte(byte(len("READY")))
+	body.WriteString("READY")
+	body.WriteByte(byte(len("Socket-Type")))
+	body.WriteString("Socket-Type")
+	binary.Write(&body, binary.BigEndian, uint32(len(socketType)))
+	body.WriteString(socketType)
+
+	return c.writeFrame(frameCommand, body.Bytes())
+}
+
+func (c *zmtpConn) readReady() error {
+	flags, body, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	if flags&frameCommand == 0 || len(body) == 0 || len(body) < 1+int(body[0]) || string(body[1:1+int(body[0])]) != "READY" {
+		return errors.New("zmtp: no READY command")
+	}
+
+	return nil
+}
+
+// readMessage reads the frames of a message, skipping commands.
+func (c *zmtpConn) readMessage() ([][]byte, error) {
+	var frames [][]byte
+	var size int
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&frameCommand != 0 {
+			continue
+		}
+		size += len(body)
+		if maxMessageSize < size {
+			return nil, fmt.Errorf("zmtp: message larger than %d bytes", maxMessageSize)
+		}
+		frames = append(frames, body)
+		if flags&frameMore == 0 {
+			return frames, nil
+		}
+	}
+}
+
+func (c *zmtpConn) readFrame() (byte, []byte, error) {
+	flags, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var size uint64
+	if flags&frameLong != 0 {
+		if err := binary.Read(c.r, binary.BigEndian, &size); err != nil {
+			return 0, nil, err
+		}
+	} else {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if maxMessageSize < size {
+		return 0, nil, fmt.Errorf("zmtp: frame larger than %d bytes", maxMessageSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return flags, body, nil
+}
+
+func (c *zmtpConn) writeMessage(frames [][]byte) error {
+	<-c.established
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b bytes.Buffer
+	for i, frame := range frames {
+		var flags byte
+		if i != len(frames)-1 {
+			flags |= frameMore
+		}
+		appendFrame(&b, flags, frame)
+	}
+
+	_, err := c.conn.Write(b.Bytes())
+	return err
+}
+
+func (c *zmtpConn) writeFrame(flags byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b bytes.Buffer
+	appendFrame(&b, flags, body)
+	_, err := c.conn.Write(b.Bytes())
+	return err
+}
+
+func appendFrame(b *bytes.Buffer, flags byte, body []byte) {
+	if 255 < len(body) {
+		b.WriteByte(flags | frameLong)
+		binary.Write(b, binary.BigEndian, uint64(len(body)))
+	} else {
+		b.WriteByte(flags)
+		b.WriteByte(byte(len(body)))
+	}
+	b.Write(body)
+}
+
+// socket accepts peers of a ZeroMQ socket and passes the messages
+// from them to a handler.
+type socket struct {
+	typ      string
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	peers    map[*zmtpConn]bool
+	wg       sync.WaitGroup
+}
+
+func listen(addr, socketType string) (*socket, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &socket{
+		typ:      socketType,
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+		peers:    make(map[*zmtpConn]bool),
+	}, nil
+}
+
+func (s *socket) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// serve accepts peers until the socket is closed.
+func (s *socket) serve(handle func(c *zmtpConn, frames [][]byte)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.servePeer(conn, handle)
+		}()
+	}
+}
+
+func (s *socket) servePeer(conn net.Conn, handle func(c *zmtpConn, frames [][]byte)) {
+	var peer *zmtpConn
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.conns, conn)
+		delete(s.peers, peer)
+	}()
+	c, err := acceptZMTP(conn, s.typ, func(c *zmtpConn) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		peer = c
+		s.peers[c] = true
+	})
+	if err != nil {
+		return
+	}
+
+	for {
+		frames, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		if handle != nil {
+			handle(c, frames)
+		}
+	}
+}
+
+// broadcast sends the message to all the peers, as PUB sockets do to
+// the subscribers of any topics.
+func (s *socket) broadcast(frames [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.peers {
+		c.writeMessage(frames)
+	}
+}
+
+func (s *socket) close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
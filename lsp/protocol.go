@@ -0,0 +1,256 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/internal/baseprotocol"
+)
+
+// message is a request, a notification or a response of JSON-RPC 2.0.
+// A request has both the ID and the method, and a notification has only
+// the method.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// responseError is an error which a request fails with.
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+const (
+	codeInvalidParams        = -32602
+	codeMethodNotFound       = -32601
+	codeInternalError        = -32603
+	codeServerNotInitialized = -32002
+	codeInvalidRequest       = -32600
+)
+
+// writer writes messages from multiple goroutines.
+type writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *writer) respond(id json.RawMessage, result interface{}, err error) error {
+	resp := &response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+	if err != nil {
+		resp.Result = nil
+		resp.Error, _ = err.(*responseError)
+		if resp.Error == nil {
+			resp.Error = &responseError{
+				Code:    codeInternalError,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	return w.write(resp)
+}
+
+func (w *writer) notify(method string, params interface{}) error {
+	return w.write(&notification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+func (w *writer) write(msg interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return baseprotocol.WriteMessage(w.w, msg)
+}
+
+// position is a position in a document, whose character is counted
+// in UTF-16 code units.
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type versionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+	ServerInfo   serverInfo         `json:"serverInfo"`
+}
+
+type serverInfo struct {
+	Name string `json:"name"`
+}
+
+type serverCapabilities struct {
+	TextDocumentSync       textDocumentSyncOptions `json:"textDocumentSync"`
+	HoverProvider          bool                    `json:"hoverProvider"`
+	CompletionProvider     completionOptions       `json:"completionProvider"`
+	ExecuteCommandProvider executeCommandOptions   `json:"executeCommandProvider"`
+}
+
+type textDocumentSyncOptions struct {
+	OpenClose bool `json:"openClose"`
+	// Change is the kind of the synchronization, which is always full.
+	Change int `json:"change"`
+}
+
+const textDocumentSyncFull = 1
+
+type completionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+}
+
+type executeCommandOptions struct {
+	Commands []string `json:"commands"`
+}
+
+type didOpenTextDocumentParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type textDocumentContentChangeEvent struct {
+	Text string `json:"text"`
+}
+
+type didChangeTextDocumentParams struct {
+	TextDocument   versionedTextDocumentIdentifier  `json:"textDocument"`
+	ContentChanges []textDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type didCloseTextDocumentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+const severityError = 1
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     int          `json:"version,omitempty"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    *textRange    `json:"range,omitempty"`
+}
+
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+const (
+	completionItemFunction = 3
+	completionItemVariable = 6
+	completionItemModule   = 9
+	completionItemKeyword  = 14
+	completionItemConstant = 21
+)
+
+var completionItemKinds = map[evaluator.CandidateKind]int{
+	evaluator.CandidateVariable: completionItemVariable,
+	evaluator.CandidateFunction: completionItemFunction,
+	evaluator.CandidatePackage:  completionItemModule,
+	evaluator.CandidateConstant: completionItemConstant,
+	evaluator.CandidateKeyword:  completionItemKeyword,
+}
+
+type completionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []completionItem `json:"items"`
+}
+
+type executeCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments"`
+}
+
+// evaluateSelectionArguments is the argument of the command which
+// evaluates the code in the range of the document.
+type evaluateSelectionArguments struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Range        textRange              `json:"range"`
+}
+
+// evaluateSelectionResult is the result of the command, which fails
+// with Error rather than a response error.
+type evaluateSelectionResult struct {
+	Result string `json:"result"`
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+type logMessageParams struct {
+	Type    int    `json:"type"`
+	Message string `json:"message"`
+}
+
+const (
+	messageTypeError = 1
+	messageTypeLog   = 4
+)
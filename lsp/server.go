@@ -0,0 +1,514 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/internal/baseprotocol"
+	"github.com/tomocy/warabi/object"
+)
+
+// EvaluateSelection is the command which evaluates the code in a range
+// of a document after the document.
+const EvaluateSelection = "warabi.evaluateSelection"
+
+// Server serves the Language Server Protocol so that editors can treat
+// Go files as live notebooks: a file is evaluated whenever it changes,
+// and the values of its variables are shown on hover and completed.
+type Server struct {
+	interpreter evaluator.Interpreter
+	timeout     time.Duration
+}
+
+type Option func(*Server)
+
+// WithTimeout limits the time of each evaluation.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+// NewServer returns a server which evaluates each document in an
+// interpreter forked from interpreter.
+func NewServer(interpreter *evaluator.Interpreter, opts ...Option) *Server {
+	s := &Server{
+		interpreter: *interpreter,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Serve serves a client until it exits or r is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	conn := &connection{
+		server:    s,
+		w:         &writer{w: w},
+		documents: make(map[string]*document),
+	}
+
+	return conn.serve(bufio.NewReader(r))
+}
+
+func (s *Server) context() (context.Context, context.CancelFunc) {
+	if s.timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), s.timeout)
+}
+
+// connection is the state of a client, whose messages are handled one
+// by one.
+type connection struct {
+	server      *Server
+	w           *writer
+	initialized bool
+	shutdown    bool
+	documents   map[string]*document
+}
+
+// document is an open document, whose variables are evaluated in an
+// interpreter of its own.
+type document struct {
+	uri         string
+	filename    string
+	version     int
+	text        string
+	interpreter *evaluator.Interpreter
+	output      bytes.Buffer
+}
+
+type (
+	requestHandler      func(c *connection, params json.RawMessage) (interface{}, error)
+	notificationHandler func(c *connection, params json.RawMessage) error
+)
+
+var requestHandlers = map[string]requestHandler{
+	"initialize":               (*connection).initialize,
+	"shutdown":                 (*connection).shutdownServer,
+	"textDocument/hover":       (*connection).hover,
+	"textDocument/completion":  (*connection).complete,
+	"workspace/executeCommand": (*connection).executeCommand,
+}
+
+var notificationHandlers = map[string]notificationHandler{
+	"textDocument/didOpen":   (*connection).didOpen,
+	"textDocument/didChange": (*connection).didChange,
+	"textDocument/didClose":  (*connection).didClose,
+}
+
+var errExitedWithoutShutdown = errors.New("exited without shutdown")
+
+func (c *connection) serve(r *bufio.Reader) error {
+	for {
+		var msg message
+		if err := baseprotocol.ReadMessage(r, &msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case msg.Method == "exit":
+			if !c.shutdown {
+				return errExitedWithoutShutdown
+			}
+			return nil
+		case msg.Method == "":
+			// Responses are ignored since the server sends no requests.
+		case msg.ID == nil:
+			if err := c.handleNotification(msg); err != nil {
+				return err
+			}
+		default:
+			result, err := c.handleRequest(msg)
+			if err := c.w.respond(msg.ID, result, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *connection) handleRequest(msg message) (interface{}, error) {
+	switch {
+	case !c.initialized && msg.Method != "initialize":
+		return nil, &responseError{
+			Code:    codeServerNotInitialized,
+			Message: "server is not initialized",
+		}
+	case c.shutdown:
+		return nil, &responseError{
+			Code:    codeInvalidRequest,
+			Message: "server is shut down",
+		}
+	}
+
+	handle, ok := requestHandlers[msg.Method]
+	if !ok {
+		return nil, &responseError{
+			Code:    codeMethodNotFound,
+			Message: fmt.Sprintf("unsupported method: %s", msg.Method),
+		}
+	}
+
+	return handle(c, msg.Params)
+}
+
+// handleNotification handles the notification, logging the error of
+// the notification since it can not be responded.
+func (c *connection) handleNotification(msg message) error {
+	handle, ok := notificationHandlers[msg.Method]
+	if !ok || !c.initialized || c.shutdown {
+		return nil
+	}
+	if err := handle(c, msg.Params); err != nil {
+		return c.w.notify("window/logMessage", logMessageParams{
+			Type:    messageTypeError,
+			Message: fmt.Sprintf("%s: %s", msg.Method, err),
+		})
+	}
+
+	return nil
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{
+			Code:    codeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+func (c *connection) initialize(params json.RawMessage) (interface{}, error) {
+	if c.initialized {
+		return nil, &responseError{
+			Code:    codeInvalidRequest,
+			Message: "server is already initialized",
+		}
+	}
+	c.initialized = true
+
+	return initializeResult{
+		Capabilities: serverCapabilities{
+			TextDocumentSync: textDocumentSyncOptions{
+				OpenClose: true,
+				Change:    textDocumentSyncFull,
+			},
+			HoverProvider: true,
+			CompletionProvider: completionOptions{
+				TriggerCharacters: []string{"."},
+			},
+			ExecuteCommandProvider: executeCommandOptions{
+				Commands: []string{EvaluateSelection},
+			},
+		},
+		ServerInfo: serverInfo{
+			Name: "warabi",
+		},
+	}, nil
+}
+
+func (c *connection) shutdownServer(params json.RawMessage) (interface{}, error) {
+	c.shutdown = true
+	return nil, nil
+}
+
+func (c *connection) didOpen(params json.RawMessage) error {
+	var p didOpenTextDocumentParams
+	if err := decodeParams(params, &p); err != nil {
+		return err
+	}
+
+	doc := &document{
+		uri:      p.TextDocument.URI,
+		filename: filenameOf(p.TextDocument.URI),
+		version:  p.TextDocument.Version,
+		text:     p.TextDocument.Text,
+	}
+	c.documents[doc.uri] = doc
+	return c.evaluateDocument(doc)
+}
+
+func (c *connection) didChange(params json.RawMessage) error {
+	var p didChangeTextDocumentParams
+	if err := decodeParams(params, &p); err != nil {
+		return err
+	}
+	doc, err := c.document(p.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil
+	}
+
+	doc.version = p.TextDocument.Version
+	doc.text = p.ContentChanges[len(p.ContentChanges)-1].Text
+	return c.evaluateDocument(doc)
+}
+
+func (c *connection) didClose(params json.RawMessage) error {
+	var p didCloseTextDocumentParams
+	if err := decodeParams(params, &p); err != nil {
+		return err
+	}
+
+	delete(c.documents, p.TextDocument.URI)
+	return c.w.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []diagnostic{},
+	})
+}
+
+func (c *connection) document(uri string) (*document, error) {
+	doc, ok := c.documents[uri]
+	if !ok {
+		return nil, &responseError{
+			Code:    codeInvalidParams,
+			Message: fmt.Sprintf("unknown document: %s", uri),
+		}
+	}
+
+	return doc, nil
+}
+
+// filenameOf returns the path of a file URI, or the URI itself if it
+// does not name a file, for the positions in errors.
+func filenameOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return filepath.FromSlash(u.Path)
+}
+
+// evaluateDocument evaluates the document from scratch in a new
+// interpreter, publishing the errors as diagnostics and what it prints
+// as logs.
+func (c *connection) evaluateDocument(doc *document) error {
+	doc.interpreter = c.server.interpreter.Fork()
+	doc.interpreter.SetOutput(&doc.output)
+	doc.output.Reset()
+
+	ctx, cancel := c.server.context()
+	defer cancel()
+	_, err := doc.interpreter.EvaluateFile(ctx, doc.filename, []byte(doc.text))
+
+	if err := c.w.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: doc.diagnosticsOf(err),
+	}); err != nil {
+		return err
+	}
+	if doc.output.Len() == 0 {
+		return nil
+	}
+	return c.w.notify("window/logMessage", logMessageParams{
+		Type:    messageTypeLog,
+		Message: doc.output.String(),
+	})
+}
+
+// diagnosticsOf converts the error of the evaluation of the document
+// into diagnostics at the positions which it reports.
+func (doc *document) diagnosticsOf(err error) []diagnostic {
+	diagnostics := []diagnostic{}
+	if err == nil {
+		return diagnostics
+	}
+
+	var list scanner.ErrorList
+	if errors.As(err, &list) {
+		for _, err := range list {
+			diagnostics = append(diagnostics, doc.diagnostic(err.Pos.Line, err.Pos.Column, err.Msg))
+		}
+		return diagnostics
+	}
+
+	line, column, msg := doc.splitPosition(err.Error())
+	return append(diagnostics, doc.diagnostic(line, column, msg))
+}
+
+// splitPosition splits the position in the document at the head of msg
+// from msg. The position is the beginning of the document if msg has
+// none, as errors of limits do not.
+func (doc *document) splitPosition(msg string) (int, int, string) {
+	rest := strings.TrimPrefix(msg, doc.filename+":")
+	if rest == msg {
+		return 1, 1, msg
+	}
+	parts := strings.SplitN(rest, ":", 3)
+	if len(parts) != 3 {
+		return 1, 1, msg
+	}
+	line, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 1, 1, msg
+	}
+	column, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 1, 1, msg
+	}
+
+	return line, column, strings.TrimSpace(parts[2])
+}
+
+// diagnostic returns the diagnostic of msg on the identifier at
+// the line and the column, which are counted from 1 in bytes.
+func (doc *document) diagnostic(line, column int, msg string) diagnostic {
+	offset := offsetOfLineColumn(doc.text, line, column)
+	_, end := evaluator.IdentifierAt(doc.text, offset)
+	if end < offset {
+		end = offset
+	}
+
+	return diagnostic{
+		Range: textRange{
+			Start: positionOf(doc.text, offset),
+			End:   positionOf(doc.text, end),
+		},
+		Severity: severityError,
+		Source:   "warabi",
+		Message:  msg,
+	}
+}
+
+// hover shows the value of the variable at the position as :env of
+// the REPL does.
+func (c *connection) hover(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := c.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := evaluator.IdentifierAt(doc.text, offsetOf(doc.text, p.Position))
+	name := doc.text[start:end]
+	obj, ok := doc.interpreter.Env().Get(name)
+	if name == "" || !ok {
+		return nil, nil
+	}
+
+	return hover{
+		Contents: markupContent{
+			Kind:  "plaintext",
+			Value: describe(name, obj),
+		},
+		Range: &textRange{
+			Start: positionOf(doc.text, start),
+			End:   positionOf(doc.text, end),
+		},
+	}, nil
+}
+
+func describe(name string, obj object.Object) string {
+	if obj == nil {
+		return fmt.Sprintf("%s = <nil>", name)
+	}
+	if obj.Kind() == object.Function {
+		return fmt.Sprintf("%s %s", name, obj.Kind())
+	}
+
+	return fmt.Sprintf("%s %s = %s", name, obj.Kind(), obj)
+}
+
+// complete completes the identifier before the position with the names
+// in the environment of the document.
+func (c *connection) complete(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := c.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	list := completionList{
+		Items: []completionItem{},
+	}
+	for _, candidate := range doc.interpreter.Complete(doc.text, offsetOf(doc.text, p.Position)) {
+		list.Items = append(list.Items, completionItem{
+			Label:  candidate.Name,
+			Kind:   completionItemKinds[candidate.Kind],
+			Detail: candidate.Detail,
+		})
+	}
+
+	return list, nil
+}
+
+func (c *connection) executeCommand(params json.RawMessage) (interface{}, error) {
+	var p executeCommandParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Command != EvaluateSelection {
+		return nil, &responseError{
+			Code:    codeInvalidParams,
+			Message: fmt.Sprintf("unknown command: %s", p.Command),
+		}
+	}
+	if len(p.Arguments) != 1 {
+		return nil, &responseError{
+			Code:    codeInvalidParams,
+			Message: fmt.Sprintf("%s takes 1 argument", EvaluateSelection),
+		}
+	}
+	var args evaluateSelectionArguments
+	if err := decodeParams(p.Arguments[0], &args); err != nil {
+		return nil, err
+	}
+	doc, err := c.document(args.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := offsetOf(doc.text, args.Range.Start), offsetOf(doc.text, args.Range.End)
+	if end < start {
+		start, end = end, start
+	}
+	return doc.evaluate(c.server, doc.text[start:end]), nil
+}
+
+// evaluate evaluates the code as an expression or declarations as
+// warabi -e does, in the environment of the document.
+func (doc *document) evaluate(s *Server, code string) evaluateSelectionResult {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc.output.Reset()
+	var result evaluateSelectionResult
+	var err error
+	if result.Result, err = doc.interpreter.EvaluateSnippet(ctx, code); err != nil {
+		result.Error = err.Error()
+	}
+	result.Output = doc.output.String()
+
+	return result
+}
@@ -0,0 +1,335 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/internal/baseprotocol"
+)
+
+const scratchURI = "file:///scratch/main.go"
+
+const scratchSource = `package main
+
+import "fmt"
+
+// fmt.Println("banana:", banana)
+var apple = 1 + 2
+var banana = apple * cherry
+`
+
+func TestServer(t *testing.T) {
+	c := startClient(t)
+
+	c.request("textDocument/hover", nil)
+	if got := c.expectResponse(); got.Error == nil || got.Error.Code != codeServerNotInitialized {
+		t.Errorf("unexpected response before initialization: %+v\n", got)
+	}
+
+	c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	got := c.expectResponse()
+	if got, want := fmt.Sprint(got.Result["capabilities"]), "map[completionProvider:map[triggerCharacters:[.]] executeCommandProvider:map[commands:[warabi.evaluateSelection]] hoverProvider:true textDocumentSync:map[change:1 openClose:true]]"; got != want {
+		t.Errorf("unexpected capabilities: got %s, expected %s\n", got, want)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": scratchURI, "languageId": "go", "version": 1, "text": scratchSource},
+	})
+	if got, want := c.expectDiagnostics(), "1: 6:21-6:27 undefined: cherry"; got != want {
+		t.Errorf("unexpected diagnostics: got %s, expected %s\n", got, want)
+	}
+
+	fixed := strings.Replace(scratchSource, "cherry", "2", 1)
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": scratchURI, "version": 2},
+		"contentChanges": []interface{}{map[string]interface{}{"text": fixed}},
+	})
+	if got, want := c.expectDiagnostics(), "2:"; got != want {
+		t.Errorf("unexpected diagnostics: got %s, expected %s\n", got, want)
+	}
+
+	c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": scratchURI},
+		"position":     map[string]interface{}{"line": 6, "character": 15},
+	})
+	if got := c.expectResponse(); fmt.Sprint(got.Result["contents"]) != "map[kind:plaintext value:apple int = 3]" {
+		t.Errorf("unexpected hover: %+v\n", got)
+	}
+	c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": scratchURI},
+		"position":     map[string]interface{}{"line": 0, "character": 2},
+	})
+	if got := c.expectResponse(); got.Result != nil || got.Error != nil {
+		t.Errorf("unexpected hover: %+v\n", got)
+	}
+
+	c.request("textDocument/completion", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": scratchURI},
+		"position":     map[string]interface{}{"line": 6, "character": 5},
+	})
+	var labels []string
+	for _, item := range c.expectResponse().Result["items"].([]interface{}) {
+		item := item.(map[string]interface{})
+		labels = append(labels, fmt.Sprintf("%v(%v)", item["label"], item["kind"]))
+	}
+	if got, want := strings.Join(labels, " "), "banana(6) break(14)"; got != want {
+		t.Errorf("unexpected completion: got %s, expected %s\n", got, want)
+	}
+
+	c.request("textDocument/completion", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": scratchURI},
+		"position":     map[string]interface{}{"line": 4, "character": 9},
+	})
+	labels = nil
+	for _, item := range c.expectResponse().Result["items"].([]interface{}) {
+		item := item.(map[string]interface{})
+		labels = append(labels, fmt.Sprintf("%v(%v)", item["label"], item["kind"]))
+	}
+	if got, want := strings.Join(labels, " "), "Print(3) Printf(3) Println(3)"; got != want {
+		t.Errorf("unexpected completion after selector: got %s, expected %s\n", got, want)
+	}
+
+	tests := []struct {
+		start, end []int
+		want       string
+	}{
+		{[]int{6, 13}, []int{6, 22}, "map[output: result:6]"},
+		{[]int{4, 3}, []int{4, 33}, "map[output:banana: 6\n result:]"},
+		{[]int{6, 4}, []int{6, 12}, "map[error:main.go:2:1: expected declaration, found banana output: result:]"},
+	}
+	for _, test := range tests {
+		c.request("workspace/executeCommand", map[string]interface{}{
+			"command": EvaluateSelection,
+			"arguments": []interface{}{map[string]interface{}{
+				"textDocument": map[string]interface{}{"uri": scratchURI},
+				"range": map[string]interface{}{
+					"start": map[string]interface{}{"line": test.start[0], "character": test.start[1]},
+					"end":   map[string]interface{}{"line": test.end[0], "character": test.end[1]},
+				},
+			}},
+		})
+		if got := fmt.Sprint(c.expectResponse().Result); got != test.want {
+			t.Errorf("unexpected result of %v-%v: got %q, expected %q\n", test.start, test.end, got, test.want)
+		}
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": scratchURI, "version": 3},
+		"contentChanges": []interface{}{map[string]interface{}{"text": "package main\n\nvar = 1\n"}},
+	})
+	if got, want := c.expectDiagnostics(), "3: 2:4-2:4 expected 'IDENT', found '='"; got != want {
+		t.Errorf("unexpected diagnostics: got %s, expected %s\n", got, want)
+	}
+
+	c.request("textDocument/definition", map[string]interface{}{})
+	if got := c.expectResponse(); got.Error == nil || got.Error.Code != codeMethodNotFound {
+		t.Errorf("unexpected response of unsupported method: %+v\n", got)
+	}
+
+	c.notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": scratchURI},
+	})
+	if got, want := c.expectDiagnostics(), "0:"; got != want {
+		t.Errorf("unexpected diagnostics: got %s, expected %s\n", got, want)
+	}
+
+	c.request("shutdown", nil)
+	c.expectResponse()
+	c.notify("exit", nil)
+	c.close()
+}
+
+func TestText(t *testing.T) {
+	text := "a := \"日本\"\n𝔸 = 1\n"
+	tests := []struct {
+		pos    position
+		offset int
+	}{
+		{position{0, 0}, 0},
+		{position{0, 7}, 9},
+		{position{0, 9}, 13},
+		{position{1, 2}, 18},
+		{position{1, 3}, 19},
+		{position{2, 0}, 23},
+	}
+	for _, test := range tests {
+		if got := offsetOf(text, test.pos); got != test.offset {
+			t.Errorf("unexpected offset of %v: got %d, expected %d\n", test.pos, got, test.offset)
+		}
+		if got := positionOf(text, test.offset); got != test.pos {
+			t.Errorf("unexpected position of %d: got %v, expected %v\n", test.offset, got, test.pos)
+		}
+	}
+
+	if got := offsetOf(text, position{0, 100}); got != 13 {
+		t.Errorf("unexpected offset beyond the line: %d\n", got)
+	}
+	if got := offsetOfLineColumn(text, 2, 6); got != 19 {
+		t.Errorf("unexpected offset of 2:6: %d\n", got)
+	}
+}
+
+type received struct {
+	ID     json.RawMessage        `json:"id"`
+	Method string                 `json:"method"`
+	Result map[string]interface{} `json:"result"`
+	Error  *responseError         `json:"error"`
+	Params publishDiagnosticsParams
+}
+
+// client is a client of the Language Server Protocol, which fails
+// the test on what it does not expect.
+type client struct {
+	t    *testing.T
+	w    io.WriteCloser
+	r    *bufio.Reader
+	done chan error
+	id   int
+}
+
+func startClient(t *testing.T) *client {
+	requestR, requestW := io.Pipe()
+	responseR, responseW := io.Pipe()
+	c := &client{
+		t:    t,
+		w:    requestW,
+		r:    bufio.NewReader(responseR),
+		done: make(chan error, 1),
+	}
+	go func() {
+		err := NewServer(evaluator.NewInterpreter(evaluator.TreeWalk), WithTimeout(5*time.Second)).Serve(requestR, responseW)
+		responseW.Close()
+		c.done <- err
+	}()
+
+	return c
+}
+
+func (c *client) request(method string, params interface{}) {
+	c.t.Helper()
+
+	c.id++
+	c.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.id,
+		"method":  method,
+		"params":  params,
+	})
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+
+	c.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+func (c *client) write(msg interface{}) {
+	c.t.Helper()
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+}
+
+// expectMessage returns the next message other than logs, which are
+// ignored.
+func (c *client) expectMessage() received {
+	c.t.Helper()
+
+	messages := make(chan received)
+	errs := make(chan error)
+	go func() {
+		for {
+			var raw json.RawMessage
+			if err := baseprotocol.ReadMessage(c.r, &raw); err != nil {
+				errs <- err
+				return
+			}
+			var msg received
+			json.Unmarshal(raw, &msg)
+			if msg.Method == "window/logMessage" {
+				continue
+			}
+			if msg.Method == "textDocument/publishDiagnostics" {
+				var params struct {
+					Params publishDiagnosticsParams `json:"params"`
+				}
+				json.Unmarshal(raw, &params)
+				msg.Params = params.Params
+			}
+			messages <- msg
+			return
+		}
+	}()
+
+	select {
+	case msg := <-messages:
+		return msg
+	case err := <-errs:
+		c.t.Fatalf("unexpected error: %s\n", err)
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("no message is received\n")
+	}
+
+	return received{}
+}
+
+func (c *client) expectResponse() received {
+	c.t.Helper()
+
+	msg := c.expectMessage()
+	if string(msg.ID) != fmt.Sprint(c.id) {
+		c.t.Fatalf("unexpected message: got %+v, expected response of %d\n", msg, c.id)
+	}
+
+	return msg
+}
+
+// expectDiagnostics returns the published diagnostics in the form of
+// "version: line:character-line:character message, ...".
+func (c *client) expectDiagnostics() string {
+	c.t.Helper()
+
+	msg := c.expectMessage()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("unexpected message: got %+v, expected diagnostics\n", msg)
+	}
+	descs := make([]string, len(msg.Params.Diagnostics))
+	for i, d := range msg.Params.Diagnostics {
+		descs[i] = fmt.Sprintf(
+			" %d:%d-%d:%d %s",
+			d.Range.Start.Line, d.Range.Start.Character, d.Range.End.Line, d.Range.End.Character, d.Message,
+		)
+	}
+
+	return fmt.Sprintf("%d:%s", msg.Params.Version, strings.Join(descs, ","))
+}
+
+func (c *client) close() {
+	c.t.Helper()
+
+	c.w.Close()
+	select {
+	case err := <-c.done:
+		if err != nil {
+			c.t.Errorf("unexpected error: %s\n", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Errorf("server is not exited\n")
+	}
+}
@@ -0,0 +1,74 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// offsetOf returns the byte offset of the position in text, clamping it
+// to the line and to the text.
+func offsetOf(text string, pos position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i == -1 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+
+	for units := 0; units < pos.Character && offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+
+	return offset
+}
+
+// positionOf returns the position of the byte offset in text.
+func positionOf(text string, offset int) position {
+	if len(text) < offset {
+		offset = len(text)
+	}
+	line := strings.Count(text[:offset], "\n")
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+
+	character := 0
+	for _, r := range text[lineStart:offset] {
+		character += utf16.RuneLen(r)
+	}
+
+	return position{
+		Line:      line,
+		Character: character,
+	}
+}
+
+// offsetOfLineColumn returns the byte offset of the line and the column
+// in text, which are counted from 1 in bytes as token.Position does.
+func offsetOfLineColumn(text string, line, column int) int {
+	if column < 1 {
+		column = 1
+	}
+	offset := 0
+	for ; 1 < line; line-- {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i == -1 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+	if end := strings.IndexByte(text[offset:], '\n'); end != -1 && end < column-1 {
+		return offset + end
+	}
+	if len(text) < offset+column-1 {
+		return len(text)
+	}
+
+	return offset + column - 1
+}
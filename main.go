@@ -1,13 +1,799 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/tomocy/warabi/dap"
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/kernel"
+	"github.com/tomocy/warabi/lsp"
+	"github.com/tomocy/warabi/playground"
 	"github.com/tomocy/warabi/repl"
 )
 
+const usage = `Usage:
+
+	warabi [flags] [--session file]    start the interactive REPL
+	warabi [flags] --record out.txt    start the interactive REPL, recording the transcript in out.txt
+	warabi [flags] -e src              evaluate src and print the result
+	warabi run [flags] path [args]     run the main package in the directory or file at path
+	warabi test [flags] [packages]     test the packages in the directories, where dir/... matches the ones under dir
+	warabi cover -html c.out [-o out]  write the HTML of the coverage profile c.out as go tool cover does
+	warabi ast [file.go]               print the AST of file.go, or start the AST REPL
+	warabi dap [flags]                 serve the Debug Adapter Protocol on stdin and stdout, or on --listen addr
+	warabi kernel -f conn.json         serve a Jupyter kernel on the ports in the connection file
+	warabi kernel install [--dir dir]  install the Jupyter kernel spec for the user, or in dir
+	warabi serve [flags]               serve the playground over HTTP on --listen addr
+	warabi lsp [flags]                 serve the Language Server Protocol on stdin and stdout
+	warabi replay out.txt [--check]    evaluate the inputs of the transcript out.txt and print the new one, or check the outputs
+
+Flags:
+`
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitPanic = 2
+	exitUsage = 2
+)
+
 func main() {
-	repler := repl.NewStandard(os.Stdin, os.Stdout)
-	// repler := repl.NewWarabi(os.Stdin, os.Stdout)
-	repler.REPL()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type options struct {
+	backend string
+	timeout time.Duration
+	src     string
+	trace   bool
+}
+
+func newFlagSet(name string, opts *options, w io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(w)
+	flags.Usage = func() {
+		fmt.Fprint(w, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.backend, "backend", opts.backend, "evaluation backend: tree-walk, vm or closure")
+	flags.DurationVar(&opts.timeout, "timeout", opts.timeout, "time limit of each evaluation (0 means no limit)")
+	flags.StringVar(&opts.src, "e", opts.src, "evaluate `src` and print the result")
+	flags.BoolVar(&opts.trace, "trace", opts.trace, "print an execution trace to stderr, evaluating on the tree-walk backend")
+
+	return flags
+}
+
+func (opts options) context() (context.Context, context.CancelFunc) {
+	if opts.timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), opts.timeout)
+}
+
+func run(args []string, r io.Reader, w, errW io.Writer) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(errW, "panic: %v\n", r)
+			code = exitPanic
+		}
+	}()
+
+	opts := options{
+		backend: evaluator.TreeWalk.String(),
+	}
+	flags := newFlagSet("warabi", &opts, errW)
+	var session string
+	flags.StringVar(&session, "session", "", "restore the REPL session saved in `file`, and save the session to it on quitting")
+	var record string
+	flags.StringVar(&record, "record", "", "record the inputs and the outputs of the REPL in the transcript `file`")
+	var noColor bool
+	flags.BoolVar(&noColor, "no-color", false, "write no colors in the REPL, as NO_COLOR does")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+	args = flags.Args()
+
+	if len(args) != 0 {
+		switch args[0] {
+		case "run":
+			return runFile(args[1:], opts, w, errW)
+		case "test":
+			return test(args[1:], opts, w, errW)
+		case "cover":
+			return cover(args[1:], opts, w, errW)
+		case "ast":
+			return printAST(args[1:], r, w, errW)
+		case "dap":
+			return serveDAP(args[1:], opts, r, w, errW)
+		case "kernel":
+			return serveKernel(args[1:], opts, w, errW)
+		case "serve":
+			return servePlayground(args[1:], opts, errW)
+		case "lsp":
+			return serveLSP(args[1:], opts, r, w, errW)
+		case "replay":
+			return replay(args[1:], opts, w, errW)
+		default:
+			fmt.Fprintf(errW, "unknown command: %s\n", args[0])
+			return exitUsage
+		}
+	}
+
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	if opts.src != "" {
+		return evaluate(interpreter, opts, w, errW)
+	}
+
+	replOpts := []repl.Option{repl.WithInterpreter(interpreter), repl.WithTimeout(opts.timeout)}
+	if home, err := os.UserHomeDir(); err == nil {
+		replOpts = append(replOpts, repl.WithHistory(filepath.Join(home, ".warabi_history")))
+	}
+	if session != "" {
+		replOpts = append(replOpts, repl.WithSession(session))
+	}
+	if noColor {
+		replOpts = append(replOpts, repl.WithoutColor())
+	}
+	if record != "" {
+		file, err := os.Create(record)
+		if err != nil {
+			fmt.Fprintln(errW, err)
+			return exitError
+		}
+		defer file.Close()
+		replOpts = append(replOpts, repl.WithTranscript(file))
+	}
+	repl.NewWarabi(r, w, replOpts...).REPL()
+	return exitOK
+}
+
+func exitCodeOfFlagError(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+
+	return exitUsage
+}
+
+// interpreter returns the interpreter of the options, which traces
+// evaluations to traceW if they are traced.
+func (opts options) interpreter(traceW io.Writer) (*evaluator.Interpreter, error) {
+	backend, err := evaluator.ParseBackend(opts.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	interpreter := evaluator.NewInterpreter(backend)
+	if opts.trace {
+		interpreter.AddObserver(evaluator.NewTracer(traceW))
+	}
+	return interpreter, nil
+}
+
+func evaluate(interpreter *evaluator.Interpreter, opts options, w, errW io.Writer) int {
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	result, err := interpreter.EvaluateSnippet(ctx, opts.src)
+	if err != nil {
+		return reportError(err, errW)
+	}
+	if result != "" {
+		fmt.Fprintln(w, result)
+	}
+	return exitOK
+}
+
+func runFile(args []string, opts options, w, errW io.Writer) int {
+	flags := newFlagSet("run", &opts, errW)
+	var coverOpts coverOptions
+	coverOpts.addFlags(flags)
+	var cpuProfile string
+	flags.StringVar(&cpuProfile, "cpuprofile", "", "write the CPU profile of the interpreted functions to `file`, evaluating on the tree-walk backend")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	interpreter.SetOutput(w)
+	interpreter.SetArgs(flags.Args())
+	coverage, err := coverOpts.coverage()
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	if coverage != nil {
+		if err := coverProgram(coverage, flags.Arg(0)); err != nil {
+			fmt.Fprintln(errW, err)
+			return exitError
+		}
+		interpreter.AddObserver(coverage)
+		defer func() {
+			if err := coverOpts.writeProfile(coverage); err != nil {
+				fmt.Fprintln(errW, err)
+			}
+		}()
+	}
+	if cpuProfile != "" {
+		profiler := evaluator.NewCPUProfiler()
+		interpreter.AddObserver(profiler)
+		defer func() {
+			if err := writeCPUProfile(profiler, cpuProfile); err != nil {
+				fmt.Fprintln(errW, err)
+			}
+		}()
+	}
+	ctx, cancel := opts.context()
+	defer cancel()
+	if err := runPackageOrFile(ctx, interpreter, flags.Arg(0)); err != nil {
+		return reportError(err, errW)
+	}
+
+	return exitOK
+}
+
+// reportError reports the error of an evaluation, which exits as a
+// panicking Go program does if it is a panic or a runtime error, as one
+// exceeding its stack does if it is a stack overflow, and with the code
+// of os.Exit if it is called.
+func reportError(err error, errW io.Writer) int {
+	var exitErr *evaluator.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	var panicErr *evaluator.PanicError
+	if errors.As(err, &panicErr) {
+		fmt.Fprintf(errW, "%s\n\ngoroutine 1 [running]:\n", panicErr)
+		// Each function is at the position of the call it is making,
+		// which the next frame has.
+		frames := panicErr.Frames
+		for i := len(frames) - 1; 0 < i; i-- {
+			position := frames[i].Position
+			fmt.Fprintf(errW, "main.%s(...)\n\t%s:%d\n", frames[i-1].Function, position.Filename, position.Line)
+		}
+		return exitPanic
+	}
+	var runtimeErr *evaluator.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		fmt.Fprintf(errW, "panic: runtime error: %s\n\n%s\n", runtimeErr.Message, runtimeErr.Pos)
+		return exitPanic
+	}
+	var overflowErr *evaluator.StackOverflowError
+	var valueOverflowErr *evaluator.ValueStackOverflowError
+	if errors.As(err, &overflowErr) || errors.As(err, &valueOverflowErr) {
+		fmt.Fprintf(errW, "runtime: %s\nfatal error: stack overflow\n", err)
+		return exitPanic
+	}
+	fmt.Fprintln(errW, err)
+	return exitError
+}
+
+func runPackageOrFile(ctx context.Context, interpreter *evaluator.Interpreter, name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return interpreter.RunPackage(ctx, name)
+	}
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	return interpreter.RunFile(ctx, name, src)
+}
+
+func test(args []string, opts options, w, errW io.Writer) int {
+	var testOpts evaluator.TestOptions
+	flags := newFlagSet("test", &opts, errW)
+	flags.StringVar(&testOpts.Run, "run", "", "run only the tests, examples and fuzz targets matching `regexp`")
+	flags.StringVar(&testOpts.Bench, "bench", "", "run only the benchmarks matching `regexp`")
+	flags.DurationVar(&testOpts.Benchtime, "benchtime", time.Second, "run each benchmark for duration `d`")
+	flags.BoolVar(&testOpts.Verbose, "v", false, "report all the tests as they are run")
+	flags.BoolVar(&testOpts.JSON, "json", false, "report in JSON as go test -json does")
+	var coverOpts coverOptions
+	flags.BoolVar(&coverOpts.cover, "cover", false, "report the coverage of statements by the tests")
+	coverOpts.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	dirs, err := expandPackagePatterns(patterns)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+
+	testOpts.Coverage, err = coverOpts.coverage()
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, dir := range dirs {
+		ctx, cancel := opts.context()
+		passed, err := interpreter.Test(ctx, dir, w, testOpts)
+		cancel()
+		if err != nil {
+			fmt.Fprintln(errW, err)
+			fmt.Fprintf(w, "FAIL\t%s [setup failed]\n", dir)
+		}
+		if err != nil || !passed {
+			code = exitError
+		}
+	}
+	if 1 < len(dirs) && code != exitOK {
+		fmt.Fprintln(w, "FAIL")
+	}
+	if err := coverOpts.writeProfile(testOpts.Coverage); err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+
+	return code
+}
+
+// expandPackagePatterns expands the patterns of dir/... into
+// the directories under dir which have test files.
+func expandPackagePatterns(patterns []string) ([]string, error) {
+	var dirs []string
+	for _, pattern := range patterns {
+		if pattern != "..." && !strings.HasSuffix(pattern, "/...") {
+			dirs = append(dirs, pattern)
+			continue
+		}
+
+		root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		if root == "" {
+			root = "."
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := info.Name()
+			if info.IsDir() {
+				if path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(name, "_test.go") {
+				dir := filepath.Dir(path)
+				if len(dirs) == 0 || dirs[len(dirs)-1] != dir {
+					dirs = append(dirs, dir)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dirs, nil
+}
+
+func serveKernel(args []string, opts options, w, errW io.Writer) int {
+	if len(args) != 0 && args[0] == "install" {
+		return installKernel(args[1:], opts, w, errW)
+	}
+
+	var connectionFile string
+	flags := newFlagSet("kernel", &opts, errW)
+	flags.StringVar(&connectionFile, "f", "", "read the ports and the key from the connection `file`")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+	if connectionFile == "" {
+		flags.Usage()
+		return exitUsage
+	}
+
+	info, err := kernel.ReadConnectionInfo(connectionFile)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	k, err := kernel.Listen(info, interpreter, kernel.WithTimeout(opts.timeout))
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	if err := k.Serve(); err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+func installKernel(args []string, opts options, w, errW io.Writer) int {
+	var dir string
+	flags := newFlagSet("kernel install", &opts, errW)
+	flags.StringVar(&dir, "dir", "", "install the kernel spec in `dir` instead of the kernels directory of the user")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+
+	if dir == "" {
+		var err error
+		dir, err = kernel.UserKernelsDir()
+		if err != nil {
+			fmt.Fprintln(errW, err)
+			return exitError
+		}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	installed, err := kernel.InstallSpec(dir, kernel.NewSpec(executable))
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	fmt.Fprintf(w, "installed the kernel spec in %s\n", installed)
+
+	return exitOK
+}
+
+func servePlayground(args []string, opts options, errW io.Writer) int {
+	var (
+		addr        string
+		idleTimeout time.Duration
+		maxSessions int
+		limits      evaluator.Limits
+		allowed     string
+	)
+	if opts.timeout == 0 {
+		opts.timeout = 5 * time.Second
+	}
+	flags := newFlagSet("serve", &opts, errW)
+	flags.StringVar(&addr, "listen", "localhost:8080", "serve the playground on `addr`")
+	flags.DurationVar(&idleTimeout, "idle", 10*time.Minute, "expire the sessions idle for the `duration`")
+	flags.IntVar(&maxSessions, "max-sessions", 1000, "limit of the sessions alive at once (0 means no limit)")
+	flags.IntVar(&limits.MaxSteps, "max-steps", 10000000, "step limit of each evaluation (0 means no limit)")
+	flags.IntVar(&limits.MaxDepth, "max-depth", 1000, "call depth limit of each evaluation (0 means no limit)")
+	flags.IntVar(&limits.MaxAllocation, "max-allocation", 64<<20, "limit in bytes of the strings built by each evaluation (0 means no limit)")
+	flags.StringVar(&allowed, "allow", "fmt", "comma-separated `packages` which sessions can import")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	limits.AllowedPackages = []string{}
+	for _, path := range strings.Split(allowed, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			limits.AllowedPackages = append(limits.AllowedPackages, path)
+		}
+	}
+
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	server := playground.NewServer(
+		interpreter,
+		playground.WithLimits(limits),
+		playground.WithTimeout(opts.timeout),
+		playground.WithIdleTimeout(idleTimeout),
+		playground.WithMaxSessions(maxSessions),
+	)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	fmt.Fprintf(errW, "serving the playground on http://%s\n", listener.Addr())
+	if err := http.Serve(listener, server); err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+func serveLSP(args []string, opts options, r io.Reader, w, errW io.Writer) int {
+	if opts.timeout == 0 {
+		opts.timeout = 5 * time.Second
+	}
+	flags := newFlagSet("lsp", &opts, errW)
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	if err := lsp.NewServer(interpreter, lsp.WithTimeout(opts.timeout)).Serve(r, w); err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// replay evaluates the inputs of the transcript in a new session.
+// With --check, it fails if the outputs differ from the recorded ones
+// rather than prints the new transcript.
+func replay(args []string, opts options, w, errW io.Writer) int {
+	flags := newFlagSet("replay", &opts, errW)
+	var check bool
+	flags.BoolVar(&check, "check", false, "fail if the outputs differ from the ones in the transcript")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	// The flags may follow the transcript as in replay out.txt --check.
+	filename := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	defer file.Close()
+	entries, err := repl.ReadTranscript(file)
+	if err != nil {
+		fmt.Fprintf(errW, "%s: %s\n", filename, err)
+		return exitError
+	}
+
+	replayed := repl.Replay(entries, repl.WithInterpreter(interpreter), repl.WithTimeout(opts.timeout))
+	if !check {
+		if err := repl.WriteTranscript(w, replayed); err != nil {
+			fmt.Fprintln(errW, err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	code := exitOK
+	for i, entry := range replayed {
+		if entry.Output == entries[i].Output {
+			continue
+		}
+		fmt.Fprintf(
+			errW, "%s:%d: unexpected output of %q\n--- expected\n%s+++ got\n%s",
+			filename, entry.Line, entry.Input, entries[i].Output, entry.Output,
+		)
+		code = exitError
+	}
+	if code == exitOK {
+		fmt.Fprintf(w, "ok\t%s\t%d entries\n", filename, len(entries))
+	}
+
+	return code
+}
+
+type coverOptions struct {
+	cover   bool
+	profile string
+	mode    string
+}
+
+func (opts *coverOptions) addFlags(flags *flag.FlagSet) {
+	flags.StringVar(&opts.profile, "coverprofile", "", "write the coverage profile to `file`")
+	flags.StringVar(&opts.mode, "covermode", "", "cover mode: set, count or atomic (default set)")
+}
+
+// coverage returns the coverage to measure, or nil if it is not measured.
+func (opts coverOptions) coverage() (*evaluator.Coverage, error) {
+	if !opts.cover && opts.profile == "" && opts.mode == "" {
+		return nil, nil
+	}
+	mode := opts.mode
+	if mode == "" {
+		mode = "set"
+	}
+
+	return evaluator.NewCoverage(mode)
+}
+
+func (opts coverOptions) writeProfile(coverage *evaluator.Coverage) error {
+	if coverage == nil || opts.profile == "" {
+		return nil
+	}
+
+	file, err := os.Create(opts.profile)
+	if err != nil {
+		return err
+	}
+	if err := coverage.WriteProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeCPUProfile(profiler *evaluator.CPUProfiler, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := profiler.WriteProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func coverProgram(coverage *evaluator.Coverage, name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return coverage.AddPackage(name)
+	}
+
+	return coverage.AddFile(name)
+}
+
+func cover(args []string, opts options, w, errW io.Writer) int {
+	flags := newFlagSet("cover", &opts, errW)
+	profile := flags.String("html", "", "write the HTML of the coverage profile `file`")
+	out := flags.String("o", "", "write the HTML to `file` instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+	if *profile == "" {
+		flags.Usage()
+		return exitUsage
+	}
+
+	r, err := os.Open(*profile)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	defer r.Close()
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(errW, err)
+			return exitError
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := evaluator.WriteCoverageHTML(w, r); err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+func printAST(args []string, r io.Reader, w, errW io.Writer) int {
+	if len(args) == 0 {
+		repl.NewStandard(r, w).REPL()
+		return exitOK
+	}
+
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, args[0], nil, parser.ParseComments)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	if err := ast.Fprint(w, fileSet, file, ast.NotNilFilter); err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// serveDAP serves a client on stdin and stdout, or the first one which
+// connects to the address to listen on.
+func serveDAP(args []string, opts options, r io.Reader, w, errW io.Writer) int {
+	var addr string
+	flags := newFlagSet("dap", &opts, errW)
+	flags.StringVar(&addr, "listen", "", "serve a client connecting to `addr` instead of stdin and stdout")
+	if err := flags.Parse(args); err != nil {
+		return exitCodeOfFlagError(err)
+	}
+
+	interpreter, err := opts.interpreter(errW)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitUsage
+	}
+	server := dap.NewServer(interpreter)
+	if addr == "" {
+		if err := server.Serve(r, w); err != nil {
+			fmt.Fprintln(errW, err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	fmt.Fprintf(errW, "listening on %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	defer conn.Close()
+
+	if err := server.Serve(conn, conn); err != nil {
+		fmt.Fprintln(errW, err)
+		return exitError
+	}
+	return exitOK
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := os.MkdirTemp("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, src string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+		return filename
+	}
+	mainFile := write("main.go", "package main\n\nvar a = 1\n\nfunc main() {\n\tvar b = a + 1\n}\n")
+	noMainFile := write("nomain.go", "package main\n\nvar a = 1\n")
+	argsFile := write("args.go", "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc main() {\n\tfmt.Println(os.Args)\n}\n")
+	panicFile := write("panic.go", "package main\n\nfunc main() {\n\tvar a = 1 / 0\n}\n")
+	exitFile := write("exit.go", "package main\n\nimport \"os\"\n\nfunc main() {\n\tos.Exit(3)\n}\n")
+	panicCallFile := write("paniccall.go", "package main\n\nfunc f() {\n\tpanic(\"boom\")\n}\n\nfunc main() {\n\tf()\n}\n")
+	overflowFile := write("overflow.go", "package main\n\nfunc f() {\n\tf()\n}\n\nfunc main() {\n\tf()\n}\n")
+	profile, html := filepath.Join(dir, "c.out"), filepath.Join(dir, "c.html")
+	transcript := write("transcript.txt", "> var a = 1\n1\n> var b = a * 2\n2\n")
+	wrongTranscript := write("wrong.txt", "> var a = 1\n2\n")
+
+	tests := []struct {
+		args     []string
+		wantOut  string
+		wantCode int
+	}{
+		{[]string{"-e", "1 + 2"}, "3\n", exitOK},
+		{[]string{"-e", "var a, b = 1, 2"}, "1, 2\n", exitOK},
+		{[]string{"--backend", "vm", "-e", "2 * 3"}, "6\n", exitOK},
+		{[]string{"--backend", "unknown", "-e", "1"}, "", exitUsage},
+		{[]string{"-e", "var a ="}, "", exitError},
+		{[]string{"-e", "1 / 0"}, "", exitPanic},
+		{[]string{"-e", "var a = 1 / 0"}, "", exitPanic},
+		{[]string{"run", mainFile}, "", exitOK},
+		{[]string{"run", "--backend", "closure", mainFile, "arg"}, "", exitOK},
+		{[]string{"run", noMainFile}, "", exitError},
+		{[]string{"run", argsFile, "a", "-b"}, "[" + argsFile + " a -b]\n", exitOK},
+		{[]string{"run", panicFile}, "", exitPanic},
+		{[]string{"run", overflowFile}, "", exitPanic},
+		{[]string{"run", exitFile}, "", 3},
+		{[]string{"run", "--backend", "vm", exitFile}, "", 3},
+		{[]string{"run", panicCallFile}, "", exitPanic},
+		{[]string{"run", "--backend", "closure", panicCallFile}, "", exitPanic},
+		{[]string{"-e", `panic("boom")`}, "", exitPanic},
+		{[]string{"run", "--trace", "--backend", "vm", mainFile}, "", exitOK},
+		{[]string{"run", "--coverprofile", profile, mainFile}, "", exitOK},
+		{[]string{"run", "--covermode", "sometimes", mainFile}, "", exitUsage},
+		{[]string{"run", "--cpuprofile", filepath.Join(dir, "cpu.pprof"), mainFile}, "", exitOK},
+		{[]string{"run"}, "", exitUsage},
+		{[]string{"cover", "-html", profile, "-o", html}, "", exitOK},
+		{[]string{"cover"}, "", exitUsage},
+		{[]string{"unknown"}, "", exitUsage},
+		{[]string{"dap"}, "", exitOK},
+		{[]string{"kernel"}, "", exitUsage},
+		{[]string{"kernel", "install", "--dir", dir}, "installed the kernel spec in " + filepath.Join(dir, "warabi") + "\n", exitOK},
+		{[]string{"serve", "extra"}, "", exitUsage},
+		{[]string{"lsp"}, "", exitOK},
+		{[]string{"serve", "--listen", "localhost:-1"}, "", exitError},
+		{[]string{"--session", filepath.Join(dir, "session.json")}, "\nSee you later\n", exitOK},
+		{[]string{"--record", filepath.Join(dir, "record.txt")}, "\nSee you later\n", exitOK},
+		{[]string{"--no-color"}, "\nSee you later\n", exitOK},
+		{[]string{"replay", transcript}, "> var a = 1\n1\n> var b = a * 2\n2\n", exitOK},
+		{[]string{"replay", transcript, "--check"}, "ok\t" + transcript + "\t2 entries\n", exitOK},
+		{[]string{"replay", "--check", wrongTranscript}, "", exitError},
+		{[]string{"replay", filepath.Join(dir, "none.txt")}, "", exitError},
+		{[]string{"replay"}, "", exitUsage},
+		{[]string{"replay", transcript, "extra"}, "", exitUsage},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			var w, errW bytes.Buffer
+			code := run(test.args, strings.NewReader(""), &w, &errW)
+			if code != test.wantCode {
+				t.Errorf("unexpected exit code: got %d, expected %d: %s\n", code, test.wantCode, errW.String())
+			}
+			if got := w.String(); got != test.wantOut {
+				t.Errorf("unexpected output: got %q, expected %q\n", got, test.wantOut)
+			}
+		})
+	}
+}
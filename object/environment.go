@@ -1,6 +1,8 @@
 package object
 
-var Env = &Environment{
+import "sort"
+
+var Universe = &Environment{
 	objs: map[string]Object{
 		"true":  True,
 		"false": False,
@@ -12,8 +14,13 @@ var builtins = map[string]bool{
 	"false": true,
 }
 
+func IsBuiltin(name string) bool {
+	return builtins[name]
+}
+
 type Environment struct {
-	objs map[string]Object
+	objs  map[string]Object
+	outer *Environment
 }
 
 func NewEnvironment() *Environment {
@@ -22,6 +29,16 @@ func NewEnvironment() *Environment {
 	}
 }
 
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+func (e Environment) Outer() *Environment {
+	return e.outer
+}
+
 func (e *Environment) Set(name string, obj Object) {
 	if builtins[name] {
 		return
@@ -31,5 +48,35 @@ func (e *Environment) Set(name string, obj Object) {
 
 func (e Environment) Get(name string) (Object, bool) {
 	obj, ok := e.objs[name]
+	if !ok && e.outer != nil {
+		return e.outer.Get(name)
+	}
+
 	return obj, ok
 }
+
+func (e *Environment) Delete(name string) {
+	if builtins[name] {
+		return
+	}
+	delete(e.objs, name)
+}
+
+func (e *Environment) Clear() {
+	for name := range e.objs {
+		e.Delete(name)
+	}
+}
+
+func (e Environment) Names() []string {
+	var names []string
+	for name := range e.objs {
+		if builtins[name] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
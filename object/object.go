@@ -3,6 +3,7 @@ package object
 import (
 	"fmt"
 	"go/ast"
+	"go/token"
 )
 
 type Kind int
@@ -15,8 +16,33 @@ const (
 	FloatingPoint
 	Boolean
 	Function
+	Package
+	Native
 )
 
+func (k Kind) String() string {
+	switch k {
+	case Integer:
+		return "int"
+	case String:
+		return "string"
+	case Character:
+		return "rune"
+	case FloatingPoint:
+		return "float32"
+	case Boolean:
+		return "bool"
+	case Function:
+		return "func"
+	case Package:
+		return "package"
+	case Native:
+		return "native"
+	default:
+		return "unknown"
+	}
+}
+
 type Object interface {
 	Kind() Kind
 	String() string
@@ -91,11 +117,15 @@ func (l BooleanLiteral) String() string {
 	return fmt.Sprintf("%t", l.value)
 }
 
+// FunctionLiteral is a function declared in source. Env is the
+// environment it was declared in, and Type is the type in the source,
+// which the function literals evaluated from the same source share.
 type FunctionLiteral struct {
 	Params  []*ast.Field
 	Results []*ast.Field
 	Body    []ast.Stmt
 	Env     *Environment
+	Type    *ast.FuncType
 }
 
 func (l FunctionLiteral) Kind() Kind {
@@ -105,3 +135,67 @@ func (l FunctionLiteral) Kind() Kind {
 func (l FunctionLiteral) String() string {
 	return ""
 }
+
+// Builtin is a function implemented in Go. Result is the kind of what
+// Fn returns, which is Unknown if it returns nothing.
+type Builtin struct {
+	Name   string
+	Fn     func(caller Caller, args []Object) (Object, error)
+	Result Kind
+}
+
+func (b Builtin) Kind() Kind {
+	return Function
+}
+
+func (b Builtin) String() string {
+	return b.Name
+}
+
+// Caller is the interpreter calling a builtin. Call calls a function
+// from the builtin, and Frames returns the calls in progress, outermost
+// first, ending with the call of the builtin.
+type Caller interface {
+	Call(fn Object, args ...Object) (Object, error)
+	Frames() []Frame
+}
+
+type Frame struct {
+	Function string
+	Position token.Position
+}
+
+// Selector is implemented by objects whose members can be selected.
+type Selector interface {
+	Object
+	Select(name string) (Object, bool)
+}
+
+// Enumerator is implemented by selectors which can list the names of
+// their members.
+type Enumerator interface {
+	Selector
+	Members() []string
+}
+
+type ImportedPackage struct {
+	Name string
+	Path string
+	Env  *Environment
+}
+
+func (p ImportedPackage) Kind() Kind {
+	return Package
+}
+
+func (p ImportedPackage) String() string {
+	return fmt.Sprintf("package %s (%q)", p.Name, p.Path)
+}
+
+func (p ImportedPackage) Select(name string) (Object, bool) {
+	return p.Env.Get(name)
+}
+
+func (p ImportedPackage) Members() []string {
+	return p.Env.Names()
+}
@@ -0,0 +1,95 @@
+package playground
+
+// page is the page of the playground, which creates a session when it
+// is loaded and evaluates the code in it.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>warabi playground</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+textarea, pre { box-sizing: border-box; width: 100%; font-family: monospace; font-size: 14px; }
+textarea { height: 12em; }
+pre { min-height: 4em; padding: 0.5em; background: #f4f4f4; white-space: pre-wrap; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>warabi playground</h1>
+<textarea id="code" spellcheck="false">var greeting = "hello, " + "warabi"</textarea>
+<p><button id="run" disabled>Run</button> <button id="reset" disabled>Reset</button> <small>Ctrl-Enter runs the code.</small></p>
+<pre id="result"></pre>
+<script>
+const code = document.getElementById("code");
+const run = document.getElementById("run");
+const reset = document.getElementById("reset");
+const result = document.getElementById("result");
+let session = null;
+
+async function request(method, path, body) {
+	const resp = await fetch(path, {
+		method: method,
+		headers: { "Content-Type": "application/json" },
+		body: body === undefined ? undefined : JSON.stringify(body),
+	});
+	if (resp.status === 204) {
+		return {};
+	}
+	const json = await resp.json();
+	if (!resp.ok) {
+		throw new Error(json.error);
+	}
+	return json;
+}
+
+function show(text, isError) {
+	result.textContent = text;
+	result.className = isError ? "error" : "";
+}
+
+async function start() {
+	run.disabled = reset.disabled = true;
+	if (session !== null) {
+		await request("DELETE", "/sessions/" + session).catch(() => {});
+	}
+	session = (await request("POST", "/sessions")).id;
+	run.disabled = reset.disabled = false;
+}
+
+async function evaluate() {
+	run.disabled = true;
+	try {
+		let resp;
+		try {
+			resp = await request("POST", "/sessions/" + session + "/eval", { code: code.value });
+		} catch (err) {
+			// The session may have expired while it was idle.
+			await start();
+			resp = await request("POST", "/sessions/" + session + "/eval", { code: code.value });
+		}
+		if (resp.error) {
+			show(resp.output + resp.error, true);
+		} else {
+			show(resp.output + resp.result, false);
+		}
+	} catch (err) {
+		show(err.message, true);
+	} finally {
+		run.disabled = false;
+	}
+}
+
+run.addEventListener("click", evaluate);
+reset.addEventListener("click", () => start().then(() => show("", false), err => show(err.message, true)));
+code.addEventListener("keydown", event => {
+	if (event.key === "Enter" && event.ctrlKey) {
+		event.preventDefault();
+		evaluate();
+	}
+});
+start().catch(err => show(err.message, true));
+</script>
+</body>
+</html>
+`
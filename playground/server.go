@@ -0,0 +1,406 @@
+package playground
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomocy/warabi/evaluator"
+)
+
+// Server serves the playground, where each session evaluates code in an
+// interpreter of its own so that sessions do not see each other's
+// variables or output.
+type Server struct {
+	interpreter evaluator.Interpreter
+	limits      evaluator.Limits
+	timeout     time.Duration
+	idleTimeout time.Duration
+	maxSessions int
+	// maxOutput bounds what each evaluation prints, and maxCode and
+	// maxBindings bound the code evaluated in a session and the names
+	// it declares, which the session keeps until it expires.
+	maxOutput   int
+	maxCode     int
+	maxBindings int
+	now         func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type Option func(*Server)
+
+// WithLimits limits the evaluations of every session. Sessions can ask
+// for stricter limits when they are created.
+func WithLimits(limits evaluator.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithTimeout limits the time of each evaluation.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+// WithIdleTimeout expires the sessions which are not used for timeout,
+// which is 10 minutes by default.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithMaxSessions limits the sessions alive at once, which are 1000 by
+// default. 0 means no limit.
+func WithMaxSessions(n int) Option {
+	return func(s *Server) {
+		s.maxSessions = n
+	}
+}
+
+// NewServer returns a server whose sessions evaluate code in the
+// interpreters forked from interpreter.
+func NewServer(interpreter *evaluator.Interpreter, opts ...Option) *Server {
+	s := &Server{
+		interpreter: *interpreter,
+		idleTimeout: 10 * time.Minute,
+		maxSessions: 1000,
+		maxOutput:   1 << 20,
+		maxCode:     4 << 20,
+		maxBindings: 10000,
+		now:         time.Now,
+		sessions:    make(map[string]*session),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// session evaluates the code of a client one by one, capturing what it
+// prints for each evaluation. ctx is canceled when the session is deleted
+// so that the evaluation running then stops.
+type session struct {
+	mu          sync.Mutex
+	interpreter *evaluator.Interpreter
+	output      *limitedBuffer
+	timeout     time.Duration
+	ctx         context.Context
+	cancel      context.CancelFunc
+	code        int
+	maxCode     int
+	maxBindings int
+
+	// lastUsed is guarded by the mutex of the server.
+	lastUsed time.Time
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.expire()
+
+	if r.URL.Path == "/" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+		return
+	}
+	if r.URL.Path == "/sessions" {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.createSession(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/sessions/")
+	if path == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	switch id, action := splitPath(path); {
+	case action == "" && r.Method == http.MethodDelete:
+		s.deleteSession(w, id)
+	case action == "":
+		methodNotAllowed(w, http.MethodDelete)
+	case action == "eval" && r.Method == http.MethodPost:
+		s.evaluate(w, r, id)
+	case action == "eval":
+		methodNotAllowed(w, http.MethodPost)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func splitPath(path string) (string, string) {
+	if i := strings.IndexByte(path, '/'); i != -1 {
+		return path[:i], path[i+1:]
+	}
+
+	return path, ""
+}
+
+// createRequest is the body of POST /sessions, which is optional.
+type createRequest struct {
+	MaxSteps      int `json:"max_steps"`
+	MaxDepth      int `json:"max_depth"`
+	MaxAllocation int `json:"max_allocation"`
+	// Timeout is in milliseconds.
+	Timeout int `json:"timeout"`
+}
+
+type createResponse struct {
+	ID string `json:"id"`
+}
+
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if !decodeRequest(w, r, &req, true) {
+		return
+	}
+
+	limits := s.limits
+	limits.MaxSteps = stricter(limits.MaxSteps, req.MaxSteps)
+	limits.MaxDepth = stricter(limits.MaxDepth, req.MaxDepth)
+	limits.MaxAllocation = stricter(limits.MaxAllocation, req.MaxAllocation)
+	timeout := time.Duration(req.Timeout) * time.Millisecond
+	sess := &session{
+		interpreter: s.interpreter.Fork(),
+		output: &limitedBuffer{
+			max: s.maxOutput,
+		},
+		timeout:     time.Duration(stricter(int(s.timeout), int(timeout))),
+		maxCode:     s.maxCode,
+		maxBindings: s.maxBindings,
+	}
+	sess.interpreter.SetLimits(limits)
+	sess.interpreter.SetOutput(sess.output)
+	sess.ctx, sess.cancel = context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	if s.maxSessions != 0 && s.maxSessions <= len(s.sessions) {
+		s.mu.Unlock()
+		sess.cancel()
+		writeError(w, http.StatusServiceUnavailable, "too many sessions")
+		return
+	}
+	id := newID()
+	sess.lastUsed = s.now()
+	s.sessions[id] = sess
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, createResponse{
+		ID: id,
+	})
+}
+
+// stricter returns the stricter of the limits, where 0 means no limit.
+func stricter(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+
+	return a
+}
+
+func (s *Server) deleteSession(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown session: "+id)
+		return
+	}
+
+	sess.cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type evalRequest struct {
+	Code string `json:"code"`
+}
+
+// evalResponse is the result of an evaluation, which fails with
+// Error rather than an HTTP status.
+type evalResponse struct {
+	Result string `json:"result"`
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (s *Server) evaluate(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	if ok {
+		sess.lastUsed = s.now()
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown session: "+id)
+		return
+	}
+
+	var req evalRequest
+	if !decodeRequest(w, r, &req, false) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sess.evaluate(r.Context(), req.Code))
+}
+
+// evaluate evaluates the code as an expression or declarations as
+// warabi -e does. The names declared beyond the bindings of the session
+// are deleted again.
+func (sess *session) evaluate(ctx context.Context, code string) evalResponse {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.maxCode != 0 && sess.maxCode < sess.code+len(code) {
+		return evalResponse{
+			Error: fmt.Sprintf("session limit exceeded: more than %d bytes of code", sess.maxCode),
+		}
+	}
+	sess.code += len(code)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-sess.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if sess.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sess.timeout)
+		defer cancel()
+	}
+
+	env := sess.interpreter.Env()
+	declared := make(map[string]bool)
+	for _, name := range env.Names() {
+		declared[name] = true
+	}
+
+	sess.output.Reset()
+	var resp evalResponse
+	var err error
+	if resp.Result, err = sess.interpreter.EvaluateSnippet(ctx, code); err != nil {
+		resp.Error = err.Error()
+	}
+	resp.Output = sess.output.String()
+
+	if names := env.Names(); sess.maxBindings != 0 && sess.maxBindings < len(names) {
+		for _, name := range names {
+			if !declared[name] {
+				env.Delete(name)
+			}
+		}
+		resp.Result = ""
+		resp.Error = fmt.Sprintf("session limit exceeded: more than %d names", sess.maxBindings)
+	}
+
+	return resp
+}
+
+// limitedBuffer is a buffer which fails the writes beyond max bytes, so
+// that what an evaluation prints is bounded as well as what it builds.
+type limitedBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max != 0 && b.max < b.buf.Len()+len(p) {
+		return 0, fmt.Errorf("output limit exceeded: %d bytes", b.max)
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Reset() {
+	b.buf.Reset()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// expire deletes the sessions which have been idle for the idle timeout.
+func (s *Server) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for id, sess := range s.sessions {
+		if s.idleTimeout <= now.Sub(sess.lastUsed) {
+			delete(s.sessions, id)
+			sess.cancel()
+		}
+	}
+}
+
+// maxBodySize limits the size of the bodies of requests.
+const maxBodySize = 1 << 20
+
+// decodeRequest decodes the body of r into v, writing the error if it
+// fails. The body may be empty if it is optional.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}, optional bool) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return false
+	}
+	if optional && len(bytes.TrimSpace(body)) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed request: "+err.Error())
+		return false
+	}
+
+	return true
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{
+		Error: msg,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,244 @@
+package playground
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomocy/warabi/evaluator"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer(evaluator.NewInterpreter(evaluator.TreeWalk), WithLimits(evaluator.Limits{
+		MaxDepth:        100,
+		AllowedPackages: []string{"fmt"},
+	}))
+	var now time.Time
+	s.now = func() time.Time {
+		return now
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := &client{
+		t:   t,
+		url: server.URL,
+	}
+
+	apple := c.createSession(nil)
+	banana := c.createSession(map[string]interface{}{"max_depth": 10})
+	if apple == banana {
+		t.Fatalf("unexpected same sessions: %s\n", apple)
+	}
+
+	tests := []struct {
+		session string
+		code    string
+		want    evalResponse
+	}{
+		{apple, "var a = 1 + 2", evalResponse{Result: "3"}},
+		{apple, "a * 2", evalResponse{Result: "6"}},
+		{banana, "a", evalResponse{Error: "main.go:1:1: undefined: a"}},
+		{banana, `var a = "banana"`, evalResponse{Result: "banana"}},
+		{apple, "a", evalResponse{Result: "3"}},
+		{apple, `import "fmt"`, evalResponse{}},
+		{apple, `fmt.Println("apple:", a)`, evalResponse{Output: "apple: 3\n"}},
+		{banana, `fmt.Println("banana:", a)`, evalResponse{Error: "main.go:1:1: undefined: fmt"}},
+		{apple, `import "os"`, evalResponse{Error: "package not allowed: os"}},
+		{banana, "func f() { f() }", evalResponse{}},
+		{banana, "f()", evalResponse{Error: "depth limit exceeded: 10"}},
+	}
+	for _, test := range tests {
+		var got evalResponse
+		if status := c.do(http.MethodPost, "/sessions/"+test.session+"/eval", evalRequest{Code: test.code}, &got); status != http.StatusOK {
+			t.Fatalf("unexpected status of %q: %d\n", test.code, status)
+		}
+		if got != test.want {
+			t.Errorf("unexpected response of %q: got %+v, expected %+v\n", test.code, got, test.want)
+		}
+	}
+
+	if status := c.do(http.MethodDelete, "/sessions/"+apple, nil, nil); status != http.StatusNoContent {
+		t.Errorf("unexpected status of deletion: %d\n", status)
+	}
+	if status := c.do(http.MethodPost, "/sessions/"+apple+"/eval", evalRequest{Code: "a"}, nil); status != http.StatusNotFound {
+		t.Errorf("unexpected status of deleted session: %d\n", status)
+	}
+	if status := c.do(http.MethodDelete, "/sessions/"+apple, nil, nil); status != http.StatusNotFound {
+		t.Errorf("unexpected status of deleted session: %d\n", status)
+	}
+
+	now = now.Add(9 * time.Minute)
+	if status := c.do(http.MethodPost, "/sessions/"+banana+"/eval", evalRequest{Code: "a"}, nil); status != http.StatusOK {
+		t.Errorf("unexpected status of session used recently: %d\n", status)
+	}
+	now = now.Add(10 * time.Minute)
+	if status := c.do(http.MethodPost, "/sessions/"+banana+"/eval", evalRequest{Code: "a"}, nil); status != http.StatusNotFound {
+		t.Errorf("unexpected status of idle session: %d\n", status)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/sessions", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/sessions/" + banana + "/eval", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/sessions/" + banana + "/unknown", http.StatusNotFound},
+		{http.MethodGet, "/unknown", http.StatusNotFound},
+	} {
+		if status := c.do(test.method, test.path, nil, nil); status != test.want {
+			t.Errorf("unexpected status of %s %s: got %d, expected %d\n", test.method, test.path, status, test.want)
+		}
+	}
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "warabi playground") {
+		t.Errorf("unexpected page: %d %s\n", resp.StatusCode, body)
+	}
+}
+
+func TestServerBounds(t *testing.T) {
+	s := NewServer(evaluator.NewInterpreter(evaluator.TreeWalk), WithMaxSessions(1))
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := &client{
+		t:   t,
+		url: server.URL,
+	}
+
+	apple := c.createSession(nil)
+	if status := c.do(http.MethodPost, "/sessions", nil, nil); status != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status of too many sessions: %d\n", status)
+	}
+	code := strings.Repeat(" ", maxBodySize) + "1"
+	if status := c.do(http.MethodPost, "/sessions/"+apple+"/eval", evalRequest{Code: code}, nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status of too large request: %d\n", status)
+	}
+
+	sess := s.sessions[apple]
+	if _, err := sess.interpreter.Evaluate("func fib(n int) { if 1 < n { fib(n - 1); fib(n - 2) } }"); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	respCh := make(chan evalResponse)
+	go func() {
+		respCh <- sess.evaluate(context.Background(), "fib(100)")
+	}()
+	if status := c.do(http.MethodDelete, "/sessions/"+apple, nil, nil); status != http.StatusNoContent {
+		t.Errorf("unexpected status of deletion: %d\n", status)
+	}
+	select {
+	case resp := <-respCh:
+		if want := "evaluation interrupted: context canceled"; resp.Error != want {
+			t.Errorf("unexpected error: got %q, expected %q\n", resp.Error, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("evaluation of deleted session did not stop\n")
+	}
+
+	c.createSession(nil)
+}
+
+func TestStricter(t *testing.T) {
+	tests := []struct {
+		a, b, want int
+	}{
+		{0, 0, 0},
+		{0, 5, 5},
+		{5, 0, 5},
+		{5, 3, 3},
+		{3, 5, 3},
+	}
+	for _, test := range tests {
+		if got := stricter(test.a, test.b); got != test.want {
+			t.Errorf("unexpected limit of %d and %d: got %d, expected %d\n", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+type client struct {
+	t   *testing.T
+	url string
+}
+
+func (c *client) createSession(req interface{}) string {
+	c.t.Helper()
+
+	var resp createResponse
+	if status := c.do(http.MethodPost, "/sessions", req, &resp); status != http.StatusCreated {
+		c.t.Fatalf("unexpected status of creation: %d\n", status)
+	}
+
+	return resp.ID
+}
+
+// do requests the method of path with the body encoded as JSON, if any,
+// and decodes the response into v, if any.
+func (c *client) do(method, path string, body, v interface{}) int {
+	c.t.Helper()
+
+	var src []byte
+	if body != nil {
+		src, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, c.url+path, bytes.NewReader(src))
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			c.t.Fatalf("unexpected error: %s\n", err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+func TestSessionLimits(t *testing.T) {
+	s := NewServer(evaluator.NewInterpreter(evaluator.TreeWalk))
+	s.maxOutput, s.maxCode, s.maxBindings = 10, 100, 3
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := &client{
+		t:   t,
+		url: server.URL,
+	}
+
+	apple := c.createSession(nil)
+	tests := []struct {
+		code string
+		want evalResponse
+	}{
+		{`import "fmt"`, evalResponse{}},
+		{`fmt.Print("0123456789")`, evalResponse{Output: "0123456789"}},
+		{`fmt.Print("0123456789a")`, evalResponse{Error: "output limit exceeded: 10 bytes"}},
+		{"var a, b = 1, 2", evalResponse{Result: "1, 2"}},
+		{"var c = 3", evalResponse{Error: "session limit exceeded: more than 3 names"}},
+		{"c", evalResponse{Error: "main.go:1:1: undefined: c"}},
+		{strings.Repeat(" ", 50) + "a", evalResponse{Error: "session limit exceeded: more than 100 bytes of code"}},
+		{"b", evalResponse{Result: "2"}},
+	}
+	for _, test := range tests {
+		var got evalResponse
+		if status := c.do(http.MethodPost, "/sessions/"+apple+"/eval", evalRequest{Code: test.code}, &got); status != http.StatusOK {
+			t.Fatalf("unexpected status of %q: %d\n", test.code, status)
+		}
+		if got != test.want {
+			t.Errorf("unexpected response of %q: got %+v, expected %+v\n", test.code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package repl
+
+import (
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// The colors of the escape sequences of ANSI.
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	_, ok = newTerminal(f)
+	return ok
+}
+
+// colorsEnabled reports whether colors are written to w, which they are
+// if w is a terminal and NO_COLOR is not set as https://no-color.org
+// asks.
+func colorsEnabled(w io.Writer) bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(w)
+}
+
+// paint colors the text, resetting the color at the end of each line
+// so that it does not leak into the prompts of the following lines.
+func paint(color, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = color + line + colorReset
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// highlight colors the keywords, the literals and the comments in src,
+// which may be incomplete.
+func highlight(src string) string {
+	fileSet := token.NewFileSet()
+	file := fileSet.AddFile("", -1, len(src))
+	// $n is scanned as the identifier which it is expanded to rather
+	// than $ followed by a number.
+	expanded, _, err := expandResults(src)
+	if err != nil {
+		expanded = src
+	}
+	var s scanner.Scanner
+	s.Init(file, []byte(expanded), nil, scanner.ScanComments)
+
+	var b strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		color, ok := tokenColor(tok, lit)
+		if !ok {
+			continue
+		}
+		start := file.Offset(pos)
+		end := start + len(lit)
+		if len(src) < end {
+			end = len(src)
+		}
+		b.WriteString(src[last:start])
+		b.WriteString(paint(color, src[start:end]))
+		last = end
+	}
+	b.WriteString(src[last:])
+
+	return b.String()
+}
+
+func tokenColor(tok token.Token, lit string) (string, bool) {
+	switch {
+	case tok.IsKeyword():
+		return colorMagenta, true
+	case tok == token.INT, tok == token.FLOAT, tok == token.IMAG:
+		return colorCyan, true
+	case tok == token.STRING, tok == token.CHAR:
+		return colorGreen, true
+	case tok == token.COMMENT:
+		return colorGray, true
+	case tok == token.IDENT && object.IsBuiltin(lit):
+		return colorYellow, true
+	default:
+		return "", false
+	}
+}
+
+// paintObject colors the object by its kind.
+func paintObject(obj object.Object) string {
+	colors := map[object.Kind]string{
+		object.Integer:       colorCyan,
+		object.FloatingPoint: colorCyan,
+		object.Character:     colorCyan,
+		object.String:        colorGreen,
+		object.Boolean:       colorYellow,
+		object.Function:      colorBlue,
+		object.Package:       colorBlue,
+	}
+	color, ok := colors[obj.Kind()]
+	if !ok {
+		return obj.String()
+	}
+
+	return paint(color, obj.String())
+}
+
+// pointError returns the line of src which the error of the snippet is
+// at followed by the caret under the column, or the empty string if
+// the error has no position.
+func pointError(src string, err error) string {
+	// The error is at main.go:line:column of the snippet after
+	// packageStatement.
+	parts := strings.SplitN(err.Error(), ":", 4)
+	if len(parts) != 4 {
+		return ""
+	}
+	line, lineErr := strconv.Atoi(parts[1])
+	column, columnErr := strconv.Atoi(parts[2])
+	line -= strings.Count(packageStatement, "\n")
+	lines := strings.Split(src, "\n")
+	if lineErr != nil || columnErr != nil || line < 1 || len(lines) < line || column < 1 {
+		return ""
+	}
+
+	text := lines[line-1]
+	if len(text) < column-1 {
+		column = len(text) + 1
+	}
+	var caret strings.Builder
+	for _, r := range text[:column-1] {
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+
+	return text + "\n" + caret.String()
+}
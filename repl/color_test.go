@@ -0,0 +1,62 @@
+package repl
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := map[string]string{
+		"var a = 1 + b":     "\x1b[35mvar\x1b[0m a = \x1b[36m1\x1b[0m + b",
+		`f("x", 'y', true)`: "f(\x1b[32m\"x\"\x1b[0m, \x1b[32m'y'\x1b[0m, \x1b[33mtrue\x1b[0m)",
+		"a // b":            "a \x1b[90m// b\x1b[0m",
+		"/* a\nb */ 2.5":    "\x1b[90m/* a\x1b[0m\n\x1b[90mb */\x1b[0m \x1b[36m2.5\x1b[0m",
+		"var s = `a\n\nb":   "\x1b[35mvar\x1b[0m s = \x1b[32m`a\x1b[0m\n\n\x1b[32mb\x1b[0m",
+		"var s = \"日本":      "\x1b[35mvar\x1b[0m s = \x1b[32m\"日本\x1b[0m",
+		"func f() {\n":      "\x1b[35mfunc\x1b[0m f() {\n",
+		"$1 + 2":            "$1 + \x1b[36m2\x1b[0m",
+	}
+	for src, want := range tests {
+		if got := highlight(src); got != want {
+			t.Errorf("unexpected highlight of %q: got %q, expected %q\n", src, got, want)
+		}
+	}
+}
+
+func TestPointError(t *testing.T) {
+	tests := []struct {
+		src  string
+		err  string
+		want string
+	}{
+		{"var a = b", "main.go:2:9: undefined: b", "var a = b\n        ^"},
+		{"func f() {\n\tvar x = y\n}", "main.go:3:10: undefined: y", "\tvar x = y\n\t        ^"},
+		{"var a = 1 +", "main.go:2:12: expected operand, found 'EOF'", "var a = 1 +\n           ^"},
+		{"var a = 1", "runtime error: integer divide by zero", ""},
+		{"var a = 1", "main.go:5:1: undefined: b", ""},
+	}
+	for _, test := range tests {
+		if got := pointError(test.src, errors.New(test.err)); got != test.want {
+			t.Errorf("unexpected point of %q: got %q, expected %q\n", test.err, got, test.want)
+		}
+	}
+}
+
+func TestWarabiREPLColor(t *testing.T) {
+	r := strings.NewReader("var a, b = 1, \"x\"\nvar c = true\nvar d = a / 0\n")
+	var w bytes.Buffer
+	repler := newWarabi(r, &w)
+	repler.terminal, repler.color = true, true
+
+	runREPL(t, repler)
+
+	want := "\x1b[36m1\x1b[0m, \x1b[32mx\x1b[0m\n" +
+		"\x1b[33mtrue\x1b[0m\n" +
+		"\x1b[31mmain.go:2:11: runtime error: integer divide by zero\x1b[0m\nvar d = a / 0\n          ^\n" +
+		"\nSee you later\n"
+	if got := w.String(); got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
@@ -0,0 +1,217 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/object"
+)
+
+const commandPrefix = ":"
+
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(ctx context.Context, arg string) string
+}
+
+func (repler *warabi) commands() []command {
+	return []command{
+		{":env", "", "list bindings with their types and values", repler.listEnvironment},
+		{":type", "expr", "show the type of expr", repler.showType},
+		{":reset", "", "clear the environment", repler.reset},
+		{":del", "name", "delete the binding of name", repler.delete},
+		{":load", "file.go", "evaluate the declarations in file.go", repler.load},
+		{":save", "file.go", "write the declarations so far to file.go as a program", repler.save},
+		{":save-session", "file", "save the imports, the declarations and the values of variables to file", repler.saveSessionCommand},
+		{":load-session", "file", "restore the session saved in file", repler.loadSessionCommand},
+		{":ast", "expr", "print the AST of expr", repler.printAST},
+		{":debug", "path", "debug the program in the file or the directory at path", repler.debug},
+		{":break", "[loc]", "set a breakpoint at file:line or a function, or list them", repler.setBreakpoint},
+		{":clear", "id", "clear the breakpoint of id", repler.clearBreakpoint},
+		{":continue", "", "run the program until it stops", repler.resume(evaluator.Debugger.Continue)},
+		{":step", "", "run to the next line, stepping into calls", repler.resume(evaluator.Debugger.StepIn)},
+		{":next", "", "run to the next line, stepping over calls", repler.resume(evaluator.Debugger.StepOver)},
+		{":stepout", "", "run until the current function returns", repler.resume(evaluator.Debugger.StepOut)},
+		{":stack", "", "show the calls in progress", repler.showStack},
+		{":frame", "n", "select the frame n in :stack", repler.selectFrame},
+		{":locals", "", "list the variables in scope of the frame", repler.listLocals},
+		{":print", "expr", "evaluate expr in the frame", repler.printExpression},
+		{":abort", "", "stop debugging the program", repler.abort},
+		{":help", "", "show this help", repler.help},
+	}
+}
+
+func isCommand(src string) bool {
+	return strings.HasPrefix(strings.TrimSpace(src), commandPrefix)
+}
+
+func (repler *warabi) runCommand(ctx context.Context, src string) string {
+	src = strings.TrimSpace(src)
+	name, arg := src, ""
+	if i := strings.IndexAny(src, " \t"); i != -1 {
+		name, arg = src[:i], strings.TrimSpace(src[i:])
+	}
+
+	for _, command := range repler.commands() {
+		if command.name == name {
+			return command.run(ctx, arg)
+		}
+	}
+
+	return fmt.Sprintf("unknown command: %s (see :help)", name)
+}
+
+// listEnvironment lists the results as $n in their order first, and then
+// the other bindings, so that every name listed can be typed back.
+func (repler *warabi) listEnvironment(ctx context.Context, arg string) string {
+	var results, others []string
+	for _, name := range repler.interpreter.Env().Names() {
+		if isResultName(name) {
+			results = append(results, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return resultNumber(results[i]) < resultNumber(results[j])
+	})
+
+	var lines []string
+	for _, name := range append(results, others...) {
+		obj, _ := repler.interpreter.Env().Get(name)
+		lines = append(lines, describe(referredName(name), obj))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func describe(name string, obj object.Object) string {
+	if obj == nil {
+		return fmt.Sprintf("%s = <nil>", name)
+	}
+	if t, ok := obj.(tuple); ok {
+		return describeResult(name, t, false)
+	}
+
+	return describeResult(name, []object.Object{obj}, false)
+}
+
+// showType infers the type of the expression rather than evaluates it
+// so that it has no side effect.
+func (repler *warabi) showType(ctx context.Context, arg string) string {
+	kind, err := repler.interpreter.InferKind(arg)
+	if err != nil {
+		return err.Error()
+	}
+	if kind == object.Unknown {
+		return "<nil>"
+	}
+
+	return kind.String()
+}
+
+func (repler *warabi) reset(ctx context.Context, arg string) string {
+	repler.interpreter.Env().Clear()
+	repler.declarations.reset()
+	repler.results = 0
+	return ""
+}
+
+// delete deletes the binding of arg, which is $n for the nth result.
+func (repler *warabi) delete(ctx context.Context, arg string) string {
+	name := arg
+	if 1 < len(arg) && arg[0] == '$' && isDigits(arg[1:]) {
+		name = "_" + arg[1:]
+	}
+	if _, ok := repler.interpreter.Env().Get(name); !ok && !repler.declarations.declares(name) {
+		return fmt.Sprintf("undefined: %s", arg)
+	}
+
+	repler.interpreter.Env().Delete(name)
+	repler.declarations.delete(name)
+	return ""
+}
+
+func (repler *warabi) load(ctx context.Context, arg string) string {
+	src, err := os.ReadFile(arg)
+	if err != nil {
+		return err.Error()
+	}
+
+	objs, err := repler.interpreter.EvaluateFile(ctx, arg, src)
+	if err != nil {
+		return err.Error()
+	}
+	if err := repler.declarations.record(string(src)); err != nil {
+		return err.Error()
+	}
+
+	return joinObjects(objs)
+}
+
+func (repler *warabi) save(ctx context.Context, arg string) string {
+	src, err := repler.declarations.program()
+	if err != nil {
+		return err.Error()
+	}
+	if err := os.WriteFile(arg, src, 0644); err != nil {
+		return err.Error()
+	}
+
+	return fmt.Sprintf("saved to %s", arg)
+}
+
+func (repler *warabi) saveSessionCommand(ctx context.Context, arg string) string {
+	warnings, err := repler.saveSession(arg)
+	if err != nil {
+		return err.Error()
+	}
+
+	return strings.Join(append(warnings, fmt.Sprintf("saved the session to %s", arg)), "\n")
+}
+
+func (repler *warabi) loadSessionCommand(ctx context.Context, arg string) string {
+	if err := repler.loadSession(ctx, arg); err != nil {
+		return err.Error()
+	}
+
+	return fmt.Sprintf("loaded the session from %s", arg)
+}
+
+func (repler *warabi) printAST(ctx context.Context, arg string) string {
+	fileSet := token.NewFileSet()
+	var node interface{}
+	if expr, err := parser.ParseExprFrom(fileSet, "", arg, parser.Mode(0)); err == nil {
+		node = expr
+	} else {
+		file, err := parser.ParseFile(fileSet, "", packageStatement+arg, parser.Mode(0))
+		if err != nil {
+			return err.Error()
+		}
+		node = file
+	}
+
+	var b bytes.Buffer
+	ast.Fprint(&b, fileSet, node, ast.NotNilFilter)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (repler *warabi) help(ctx context.Context, arg string) string {
+	var lines []string
+	for _, command := range repler.commands() {
+		usage := strings.TrimSpace(command.name + " " + command.args)
+		lines = append(lines, fmt.Sprintf("%-16s %s", usage, command.description))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,214 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tomocy/warabi/evaluator"
+)
+
+// debugging is the state of the program being debugged. frame is
+// the frame which :locals and :print are of, and is reset to the innermost
+// one whenever the program stops.
+type debugging struct {
+	debugger evaluator.Debugger
+	frame    int
+}
+
+const notDebugging = "no program is being debugged (see :debug)"
+
+func (repler *warabi) debug(ctx context.Context, arg string) string {
+	if arg == "" {
+		return "usage: :debug path"
+	}
+	if repler.debugging != nil {
+		repler.debugging.debugger.Abort()
+		repler.debugging = nil
+	}
+
+	interpreter := *repler.interpreter
+	interpreter.SetOutput(repler.w)
+	debugger, err := interpreter.Debug(context.Background(), arg)
+	if err != nil {
+		return err.Error()
+	}
+	repler.debugging = &debugging{
+		debugger: debugger,
+	}
+
+	return fmt.Sprintf("debugging %s (:continue or :step to start)", arg)
+}
+
+func (repler *warabi) setBreakpoint(ctx context.Context, arg string) string {
+	if repler.debugging == nil {
+		return notDebugging
+	}
+	if arg == "" {
+		var lines []string
+		for _, breakpoint := range repler.debugging.debugger.Breakpoints() {
+			lines = append(lines, breakpoint.String())
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	breakpoint, err := repler.debugging.debugger.SetBreakpoint(arg)
+	if err != nil {
+		return err.Error()
+	}
+
+	return breakpoint.String()
+}
+
+func (repler *warabi) clearBreakpoint(ctx context.Context, arg string) string {
+	if repler.debugging == nil {
+		return notDebugging
+	}
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Sprintf("invalid breakpoint: %s", arg)
+	}
+
+	if err := repler.debugging.debugger.ClearBreakpoint(id); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func (repler *warabi) resume(step func(evaluator.Debugger, context.Context) (evaluator.Stop, error)) func(context.Context, string) string {
+	return func(ctx context.Context, arg string) string {
+		if repler.debugging == nil {
+			return notDebugging
+		}
+
+		stop, err := step(repler.debugging.debugger, ctx)
+		if err != nil {
+			return err.Error()
+		}
+		repler.debugging.frame = 0
+		if stop.Reason == evaluator.StopExit {
+			repler.debugging = nil
+			if stop.Err != nil {
+				return fmt.Sprintf("program exited: %s", stop.Err)
+			}
+			return "program exited"
+		}
+
+		return describeStop(stop)
+	}
+}
+
+func describeStop(stop evaluator.Stop) string {
+	reason := stop.Reason.String()
+	if stop.Reason == evaluator.StopBreakpoint {
+		reason = fmt.Sprintf("breakpoint %d", stop.Breakpoint.ID)
+	}
+	desc := fmt.Sprintf(
+		"stopped at %s:%d in %s (%s)",
+		filepath.Base(stop.Position.Filename), stop.Position.Line, stop.Function, reason,
+	)
+	if line, ok := sourceLine(stop.Position.Filename, stop.Position.Line); ok {
+		desc += fmt.Sprintf("\n%d\t%s", stop.Position.Line, line)
+	}
+
+	return desc
+}
+
+func sourceLine(filename string, n int) (string, bool) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(string(src), "\n")
+	if n < 1 || len(lines) < n {
+		return "", false
+	}
+
+	return strings.TrimSpace(lines[n-1]), true
+}
+
+func (repler *warabi) showStack(ctx context.Context, arg string) string {
+	if repler.debugging == nil {
+		return notDebugging
+	}
+	frames, err := repler.debugging.debugger.Stack()
+	if err != nil {
+		return err.Error()
+	}
+
+	lines := make([]string, len(frames))
+	for i, frame := range frames {
+		mark := " "
+		if i == repler.debugging.frame {
+			mark = "*"
+		}
+		pos := "?"
+		if frame.Position.IsValid() {
+			pos = fmt.Sprintf("%s:%d", filepath.Base(frame.Position.Filename), frame.Position.Line)
+		}
+		lines[i] = fmt.Sprintf("%s %d %s at %s", mark, i, frame.Function, pos)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (repler *warabi) selectFrame(ctx context.Context, arg string) string {
+	if repler.debugging == nil {
+		return notDebugging
+	}
+	frame, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Sprintf("invalid frame: %s", arg)
+	}
+	if _, err := repler.debugging.debugger.Locals(frame); err != nil {
+		return err.Error()
+	}
+
+	repler.debugging.frame = frame
+	return ""
+}
+
+func (repler *warabi) listLocals(ctx context.Context, arg string) string {
+	if repler.debugging == nil {
+		return notDebugging
+	}
+	vars, err := repler.debugging.debugger.Locals(repler.debugging.frame)
+	if err != nil {
+		return err.Error()
+	}
+
+	lines := make([]string, len(vars))
+	for i, v := range vars {
+		lines[i] = describe(v.Name, v.Value)
+		if v.Shadowed {
+			lines[i] += " (shadowed)"
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (repler *warabi) printExpression(ctx context.Context, arg string) string {
+	if repler.debugging == nil {
+		return notDebugging
+	}
+	obj, err := repler.debugging.debugger.Evaluate(ctx, repler.debugging.frame, arg)
+	if err != nil {
+		return err.Error()
+	}
+
+	return obj.String()
+}
+
+func (repler *warabi) abort(ctx context.Context, arg string) string {
+	if repler.debugging == nil {
+		return notDebugging
+	}
+
+	repler.debugging.debugger.Abort()
+	repler.debugging = nil
+	return "program aborted"
+}
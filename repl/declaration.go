@@ -0,0 +1,205 @@
+package repl
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type declaration struct {
+	names []string
+	src   string
+}
+
+// declarations are the declarations so far, and the imports which are
+// kept apart since they precede the others in programs.
+type declarations struct {
+	imports []declaration
+	decls   []declaration
+}
+
+func (ds *declarations) record(src string) error {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", src, parser.Mode(0))
+	if err != nil {
+		return err
+	}
+
+	slice := func(node ast.Node) string {
+		return src[fileSet.Position(node.Pos()).Offset:fileSet.Position(node.End()).Offset]
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			ds.add(declaration{
+				names: []string{decl.Name.Name},
+				src:   slice(decl),
+			})
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				for _, spec := range decl.Specs {
+					ds.addImport(spec.(*ast.ImportSpec), slice)
+				}
+				continue
+			}
+			if decl.Tok != token.VAR && decl.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				ds.addValueSpecification(decl.Tok, spec.(*ast.ValueSpec), slice)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (ds *declarations) addValueSpecification(tok token.Token, spec *ast.ValueSpec, slice func(ast.Node) string) {
+	if len(spec.Values) != 0 && len(spec.Values) != len(spec.Names) {
+		names := make([]string, len(spec.Names))
+		for i, name := range spec.Names {
+			names[i] = name.Name
+		}
+		ds.add(declaration{
+			names: names,
+			src:   tok.String() + " " + slice(spec),
+		})
+		return
+	}
+
+	for i, name := range spec.Names {
+		src := tok.String() + " " + name.Name
+		if spec.Type != nil {
+			src += " " + slice(spec.Type)
+		}
+		if len(spec.Values) != 0 {
+			src += " = " + slice(spec.Values[i])
+		}
+		ds.add(declaration{
+			names: []string{name.Name},
+			src:   src,
+		})
+	}
+}
+
+func (ds *declarations) addImport(spec *ast.ImportSpec, slice func(ast.Node) string) {
+	importPath, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return
+	}
+	name := path.Base(importPath)
+	if spec.Name != nil {
+		name = spec.Name.Name
+	}
+
+	ds.delete(name)
+	ds.imports = append(ds.imports, declaration{
+		names: []string{name},
+		src:   "import " + slice(spec),
+	})
+}
+
+func (ds *declarations) add(decl declaration) {
+	for _, name := range decl.names {
+		ds.delete(name)
+	}
+	ds.decls = append(ds.decls, decl)
+}
+
+func (ds *declarations) delete(name string) {
+	ds.imports = deleteDeclaration(ds.imports, name)
+	ds.decls = deleteDeclaration(ds.decls, name)
+}
+
+func deleteDeclaration(decls []declaration, name string) []declaration {
+	deleted := decls[:0]
+	for _, decl := range decls {
+		if !decl.declares(name) {
+			deleted = append(deleted, decl)
+		}
+	}
+
+	return deleted
+}
+
+func (ds declarations) declares(name string) bool {
+	for _, decls := range [][]declaration{ds.imports, ds.decls} {
+		for _, decl := range decls {
+			if decl.declares(name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (ds *declarations) reset() {
+	ds.imports = nil
+	ds.decls = nil
+}
+
+// program returns the declarations as a program, importing the packages
+// which the declarations use as Go does not compile unused imports.
+func (ds declarations) program() ([]byte, error) {
+	var (
+		srcs    []string
+		hasMain bool
+	)
+	for _, decl := range ds.decls {
+		srcs = append(srcs, decl.src)
+		hasMain = hasMain || decl.declares("main")
+	}
+	if !hasMain {
+		srcs = append(srcs, "func main() {}")
+	}
+
+	used, err := usedNames(strings.Join(srcs, "\n\n"))
+	if err != nil {
+		return nil, err
+	}
+	var imports []string
+	for _, imp := range ds.imports {
+		if used[imp.names[0]] {
+			imports = append(imports, imp.src)
+		}
+	}
+
+	srcs = append(append([]string{"package main"}, imports...), srcs...)
+	return format.Source([]byte(strings.Join(srcs, "\n\n") + "\n"))
+}
+
+// usedNames returns the names which the operands of selectors in the
+// declarations are, which are the packages they use.
+func usedNames(decls string) (map[string]bool, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", packageStatement+decls, parser.Mode(0))
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	return used, nil
+}
+
+func (d declaration) declares(name string) bool {
+	for _, n := range d.names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
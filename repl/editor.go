@@ -0,0 +1,620 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+// errInterrupted is returned when Ctrl-C is pressed while a line is
+// edited, since it does not send SIGINT in raw mode.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the lines which the REPL evaluates.
+type lineReader interface {
+	readLine() (string, error)
+}
+
+// lineScanner scans lines as they are, which the REPL falls back on
+// when the input is not a terminal.
+type lineScanner struct {
+	scanner *bufio.Scanner
+}
+
+func (s lineScanner) readLine() (string, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return s.scanner.Text(), nil
+}
+
+// editor edits lines on a terminal as line editors of shells do. A line
+// continues on the next row while it is not a complete entry.
+type editor struct {
+	r       *bufio.Reader
+	w       io.Writer
+	term    terminal
+	history *history
+	// complete returns the candidates which replace the source from start
+	// to the cursor, if any.
+	complete func(src string, cursor int) (start int, candidates []string)
+	// highlight colors the line, if any.
+	highlight func(string) string
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// The keys sent as escape sequences are out of the range of runes.
+const (
+	keyUp rune = unicode.MaxRune + 1 + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyWordLeft
+	keyWordRight
+	keyUnknown
+)
+
+// readKey reads a key, decoding the escape sequences of the special keys.
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.r.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+	// A lone escape is not followed by the rest of a sequence, which
+	// terminals send at once.
+	if e.r.Buffered() == 0 {
+		return keyEscape, nil
+	}
+
+	r, _, err = e.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch r {
+	case 'b':
+		return keyWordLeft, nil
+	case 'f':
+		return keyWordRight, nil
+	case '[', 'O':
+	default:
+		return keyUnknown, nil
+	}
+
+	var params []rune
+	for {
+		r, _, err := e.r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if '@' <= r && r <= '~' {
+			return decodeSequence(string(params), r), nil
+		}
+		params = append(params, r)
+	}
+}
+
+func decodeSequence(params string, final rune) rune {
+	modified := strings.HasSuffix(params, ";5") || strings.HasSuffix(params, ";3")
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		if modified {
+			return keyWordRight
+		}
+		return keyRight
+	case 'D':
+		if modified {
+			return keyWordLeft
+		}
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		}
+	}
+
+	return keyUnknown
+}
+
+// lineState is the state of the line being edited.
+type lineState struct {
+	editor *editor
+	width  int
+	prompt string
+	buf    []rune
+	pos    int
+	// row is the row of the cursor from the first row of the line.
+	row int
+
+	// history is the index of the entry of the history being edited,
+	// and draft is the new line, which is kept while entries are.
+	history int
+	draft   []rune
+
+	searching bool
+	query     []rune
+	// found is the index of the entry which the query is found in, or -1.
+	found            int
+	beforeSearch     []rune
+	beforeSearchPos  int
+	beforeSearchHist int
+}
+
+// readLine reads a line in raw mode, adding it to the history.
+func (e *editor) readLine() (string, error) {
+	restore, err := e.term.makeRaw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	s := &lineState{
+		editor:  e,
+		width:   e.term.width(),
+		prompt:  prompt,
+		history: len(e.history.entries),
+	}
+	s.refresh()
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		if s.searching && !s.search(key) {
+			continue
+		}
+
+		done, err := s.handle(key)
+		if err != nil {
+			return "", err
+		}
+		if done {
+			line := string(s.buf)
+			if err := e.history.add(line); err != nil {
+				fmt.Fprintf(e.w, "failed to save the history: %s\r\n", err)
+			}
+			return line, nil
+		}
+	}
+}
+
+// handle handles the key, reporting whether the line is entered.
+func (s *lineState) handle(key rune) (bool, error) {
+	switch key {
+	case keyEnter:
+		if !isCompleteEntry(string(s.buf)) {
+			s.insert('\n')
+			break
+		}
+		s.pos = len(s.buf)
+		s.refresh()
+		s.write("\r\n")
+		return true, nil
+	case keyCtrlC:
+		s.pos = len(s.buf)
+		s.refresh()
+		return false, errInterrupted
+	case keyCtrlD:
+		if len(s.buf) == 0 {
+			return false, io.EOF
+		}
+		s.delete(s.pos, s.pos+1)
+	case keyCtrlA, keyHome:
+		s.pos = s.lineStart()
+	case keyCtrlE, keyEnd:
+		s.pos = s.lineEnd()
+	case keyCtrlB, keyLeft:
+		if 0 < s.pos {
+			s.pos--
+		}
+	case keyCtrlF, keyRight:
+		if s.pos < len(s.buf) {
+			s.pos++
+		}
+	case keyWordLeft:
+		s.pos = s.wordStart()
+	case keyWordRight:
+		for s.pos < len(s.buf) && !isWordRune(s.buf[s.pos]) {
+			s.pos++
+		}
+		for s.pos < len(s.buf) && isWordRune(s.buf[s.pos]) {
+			s.pos++
+		}
+	case keyBackspace, keyCtrlH:
+		if 0 < s.pos {
+			s.delete(s.pos-1, s.pos)
+		}
+	case keyDelete:
+		s.delete(s.pos, s.pos+1)
+	case keyCtrlK:
+		s.delete(s.pos, s.lineEnd())
+	case keyCtrlU:
+		s.delete(s.lineStart(), s.pos)
+	case keyCtrlW:
+		s.delete(s.wordStart(), s.pos)
+	case keyCtrlL:
+		s.write("\x1b[H\x1b[2J")
+		s.row = 0
+	case keyUp, keyCtrlP:
+		if start := s.lineStart(); start != 0 {
+			previous := start - 1
+			for 0 < previous && s.buf[previous-1] != '\n' {
+				previous--
+			}
+			s.moveVertically(previous, start-1)
+			break
+		}
+		s.walkHistory(-1)
+	case keyDown, keyCtrlN:
+		if end := s.lineEnd(); end != len(s.buf) {
+			next := end + 1
+			nextEnd := next
+			for nextEnd < len(s.buf) && s.buf[nextEnd] != '\n' {
+				nextEnd++
+			}
+			s.moveVertically(next, nextEnd)
+			break
+		}
+		s.walkHistory(1)
+	case keyCtrlR:
+		s.startSearch()
+	case keyTab:
+		s.complete()
+	default:
+		if key < ' ' || unicode.MaxRune < key {
+			return false, nil
+		}
+		s.insert(key)
+	}
+
+	s.refresh()
+	return false, nil
+}
+
+// complete inserts what the candidates have in common after the cursor,
+// listing them below the line if they have nothing more in common.
+func (s *lineState) complete() {
+	if s.editor.complete == nil {
+		return
+	}
+	src := string(s.buf)
+	cursor := len(string(s.buf[:s.pos]))
+	start, candidates := s.editor.complete(src, cursor)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if typed := src[start:cursor]; len(typed) < len(common) && strings.HasPrefix(common, typed) {
+		for _, r := range common[len(typed):] {
+			s.insert(r)
+		}
+		return
+	}
+	if len(candidates) == 1 {
+		return
+	}
+
+	pos := s.pos
+	s.pos = len(s.buf)
+	s.refresh()
+	s.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+	s.pos, s.row = pos, 0
+}
+
+func (s *lineState) insert(r rune) {
+	s.buf = append(s.buf, 0)
+	copy(s.buf[s.pos+1:], s.buf[s.pos:])
+	s.buf[s.pos] = r
+	s.pos++
+}
+
+func (s *lineState) delete(start, end int) {
+	if len(s.buf) < end {
+		end = len(s.buf)
+	}
+	if end <= start {
+		return
+	}
+	s.buf = append(s.buf[:start], s.buf[end:]...)
+	s.pos = start
+}
+
+// lineStart and lineEnd return the start and the end of the row of
+// the entry where the cursor is.
+func (s *lineState) lineStart() int {
+	start := s.pos
+	for 0 < start && s.buf[start-1] != '\n' {
+		start--
+	}
+
+	return start
+}
+
+func (s *lineState) lineEnd() int {
+	end := s.pos
+	for end < len(s.buf) && s.buf[end] != '\n' {
+		end++
+	}
+
+	return end
+}
+
+func (s *lineState) wordStart() int {
+	start := s.pos
+	for 0 < start && !isWordRune(s.buf[start-1]) {
+		start--
+	}
+	for 0 < start && isWordRune(s.buf[start-1]) {
+		start--
+	}
+
+	return start
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// moveVertically moves the cursor to the row of the entry between start
+// and end, keeping the column if possible.
+func (s *lineState) moveVertically(start, end int) {
+	column := s.pos - s.lineStart()
+	s.pos = start + column
+	if end < s.pos {
+		s.pos = end
+	}
+}
+
+// walkHistory replaces the line with the entry next to the current one
+// in the direction.
+func (s *lineState) walkHistory(direction int) {
+	entries := s.editor.history.entries
+	next := s.history + direction
+	if next < 0 || len(entries) < next {
+		return
+	}
+	if s.history == len(entries) {
+		s.draft = s.buf
+	}
+
+	s.history = next
+	if next == len(entries) {
+		s.buf = s.draft
+	} else {
+		s.buf = []rune(entries[next])
+	}
+	s.pos = len(s.buf)
+}
+
+func (s *lineState) startSearch() {
+	s.searching = true
+	s.query = nil
+	s.found = s.history
+	s.beforeSearch = append([]rune(nil), s.buf...)
+	s.beforeSearchPos = s.pos
+	s.beforeSearchHist = s.history
+	s.updateSearch(s.history)
+}
+
+// search handles the key while the history is searched, reporting
+// whether the key ends the search and is to be handled as usual.
+func (s *lineState) search(key rune) bool {
+	switch key {
+	case keyCtrlR:
+		if s.found != -1 {
+			s.updateSearch(s.found)
+		}
+		return false
+	case keyBackspace, keyCtrlH:
+		if len(s.query) != 0 {
+			s.query = s.query[:len(s.query)-1]
+		}
+		s.updateSearch(s.beforeSearchHist)
+		return false
+	case keyCtrlG, keyEscape:
+		s.buf, s.pos, s.history = s.beforeSearch, s.beforeSearchPos, s.beforeSearchHist
+		s.endSearch()
+		s.refresh()
+		return false
+	case keyCtrlC:
+		s.endSearch()
+		return true
+	}
+	if ' ' <= key && key <= unicode.MaxRune {
+		s.query = append(s.query, key)
+		s.updateSearch(s.found + 1)
+		return false
+	}
+
+	s.endSearch()
+	return true
+}
+
+// updateSearch searches the query in the entries before the index,
+// showing the entry it is found in.
+func (s *lineState) updateSearch(before int) {
+	entries := s.editor.history.entries
+	if len(entries) < before {
+		before = len(entries)
+	}
+	if len(s.query) == 0 {
+		s.found = before
+		s.setSearchPrompt(true)
+		s.refresh()
+		return
+	}
+
+	query := string(s.query)
+	found := s.editor.history.search(query, before)
+	s.setSearchPrompt(found != -1)
+	if found != -1 {
+		s.found = found
+		s.history = found
+		s.buf = []rune(entries[found])
+		s.pos = len([]rune(entries[found][:strings.LastIndex(entries[found], query)]))
+	}
+	s.refresh()
+}
+
+func (s *lineState) setSearchPrompt(found bool) {
+	if found {
+		s.prompt = fmt.Sprintf("(reverse-i-search)`%s': ", string(s.query))
+	} else {
+		s.prompt = fmt.Sprintf("(failed reverse-i-search)`%s': ", string(s.query))
+	}
+}
+
+func (s *lineState) endSearch() {
+	s.searching = false
+	s.prompt = prompt
+}
+
+// refresh redraws the line from its first row, placing the cursor.
+func (s *lineState) refresh() {
+	var b strings.Builder
+	if 0 < s.row {
+		fmt.Fprintf(&b, "\x1b[%dA", s.row)
+	}
+	b.WriteString("\r\x1b[J")
+	b.WriteString(s.prompt)
+	text := string(s.buf)
+	if s.editor.highlight != nil {
+		text = s.editor.highlight(text)
+	}
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"+continuationPrompt))
+
+	endRow, endColumn := s.locate(len(s.buf))
+	if endColumn == 0 && 0 < len(s.buf) && s.buf[len(s.buf)-1] != '\n' {
+		// The cursor stays at the last column when the row is just full.
+		b.WriteString("\r\n")
+	}
+	row, column := s.locate(s.pos)
+	if row < endRow {
+		fmt.Fprintf(&b, "\x1b[%dA", endRow-row)
+	}
+	b.WriteString("\r")
+	if 0 < column {
+		fmt.Fprintf(&b, "\x1b[%dC", column)
+	}
+	s.row = row
+
+	s.write(b.String())
+}
+
+// locate returns the row and the column where the rune at the index
+// is drawn, wrapping rows at the width.
+func (s *lineState) locate(index int) (int, int) {
+	row, column := 0, len([]rune(s.prompt))
+	for column >= s.width {
+		row, column = row+1, column-s.width
+	}
+	wrapped := false
+	for _, r := range s.buf[:index] {
+		if r == '\n' {
+			// A newline just after a full row does not move to another row
+			// because the row has already been wrapped.
+			if !wrapped {
+				row++
+			}
+			column, wrapped = len(continuationPrompt), false
+			continue
+		}
+		column++
+		wrapped = column == s.width
+		if wrapped {
+			row, column = row+1, 0
+		}
+	}
+
+	return row, column
+}
+
+func (s *lineState) write(text string) {
+	io.WriteString(s.editor.w, text)
+}
+
+// isCompleteEntry reports whether the entry is complete, that is, it is
+// a command or it does not end before its braces, parentheses, comments
+// or literals end.
+func isCompleteEntry(entry string) bool {
+	if isCommand(entry) {
+		return true
+	}
+
+	fileSet := token.NewFileSet()
+	_, err := parser.ParseFile(fileSet, "", packageStatement+entry, parser.Mode(0))
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return true
+	}
+	end := len(packageStatement) + len(entry)
+	for _, err := range list {
+		if strings.Contains(err.Msg, "not terminated") {
+			return false
+		}
+		if strings.Contains(err.Msg, "found 'EOF'") && end <= err.Pos.Offset {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,212 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeTerminal struct {
+	columns int
+	raw     bool
+}
+
+func (t *fakeTerminal) makeRaw() (func() error, error) {
+	t.raw = true
+	return func() error {
+		t.raw = false
+		return nil
+	}, nil
+}
+
+func (t *fakeTerminal) width() int {
+	return t.columns
+}
+
+func TestEditor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, ".warabi_history")
+	if err := ioutil.WriteFile(filename, []byte("var a = 1\nfunc f() {\\n}\nvar b = 2\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	h, err := loadHistory(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	term := &fakeTerminal{columns: 80}
+	e := &editor{
+		w:       ioutil.Discard,
+		term:    term,
+		history: h,
+	}
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"history", "\x1b[A\r", "var b = 2", nil},
+		{"history forward", "draft\x1b[A\x1b[A\x1b[B\x1b[B\r", "draft", nil},
+		{"multi-line history", "\x10\x10\x10\r", "func f() {\n}", nil},
+		{"search", "\x12= 1\r", "var a = 1", nil},
+		{"search older", "\x12var\x12\r", "var b = 2", nil},
+		{"search cancel", "draft\x12zzz\x07!\r", "draft!", nil},
+		{"search then edit", "\x12raf\x05?\r", "draft!?", nil},
+		{"enter", "1 + 2\r", "1 + 2", nil},
+		{"left", "ac\x02b\r", "abc", nil},
+		{"home and end", "bc\x01a\x05d\r", "abcd", nil},
+		{"arrows", "ac\x1b[Db\x1b[Cd\r", "abcd", nil},
+		{"backspace", "abcd\x7f\r", "abc", nil},
+		{"delete", "xabc\x01\x1b[3~\r", "abc", nil},
+		{"kill line", "abc\x1b[D\x1b[D\x0b\r", "a", nil},
+		{"kill line backward", "abc\x1b[D\x15\r", "c", nil},
+		{"kill word", "var apple\x17banana\r", "var banana", nil},
+		{"word moves", "var banana\x1bbapple \x1bf!\r", "var apple banana!", nil},
+		{"multi-line", "func g() {\r}\r", "func g() {\n}", nil},
+		{"multi-line move", "var (\r)\x1b[A\x05a = 1\x1b[B\r", "var (a = 1\n)", nil},
+		{"interrupt", "abc\x03", "", errInterrupted},
+		{"EOF", "\x04", "", io.EOF},
+		{"EOF in multi-line", "func h() {\r\x04", "", io.EOF},
+	}
+	for _, test := range tests {
+		e.r = bufio.NewReader(strings.NewReader(test.input))
+		got, err := e.readLine()
+		if err != test.wantErr {
+			t.Errorf("%s: unexpected error: got %v, expected %v\n", test.name, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("%s: unexpected line: got %q, expected %q\n", test.name, got, test.want)
+		}
+		if term.raw {
+			t.Errorf("%s: terminal is left in raw mode\n", test.name)
+		}
+	}
+
+	saved, err := loadHistory(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if got, want := strings.Join(saved.entries, "|"), strings.Join(h.entries, "|"); got != want {
+		t.Errorf("unexpected saved history: got %q, expected %q\n", got, want)
+	}
+	if got, want := h.entries[len(h.entries)-1], "var (a = 1\n)"; got != want {
+		t.Errorf("unexpected last entry: got %q, expected %q\n", got, want)
+	}
+}
+
+func TestEditorComplete(t *testing.T) {
+	e := &editor{
+		w:       ioutil.Discard,
+		term:    &fakeTerminal{columns: 80},
+		history: &history{},
+		complete: func(src string, cursor int) (int, []string) {
+			start := strings.LastIndexAny(src[:cursor], " .") + 1
+			var names []string
+			for _, name := range []string{"apple", "apricot", "banana"} {
+				if strings.HasPrefix(name, src[start:cursor]) {
+					names = append(names, name)
+				}
+			}
+			return start, names
+		},
+	}
+	tests := map[string]string{
+		"1 + b\t":          "1 + banana",
+		"1 + a\t":          "1 + ap",
+		"1 + a\tr\t":       "1 + apricot",
+		"a\t\t\x01x.\t":    "x.ap",
+		"1 + c\t":          "1 + c",
+		"1 + b\x01\t\x05!": "1 + b!",
+	}
+	for input, want := range tests {
+		e.r = bufio.NewReader(strings.NewReader(input + "\r"))
+		if got, err := e.readLine(); err != nil || got != want {
+			t.Errorf("unexpected line of %q: got %q, %v, expected %q\n", input, got, err, want)
+		}
+	}
+}
+
+func TestEditorRefresh(t *testing.T) {
+	var w bytes.Buffer
+	e := &editor{
+		r:       bufio.NewReader(strings.NewReader("abcdefghij\x01\r")),
+		w:       &w,
+		term:    &fakeTerminal{columns: 6},
+		history: &history{},
+	}
+	if _, err := e.readLine(); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	// The line wraps twice, so the cursor moves up to the start and
+	// then down to the end.
+	got := w.String()
+	got = got[strings.LastIndex(got, "\x1b[2A"):]
+	want := "\x1b[2A\r\x1b[2C\r\x1b[J> abcdefghij\r\n\r\r\n"
+	if got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	s := &lineState{
+		width:  6,
+		prompt: "> ",
+		buf:    []rune("abcd\nefghi"),
+	}
+	tests := []struct {
+		index       int
+		row, column int
+	}{
+		{0, 0, 2},
+		{3, 0, 5},
+		{4, 1, 0},
+		{5, 1, 4},
+		{6, 1, 5},
+		{7, 2, 0},
+		{10, 2, 3},
+	}
+	for _, test := range tests {
+		if row, column := s.locate(test.index); row != test.row || column != test.column {
+			t.Errorf("unexpected location of %d: got %d:%d, expected %d:%d\n", test.index, row, column, test.row, test.column)
+		}
+	}
+}
+
+func TestIsCompleteEntry(t *testing.T) {
+	tests := map[string]bool{
+		"":                    true,
+		"var a = 1":           true,
+		":env":                true,
+		"func f() {":          false,
+		"func f() {\n}":       true,
+		"var s = `raw":        false,
+		"/* comment":          false,
+		"var (\n\ta = 1":      false,
+		"var = 1":             true,
+		"func f() { a := ( }": true,
+	}
+	for entry, want := range tests {
+		if got := isCompleteEntry(entry); got != want {
+			t.Errorf("unexpected completeness of %q: got %t, expected %t\n", entry, got, want)
+		}
+	}
+}
+
+func TestHistoryEscape(t *testing.T) {
+	for _, entry := range []string{"a", "a\nb", `a\nb`, `a\`, "\\\n"} {
+		if got := unescapeHistoryEntry(escapeHistoryEntry(entry)); got != entry {
+			t.Errorf("unexpected entry: got %q, expected %q\n", got, entry)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// maxHistory is the number of the entries which the history keeps.
+const maxHistory = 1000
+
+// history is the history of the entries of the line editor, which is
+// persisted in a file, if any, one entry per line with the newlines in
+// entries escaped.
+type history struct {
+	entries  []string
+	filename string
+}
+
+// loadHistory loads the history in the file, which may not exist yet.
+func loadHistory(filename string) (*history, error) {
+	h := &history{
+		filename: filename,
+	}
+	if filename == "" {
+		return h, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, unescapeHistoryEntry(line))
+		}
+	}
+	if maxHistory < len(h.entries) {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+
+	return h, scanner.Err()
+}
+
+// add adds the entry unless it is empty or the same as the last one,
+// appending it to the file.
+func (h *history) add(entry string) error {
+	if strings.TrimSpace(entry) == "" {
+		return nil
+	}
+	if len(h.entries) != 0 && h.entries[len(h.entries)-1] == entry {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if maxHistory < len(h.entries) {
+		h.entries = h.entries[1:]
+	}
+	if h.filename == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(escapeHistoryEntry(entry) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// search returns the index of the newest entry before the index which
+// contains query, or -1.
+func (h *history) search(query string, before int) int {
+	for i := before - 1; 0 <= i; i-- {
+		if strings.Contains(h.entries[i], query) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func escapeHistoryEntry(entry string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(entry)
+}
+
+func unescapeHistoryEntry(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] != '\\' || i == len(line)-1 {
+			b.WriteByte(line[i])
+			continue
+		}
+		i++
+		if line[i] == 'n' {
+			b.WriteByte('\n')
+		} else {
+			b.WriteByte(line[i])
+		}
+	}
+
+	return b.String()
+}
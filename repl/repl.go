@@ -2,6 +2,8 @@ package repl
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"go/ast"
 	"go/parser"
@@ -10,9 +12,10 @@ import (
 	"os"
 	"os/signal"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/tomocy/warabi/evaluator"
+	"github.com/tomocy/warabi/object"
 )
 
 const packageStatement = "package main\n"
@@ -25,88 +28,387 @@ func NewStandard(r io.Reader, w io.Writer) REPLer {
 	return newStandard(r, w)
 }
 
-func NewWarabi(r io.Reader, w io.Writer) REPLer {
-	return newWarabi(r, w)
+func NewWarabi(r io.Reader, w io.Writer, opts ...Option) REPLer {
+	repler := newWarabi(r, w)
+	for _, opt := range opts {
+		opt(repler)
+	}
+
+	return repler
+}
+
+type Option func(*warabi)
+
+func WithInterpreter(interpreter *evaluator.Interpreter) Option {
+	return func(repler *warabi) {
+		repler.interpreter = interpreter
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(repler *warabi) {
+		repler.timeout = timeout
+	}
+}
+
+// WithSession restores the session saved in the file, if any, when the
+// REPL starts, and saves the session to it when the REPL quits.
+func WithSession(filename string) Option {
+	return func(repler *warabi) {
+		repler.sessionFile = filename
+	}
+}
+
+// WithoutColor writes no colors even to a terminal, as NO_COLOR does.
+func WithoutColor() Option {
+	return func(repler *warabi) {
+		repler.color = false
+	}
+}
+
+// WithHistory persists the history of the line editor in the file.
+func WithHistory(filename string) Option {
+	return func(repler *warabi) {
+		repler.historyFile = filename
+	}
 }
 
 type standard struct {
 	*repler
+	fileSet *token.FileSet
 }
 
 func newStandard(r io.Reader, w io.Writer) *standard {
 	return &standard{
-		repler: new(r, w),
+		repler:  new(r, w),
+		fileSet: token.NewFileSet(),
 	}
 }
 
 func (repler standard) REPL() {
-	go repler.waitSignal()
-	repler.repl()
+	repler.repl(repler.evaluate)
+	repler.quit()
 }
 
-func (repler standard) repl() {
-	scanner := bufio.NewScanner(repler.r)
-	fileSet := token.NewFileSet()
-	for scanner.Scan() {
-		src := packageStatement + scanner.Text()
-		file, _ := parser.ParseFile(fileSet, "example.go", src, parser.Mode(0))
-		ast.Print(fileSet, file)
-		repler.println()
-	}
+func (repler standard) evaluate(ctx context.Context, src string) string {
+	file, _ := parser.ParseFile(repler.fileSet, "example.go", packageStatement+src, parser.Mode(0))
+	var b bytes.Buffer
+	ast.Fprint(&b, repler.fileSet, file, ast.NotNilFilter)
+	return b.String()
 }
 
 type warabi struct {
 	*repler
+	interpreter  *evaluator.Interpreter
+	timeout      time.Duration
+	declarations *declarations
+	debugging    *debugging
+	sessionFile  string
+	transcript   io.Writer
+	// results is the number of the last result, which is kept in $n.
+	results int
 }
 
 func newWarabi(r io.Reader, w io.Writer) *warabi {
 	return &warabi{
-		repler: new(r, w),
+		repler:       new(r, w),
+		interpreter:  evaluator.NewInterpreter(evaluator.TreeWalk),
+		declarations: &declarations{},
 	}
 }
 
-func (repler warabi) REPL() {
-	go repler.waitSignal()
-	repler.repl()
+func (repler *warabi) REPL() {
+	repler.repler.complete = repler.complete
+	if repler.sessionFile != "" {
+		err := repler.loadSession(context.Background(), repler.sessionFile)
+		if err != nil && !os.IsNotExist(err) {
+			repler.printf("failed to load the session: %s\n", err)
+		}
+	}
+
+	evaluate := repler.evaluate
+	if repler.transcript != nil {
+		r := &recorder{
+			w: repler.transcript,
+		}
+		repler.interpreter.SetOutput(io.MultiWriter(repler.w, r))
+		evaluate = r.evaluate(repler)
+	}
+	repler.repl(evaluate)
+
+	if repler.sessionFile != "" {
+		warnings, err := repler.saveSession(repler.sessionFile)
+		for _, warning := range warnings {
+			repler.println(warning)
+		}
+		if err != nil {
+			repler.printf("failed to save the session: %s\n", err)
+		}
+	}
+	repler.quit()
 }
 
-func (repler warabi) repl() {
-	scanner := bufio.NewScanner(repler.r)
-	for scanner.Scan() {
-		objs := evaluator.Evaluate(scanner.Text())
-		strs := make([]string, len(objs))
-		for i, obj := range objs {
-			strs[i] = obj.String()
+// complete completes the name of a command, or the identifier in
+// the source or the argument of a command.
+func (repler *warabi) complete(src string, cursor int) (int, []string) {
+	offset := 0
+	if isCommand(src) {
+		start := strings.Index(src, commandPrefix)
+		i := strings.IndexAny(src[start:], " \t")
+		if i == -1 || cursor <= start+i {
+			var names []string
+			for _, command := range repler.commands() {
+				if strings.HasPrefix(command.name, src[start:cursor]) {
+					names = append(names, command.name)
+				}
+			}
+			return start, names
 		}
-		repler.println(strings.Join(strs, ", "))
+		offset = start + i
+		src, cursor = src[offset:], cursor-offset
 	}
+
+	var names []string
+	for _, candidate := range repler.interpreter.Complete(src, cursor) {
+		names = append(names, candidate.Name)
+	}
+
+	return offset + evaluator.IdentifierStart(src, cursor), names
+}
+
+func (repler *warabi) evaluate(ctx context.Context, src string) string {
+	return repler.evaluateEntry(ctx, src).render(src, repler.color, repler.terminal)
+}
+
+// entryResult is what an entry results in: the output of a command, or
+// the objects or the error of the evaluation. name is what the result
+// is referred to as, such as $1, if the entry is an expression.
+type entryResult struct {
+	output string
+	objs   []object.Object
+	name   string
+	err    error
+}
+
+func (repler *warabi) evaluateEntry(ctx context.Context, src string) entryResult {
+	if repler.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, repler.timeout)
+		defer cancel()
+	}
+	if isCommand(src) {
+		return entryResult{
+			output: repler.runCommand(ctx, src),
+		}
+	}
+
+	src, names, err := expandResults(src)
+	if err != nil {
+		return entryResult{
+			err: err,
+		}
+	}
+	if fileSet, exprs, ok := parseExpressions(src); ok {
+		result := repler.evaluateExpressions(ctx, src, fileSet, exprs)
+		if result.err != nil {
+			result.err = restoreResults(result.err, names)
+		}
+		return result
+	}
+
+	objs, err := repler.interpreter.EvaluateContext(ctx, src)
+	if err != nil {
+		return entryResult{
+			err: restoreResults(err, names),
+		}
+	}
+	if err := repler.declarations.record(packageStatement + src); err != nil {
+		return entryResult{
+			err: err,
+		}
+	}
+
+	return entryResult{
+		objs: objs,
+	}
+}
+
+// render renders the result of the entry src, coloring it if color is
+// set and pointing where the error is in src if terminal is set.
+func (r entryResult) render(src string, color, terminal bool) string {
+	switch {
+	case r.err != nil:
+		msg := r.err.Error()
+		if color {
+			msg = paint(colorRed, msg)
+		}
+		if !terminal {
+			return msg
+		}
+		if point := pointError(src, r.err); point != "" {
+			msg += "\n" + point
+		}
+		return msg
+	case r.name != "":
+		return describeResult(r.name, r.objs, color)
+	case r.objs != nil && color:
+		strs := make([]string, len(r.objs))
+		for i, obj := range r.objs {
+			strs[i] = paintObject(obj)
+		}
+		return strings.Join(strs, ", ")
+	case r.objs != nil:
+		return joinObjects(r.objs)
+	default:
+		return r.output
+	}
+}
+
+func joinObjects(objs []object.Object) string {
+	strs := make([]string, len(objs))
+	for i, obj := range objs {
+		strs[i] = obj.String()
+	}
+	return strings.Join(strs, ", ")
 }
 
 type repler struct {
-	r     io.Reader
-	w     io.Writer
-	sigCh chan os.Signal
+	r           io.Reader
+	w           io.Writer
+	sigCh       chan os.Signal
+	historyFile string
+	complete    func(src string, cursor int) (int, []string)
+	// terminal reports whether w is a terminal, and color reports
+	// whether colors are written to it.
+	terminal bool
+	color    bool
 }
 
 func new(r io.Reader, w io.Writer) *repler {
-	sigCh := make(chan os.Signal)
-	signal.Notify(sigCh, syscall.SIGINT)
 	return &repler{
-		r:     r,
-		w:     w,
-		sigCh: sigCh,
+		r:        r,
+		w:        w,
+		sigCh:    make(chan os.Signal, 1),
+		terminal: isTerminal(w),
+		color:    colorsEnabled(w),
 	}
 }
 
-func (repler repler) waitSignal() {
+// repl handles the interrupts only while it runs so that the repler which
+// never runs, such as the one replaying a transcript, leaves them alone.
+func (repler repler) repl(evaluate func(context.Context, string) string) {
+	signal.Notify(repler.sigCh, os.Interrupt)
+	defer signal.Stop(repler.sigCh)
+
+	lines, next := repler.scan()
+	var interrupted bool
 	for {
 		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			interrupted = false
+			repler.evaluate(evaluate, line)
 		case <-repler.sigCh:
-			repler.println()
-			repler.println("See you later")
-			os.Exit(1)
+			if interrupted {
+				return
+			}
+			interrupted = true
+			repler.println("^C")
+			repler.println("(To quit, press Ctrl-C again or Ctrl-D)")
+		}
+		// The next line is read after the result is printed so that
+		// the line editor does not draw its prompt before it.
+		select {
+		case next <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// scan reads lines one by one each time next is sent. Ctrl-C pressed in
+// the line editor is sent to sigCh as SIGINT is.
+func (repler repler) scan() (<-chan string, chan<- struct{}) {
+	lines := make(chan string)
+	next := make(chan struct{}, 1)
+	next <- struct{}{}
+	go func() {
+		defer close(lines)
+		reader := repler.lineReader()
+		for range next {
+			line, err := reader.readLine()
+			if err == errInterrupted {
+				select {
+				case repler.sigCh <- os.Interrupt:
+				default:
+				}
+				continue
+			}
+			if err != nil {
+				return
+			}
+			lines <- line
 		}
+	}()
+
+	return lines, next
+}
+
+// lineReader returns the line editor if the input is a terminal, or
+// the scanner of the input otherwise.
+func (repler repler) lineReader() lineReader {
+	f, ok := repler.r.(*os.File)
+	if !ok {
+		return lineScanner{scanner: bufio.NewScanner(repler.r)}
+	}
+	term, ok := newTerminal(f)
+	if !ok {
+		return lineScanner{scanner: bufio.NewScanner(repler.r)}
+	}
+
+	h, err := loadHistory(repler.historyFile)
+	if err != nil {
+		repler.printf("failed to load the history: %s\n", err)
+		h = &history{}
 	}
+	e := &editor{
+		r:        bufio.NewReader(f),
+		w:        repler.w,
+		term:     term,
+		history:  h,
+		complete: repler.complete,
+	}
+	if repler.color {
+		e.highlight = highlight
+	}
+	return e
+}
+
+func (repler repler) evaluate(evaluate func(context.Context, string) string, src string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resultCh := make(chan string)
+	go func() {
+		resultCh <- evaluate(ctx, src)
+	}()
+
+	select {
+	case result := <-resultCh:
+		if result != "" {
+			repler.println(result)
+		}
+	case <-repler.sigCh:
+		cancel()
+		<-resultCh
+		repler.println("^C")
+	}
+}
+
+func (repler repler) quit() {
+	repler.println()
+	repler.println("See you later")
 }
 
 func (repler repler) print(a ...interface{}) {
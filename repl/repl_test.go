@@ -0,0 +1,261 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarabiREPL(t *testing.T) {
+	r := strings.NewReader("var a = 1 + 2\nvar b = a * 2\n")
+	var w bytes.Buffer
+	repler := newWarabi(r, &w)
+
+	runREPL(t, repler)
+
+	want := "3\n6\n\nSee you later\n"
+	if got := w.String(); got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
+
+func TestWarabiREPLInterrupt(t *testing.T) {
+	r, pw := io.Pipe()
+	defer pw.Close()
+	var w bytes.Buffer
+	repler := newWarabi(r, &w)
+	repler.sigCh <- os.Interrupt
+	go func() {
+		repler.sigCh <- os.Interrupt
+	}()
+
+	runREPL(t, repler)
+
+	want := "^C\n(To quit, press Ctrl-C again or Ctrl-D)\n\nSee you later\n"
+	if got := w.String(); got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
+
+func TestWarabiREPLCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+
+	input := []string{
+		":reset",
+		`var a, b = 1, "go"`,
+		":env",
+		":type a + 2.0",
+		":del b",
+		":env",
+		":save " + filename,
+		":unknown",
+	}
+	r := strings.NewReader(strings.Join(input, "\n") + "\n")
+	var w bytes.Buffer
+	repler := newWarabi(r, &w)
+
+	runREPL(t, repler)
+
+	want := strings.Join([]string{
+		"1, go",
+		"a int = 1",
+		"b string = go",
+		"float32",
+		"a int = 1",
+		"saved to " + filename,
+		"unknown command: :unknown (see :help)",
+		"",
+		"See you later",
+		"",
+	}, "\n")
+	if got := w.String(); got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	wantSrc := "package main\n\nvar a = 1\n\nfunc main() {}\n"
+	if string(src) != wantSrc {
+		t.Errorf("unexpected program: got %q, expected %q\n", src, wantSrc)
+	}
+}
+
+func TestWarabiREPLDebug(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	src := "package main\n\nimport \"fmt\"\n\nfunc show(n int) {\n\tfmt.Println(n)\n}\n\nfunc main() {\n\tn := 1\n\tshow(n + 1)\n}\n"
+	if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	input := []string{
+		":step",
+		":debug " + filename,
+		":break show",
+		":break main.go:3",
+		":continue",
+		":stack",
+		":locals",
+		":frame 1",
+		":print n * 10",
+		":next",
+		":locals",
+	}
+	r := strings.NewReader(strings.Join(input, "\n") + "\n")
+	var w bytes.Buffer
+	repler := newWarabi(r, &w)
+
+	runREPL(t, repler)
+
+	want := strings.Join([]string{
+		"no program is being debugged (see :debug)",
+		"debugging " + filename + " (:continue or :step to start)",
+		"breakpoint 1 at show",
+		"no statement at main.go:3",
+		"stopped at main.go:6 in show (breakpoint 1)",
+		"6\tfmt.Println(n)",
+		"* 0 show at main.go:6",
+		"  1 main at main.go:11",
+		"n int = 2",
+		"10",
+		"2",
+		"program exited",
+		"no program is being debugged (see :debug)",
+		"",
+		"See you later",
+		"",
+	}, "\n")
+	if got := w.String(); got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
+
+func runREPL(t *testing.T, repler REPLer) {
+	doneCh := make(chan struct{})
+	go func() {
+		repler.REPL()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second):
+		t.Fatalf("REPL did not return\n")
+	}
+}
+
+func TestWarabiComplete(t *testing.T) {
+	repler := newWarabi(strings.NewReader(""), ioutil.Discard)
+	if _, err := repler.interpreter.Evaluate("var apple = 1\nvar apricot = 2\n"); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	tests := map[string]string{
+		"1 + ap":     "4 [apple apricot]",
+		":de":        "0 [:del :debug]",
+		"  :s":       "2 [:save :save-session :step :stepout :stack]",
+		":type appl": "6 [apple]",
+	}
+	for src, want := range tests {
+		start, names := repler.complete(src, len(src))
+		if got := fmt.Sprint(start, " ", names); got != want {
+			t.Errorf("unexpected completion of %q: got %s, expected %s\n", src, got, want)
+		}
+	}
+}
+
+func TestWarabiShowType(t *testing.T) {
+	var w strings.Builder
+	repler := newWarabi(strings.NewReader(""), &w)
+	repler.interpreter.SetOutput(&w)
+	if _, err := repler.interpreter.Evaluate(`import "fmt"; func f() int { fmt.Println("SIDE EFFECT") }`); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	tests := map[string]string{
+		":type f()":              "int",
+		":type fmt.Sprint(f())":  "string",
+		":type fmt.Println(f())": "<nil>",
+	}
+	for src, want := range tests {
+		if got := repler.evaluate(context.Background(), src); got != want {
+			t.Errorf("unexpected type of %q: got %q, expected %q\n", src, got, want)
+		}
+	}
+	if got := w.String(); got != "" {
+		t.Errorf("unexpected output: %q\n", got)
+	}
+}
+
+func TestWarabiSave(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command is not found")
+	}
+	dir, err := os.MkdirTemp("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+
+	repler := newWarabi(strings.NewReader(""), io.Discard)
+	srcs := []string{
+		`import "fmt"`,
+		`import s "strings"`,
+		`import f "fmt"`,
+		"var a = 1",
+		"func main() { fmt.Println(a) }",
+		":save " + filename,
+	}
+	for _, src := range srcs {
+		repler.evaluate(context.Background(), src)
+	}
+
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	want := "package main\n\nimport \"fmt\"\n\nvar a = 1\n\nfunc main() { fmt.Println(a) }\n"
+	if got := string(src); got != want {
+		t.Errorf("unexpected program: got %q, expected %q\n", got, want)
+	}
+	out, err := exec.Command("go", "run", filename).CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run the program: %s\n%s", err, out)
+	}
+	if got := string(out); got != "1\n" {
+		t.Errorf("unexpected output: %q\n", got)
+	}
+}
+
+func TestWarabiWithoutColor(t *testing.T) {
+	repler := newWarabi(strings.NewReader(""), io.Discard)
+	repler.color = true
+	if got := repler.evaluate(context.Background(), "1"); !strings.Contains(got, colorReset) {
+		t.Fatalf("unexpected output without colors: %q\n", got)
+	}
+
+	WithoutColor()(repler)
+	if got, want := repler.evaluate(context.Background(), "2"), "$2 int = 2"; got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
@@ -0,0 +1,305 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tomocy/warabi/object"
+)
+
+// lastResult is the variable which keeps the result of the last
+// expression.
+const lastResult = "_"
+
+// resultName returns the name of the variable which keeps the nth
+// result, which entries refer to as $n. It is as long as $n so that
+// the positions in entries are kept, and entries can not use it as
+// expandResults reserves it.
+func resultName(n int) string {
+	return "_" + strconv.Itoa(n)
+}
+
+func isResultName(name string) bool {
+	return 1 < len(name) && name[0] == '_' && isDigits(name[1:])
+}
+
+// resultNumber returns n of the name of the nth result.
+func resultNumber(name string) int {
+	n, _ := strconv.Atoi(name[1:])
+	return n
+}
+
+// referredName returns the name which entries refer to the variable of
+// name as, which is $n if it keeps the nth result.
+func referredName(name string) string {
+	if isResultName(name) {
+		return "$" + name[1:]
+	}
+
+	return name
+}
+
+// expandResults replaces $n in src with the name of the variable which
+// keeps the nth result, returning the names it replaced. It reports an
+// error if src uses the name of a result itself, which would refer to
+// or shadow the result.
+func expandResults(src string) (string, []string, error) {
+	fileSet := token.NewFileSet()
+	file := fileSet.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, 0)
+
+	expanded := []byte(src)
+	var names []string
+	dollar := -1
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := file.Offset(pos)
+		if tok == token.IDENT && isResultName(lit) {
+			position := file.Position(pos)
+			return "", nil, fmt.Errorf(
+				"main.go:%d:%d: cannot use %s: the name is reserved for the result $%s",
+				position.Line+strings.Count(packageStatement, "\n"), position.Column, lit, lit[1:],
+			)
+		}
+		if tok == token.INT && dollar != -1 && dollar == offset-1 && isDigits(lit) {
+			expanded[dollar] = '_'
+			names = append(names, "_"+lit)
+		}
+		dollar = -1
+		if tok == token.ILLEGAL && lit == "$" {
+			dollar = offset
+		}
+	}
+
+	return string(expanded), names, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || '9' < r {
+			return false
+		}
+	}
+
+	return true
+}
+
+var resultNamePattern = regexp.MustCompile(`\b_[0-9]+\b`)
+
+// restoreResults replaces the names in the error with $n, which the
+// entry referred to them as, keeping the error to unwrap.
+func restoreResults(err error, names []string) error {
+	if len(names) == 0 {
+		return err
+	}
+
+	replaced := make(map[string]bool, len(names))
+	for _, name := range names {
+		replaced[name] = true
+	}
+	msg := resultNamePattern.ReplaceAllStringFunc(err.Error(), func(name string) string {
+		if !replaced[name] {
+			return name
+		}
+		return referredName(name)
+	})
+
+	return &resultError{
+		msg: msg,
+		err: err,
+	}
+}
+
+// resultError is an error whose message refers to the results as $n.
+type resultError struct {
+	msg string
+	err error
+}
+
+func (e *resultError) Error() string {
+	return e.msg
+}
+
+func (e *resultError) Unwrap() error {
+	return e.err
+}
+
+// expressionsPrefix is followed by an entry to parse it as the list of
+// expressions, which starts on the line after it.
+const expressionsPrefix = packageStatement + "var _ =\n"
+
+// parseExpressions parses src as a list of expressions, reporting
+// whether it is.
+func parseExpressions(src string) (*token.FileSet, []ast.Expr, bool) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", expressionsPrefix+src, parser.Mode(0))
+	if err != nil || len(file.Decls) != 1 {
+		return nil, nil, false
+	}
+	decl, ok := file.Decls[0].(*ast.GenDecl)
+	if !ok || decl.Tok != token.VAR || len(decl.Specs) != 1 {
+		return nil, nil, false
+	}
+
+	return fileSet, decl.Specs[0].(*ast.ValueSpec).Values, true
+}
+
+// tuple is the result of a list of expressions such as 1, "a". It is the
+// only way to have multiple results since functions can not return any.
+type tuple []object.Object
+
+func (t tuple) Kind() object.Kind {
+	return object.Unknown
+}
+
+func (t tuple) String() string {
+	return "(" + joinObjects(t) + ")"
+}
+
+// evaluateExpressions evaluates the expressions of the entry src,
+// keeping the result in the next $n and _. A call without results is
+// evaluated as a statement.
+func (repler *warabi) evaluateExpressions(ctx context.Context, src string, fileSet *token.FileSet, exprs []ast.Expr) entryResult {
+	objs := make([]object.Object, len(exprs))
+	for i, expr := range exprs {
+		start := fileSet.Position(expr.Pos()).Offset - len(expressionsPrefix)
+		end := fileSet.Position(expr.End()).Offset - len(expressionsPrefix)
+		obj, err := repler.interpreter.EvaluateExpression(ctx, expressionSource(src, start, end))
+		if err != nil {
+			return entryResult{
+				err: err,
+			}
+		}
+		if obj == nil && len(exprs) == 1 {
+			return entryResult{}
+		}
+		if obj == nil {
+			pos := fileSet.Position(expr.Pos())
+			line := pos.Line - strings.Count(expressionsPrefix, "\n") + strings.Count(packageStatement, "\n")
+			return entryResult{
+				err: fmt.Errorf("main.go:%d:%d: %s (no value) used as value", line, pos.Column, types.ExprString(expr)),
+			}
+		}
+		objs[i] = obj
+	}
+
+	if t, ok := objs[0].(tuple); ok && len(objs) == 1 {
+		objs = t
+	}
+	name := repler.nextResultName()
+	var result object.Object = tuple(objs)
+	if len(objs) == 1 {
+		result = objs[0]
+		repler.declareResult(name, src, fileSet, exprs[0])
+	}
+	repler.interpreter.Env().Set(name, result)
+	repler.interpreter.Env().Set(lastResult, result)
+
+	return entryResult{
+		objs: objs,
+		name: referredName(name),
+	}
+}
+
+// declareResult declares the variable of the result of expr so that the
+// declarations referring to it are saved with it. _ in expr is replaced
+// with the variable of the result it is bound to, which the declaration
+// refers to instead since _ is bound to another one later.
+func (repler *warabi) declareResult(name, src string, fileSet *token.FileSet, expr ast.Expr) {
+	offset := func(pos token.Pos) int {
+		return fileSet.Position(pos).Offset - len(expressionsPrefix)
+	}
+	start, end := offset(expr.Pos()), offset(expr.End())
+	var b strings.Builder
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FuncLit); ok {
+			return false
+		}
+		ident, ok := node.(*ast.Ident)
+		if !ok || ident.Name != lastResult {
+			return true
+		}
+		b.WriteString(src[start:offset(ident.Pos())])
+		b.WriteString(repler.lastResultName())
+		start = offset(ident.End())
+		return true
+	})
+	b.WriteString(src[start:end])
+
+	repler.declarations.add(declaration{
+		names: []string{name},
+		src:   fmt.Sprintf("var %s = %s", name, b.String()),
+	})
+}
+
+// lastResultName returns the name of the variable of the result which
+// _ is bound to, or _ if it is not bound to a result.
+func (repler *warabi) lastResultName() string {
+	env := repler.interpreter.Env()
+	last, _ := env.Get(lastResult)
+	for n := repler.results; 0 < n; n-- {
+		name := resultName(n)
+		if obj, ok := env.Get(name); ok && obj == last && repler.declarations.declares(name) {
+			return name
+		}
+	}
+
+	return lastResult
+}
+
+// expressionSource returns the source of the expression at src[start:end]
+// which is evaluated at the same position as in the snippet src.
+func expressionSource(src string, start, end int) string {
+	blank := []byte(src[:start])
+	for i, b := range blank {
+		if b != '\n' {
+			blank[i] = ' '
+		}
+	}
+
+	return strings.Repeat("\n", strings.Count(packageStatement, "\n")) + string(blank) + src[start:end]
+}
+
+// nextResultName returns the name of the variable which keeps the next
+// result, skipping the names which are already bound.
+func (repler *warabi) nextResultName() string {
+	for {
+		repler.results++
+		name := resultName(repler.results)
+		if _, ok := repler.interpreter.Env().Get(name); !ok && !repler.declarations.declares(name) {
+			return name
+		}
+	}
+}
+
+// describeResult describes the result of an expression, or the tuple of
+// the results of a list of expressions, as :env describes variables.
+func describeResult(name string, objs []object.Object, color bool) string {
+	kinds, values := make([]string, len(objs)), make([]string, len(objs))
+	for i, obj := range objs {
+		kinds[i], values[i] = obj.Kind().String(), obj.String()
+		if color {
+			values[i] = paintObject(obj)
+		}
+	}
+	if len(objs) == 1 && objs[0].Kind() == object.Function {
+		return fmt.Sprintf("%s %s", name, kinds[0])
+	}
+	if len(objs) == 1 {
+		return fmt.Sprintf("%s %s = %s", name, kinds[0], values[0])
+	}
+
+	return fmt.Sprintf("%s (%s) = (%s)", name, strings.Join(kinds, ", "), strings.Join(values, ", "))
+}
@@ -0,0 +1,144 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tomocy/warabi/evaluator"
+)
+
+func TestExpandResults(t *testing.T) {
+	tests := []struct {
+		src       string
+		want      string
+		wantNames []string
+		wantErr   string
+	}{
+		{"$1 + $23", "_1 + _23", []string{"_1", "_23"}, ""},
+		{`"$1" + $2 // $3`, `"$1" + _2 // $3`, []string{"_2"}, ""},
+		{"$ 1 + $x + $0x1", "$ 1 + $x + $0x1", nil, ""},
+		{"a + b + _ + _a", "a + b + _ + _a", nil, ""},
+		{"var a, _12 = 1, 2", "", nil, "main.go:2:8: cannot use _12: the name is reserved for the result $12"},
+	}
+	for _, test := range tests {
+		got, names, err := expandResults(test.src)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("unexpected error of %q: got %v, expected %s\n", test.src, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error of %q: %s\n", test.src, err)
+		}
+		if got != test.want {
+			t.Errorf("unexpected expansion of %q: got %q, expected %q\n", test.src, got, test.want)
+		}
+		if !reflect.DeepEqual(names, test.wantNames) {
+			t.Errorf("unexpected names of %q: got %v, expected %v\n", test.src, names, test.wantNames)
+		}
+	}
+}
+
+func TestRestoreResults(t *testing.T) {
+	original := &evaluator.StepLimitError{
+		Limit: 1,
+	}
+	err := restoreResults(fmt.Errorf("_1 + _10: %w", original), []string{"_1"})
+	if got, want := err.Error(), "$1 + _10: step limit exceeded: 1"; got != want {
+		t.Errorf("unexpected message: got %q, expected %q\n", got, want)
+	}
+	var limitErr *evaluator.StepLimitError
+	if !errors.As(err, &limitErr) || limitErr != original {
+		t.Errorf("unexpected error: got %v, expected to unwrap %v\n", err, original)
+	}
+}
+
+func TestWarabiEvaluateResults(t *testing.T) {
+	repler := newWarabi(strings.NewReader(""), ioutil.Discard)
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"40 + 2", "$1 int = 42"},
+		{"$1 * 2", "$2 int = 84"},
+		{"_ + 1", "$3 int = 85"},
+		{`1, "x", $2 == 84`, "$4 (int, string, bool) = (1, x, true)"},
+		{"_", "$5 (int, string, bool) = (1, x, true)"},
+		{"var a = $3 - $1", "43"},
+		{"func f() {}", ""},
+		{"f()", ""},
+		{"f(), 1", "main.go:2:1: f() (no value) used as value"},
+		{"$9", "main.go:2:1: undefined: $9"},
+		{`"a" + $1`, `main.go:2:5: invalid operation: "a" + $1 (mismatched types string and int)`},
+		{"f", "$6 func"},
+		{"var _1 = 9", "main.go:2:5: cannot use _1: the name is reserved for the result $1"},
+		{"_1", "main.go:2:1: cannot use _1: the name is reserved for the result $1"},
+		{":env", strings.Join([]string{
+			"$1 int = 42",
+			"$2 int = 84",
+			"$3 int = 85",
+			"$4 (int, string, bool) = (1, x, true)",
+			"$5 (int, string, bool) = (1, x, true)",
+			"$6 func",
+			"_ func",
+			"a int = 43",
+			"f func",
+		}, "\n")},
+		{":del $5", ""},
+		{"$5", "main.go:2:1: undefined: $5"},
+		{":del $9", "undefined: $9"},
+	}
+	for _, test := range tests {
+		if got := repler.evaluate(context.Background(), test.src); got != test.want {
+			t.Errorf("unexpected output of %q: got %q, expected %q\n", test.src, got, test.want)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	repler.evaluate(context.Background(), ":save "+filename)
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	want := "package main\n\nvar _1 = 40 + 2\n\nvar _2 = _1 * 2\n\nvar _3 = _2 + 1\n\nvar a = _3 - _1\n\nfunc f() {}\n\nvar _6 = f\n\nfunc main() {}\n"
+	if got := string(src); got != want {
+		t.Errorf("unexpected program: got %q, expected %q\n", got, want)
+	}
+
+	repler.evaluate(context.Background(), ":reset")
+	if got, want := repler.evaluate(context.Background(), "1"), "$1 int = 1"; got != want {
+		t.Errorf("unexpected output after reset: got %q, expected %q\n", got, want)
+	}
+}
+
+// TestWarabiMultipleResults checks that multiple results are of lists of
+// expressions only, since functions can not return any results.
+func TestWarabiMultipleResults(t *testing.T) {
+	repler := newWarabi(strings.NewReader(""), ioutil.Discard)
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`1, "a"`, "$1 (int, string) = (1, a)"},
+		{`func f() (int, string) { return 1, "a" }`, ""},
+		{"f()", "main.go:2:26: unsupported statement: *ast.ReturnStmt"},
+	}
+	for _, test := range tests {
+		if got := repler.evaluate(context.Background(), test.src); got != test.want {
+			t.Errorf("unexpected output of %q: got %q, expected %q\n", test.src, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package repl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/tomocy/warabi/object"
+)
+
+const sessionVersion = 1
+
+// session is a snapshot of the REPL: the imported packages, and the
+// declarations in source form with the values of their variables.
+type session struct {
+	Version      int                  `json:"version"`
+	Imports      []sessionImport      `json:"imports"`
+	Declarations []sessionDeclaration `json:"declarations"`
+}
+
+type sessionImport struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// sessionDeclaration is a declaration, whose variables are restored to
+// Values rather than evaluated again if all of them are there.
+type sessionDeclaration struct {
+	Names  []string                `json:"names"`
+	Source string                  `json:"source"`
+	Values map[string]sessionValue `json:"values,omitempty"`
+}
+
+type sessionValue struct {
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
+}
+
+// snapshotSession takes the snapshot of the session, warning about
+// the values which can not be saved.
+func (repler *warabi) snapshotSession() (session, []string) {
+	s := session{
+		Version:      sessionVersion,
+		Imports:      []sessionImport{},
+		Declarations: []sessionDeclaration{},
+	}
+	env := repler.interpreter.Env()
+	for _, name := range env.Names() {
+		if pkg, ok := lookUpPackage(env, name); ok {
+			s.Imports = append(s.Imports, sessionImport{
+				Name: name,
+				Path: pkg.Path,
+			})
+		}
+	}
+
+	var warnings []string
+	for _, decl := range repler.declarations.decls {
+		d := sessionDeclaration{
+			Names:  decl.names,
+			Source: decl.src,
+		}
+		if strings.HasPrefix(decl.src, "var ") {
+			d.Values = make(map[string]sessionValue)
+			for _, name := range decl.names {
+				obj, _ := env.Get(name)
+				value, ok := encodeValue(obj)
+				if !ok {
+					warnings = append(warnings, fmt.Sprintf(
+						"warning: the value of %s can not be saved since it is %s, so it will be evaluated again from its declaration",
+						name, describeKind(obj),
+					))
+					continue
+				}
+				d.Values[name] = value
+			}
+		}
+		s.Declarations = append(s.Declarations, d)
+	}
+
+	return s, warnings
+}
+
+func lookUpPackage(env *object.Environment, name string) (*object.ImportedPackage, bool) {
+	obj, _ := env.Get(name)
+	pkg, ok := obj.(*object.ImportedPackage)
+	return pkg, ok
+}
+
+func describeKind(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+
+	return "a value of " + obj.Kind().String()
+}
+
+// restoreSession imports the packages and declares the declarations of
+// the session, evaluating the ones whose values are not saved.
+func (repler *warabi) restoreSession(ctx context.Context, s session) error {
+	if s.Version != sessionVersion {
+		return fmt.Errorf("unsupported version of session: %d", s.Version)
+	}
+
+	for _, imp := range s.Imports {
+		src := fmt.Sprintf("import %s %s", imp.Name, strconv.Quote(imp.Path))
+		if _, err := repler.interpreter.EvaluateContext(ctx, src); err != nil {
+			return err
+		}
+		if err := repler.declarations.record(packageStatement + src); err != nil {
+			return err
+		}
+	}
+	for _, d := range s.Declarations {
+		objs := make(map[string]object.Object)
+		for name, value := range d.Values {
+			obj, err := decodeValue(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+			objs[name] = obj
+		}
+		if len(d.Names) == 0 || len(objs) != len(d.Names) {
+			if _, err := repler.interpreter.EvaluateContext(ctx, d.Source); err != nil {
+				return err
+			}
+		}
+		for name, obj := range objs {
+			repler.interpreter.Env().Set(name, obj)
+		}
+		repler.declarations.add(declaration{
+			names: d.Names,
+			src:   d.Source,
+		})
+	}
+
+	return nil
+}
+
+// encodeValue encodes the object if it is of a basic kind.
+func encodeValue(obj object.Object) (sessionValue, bool) {
+	var value interface{}
+	switch obj := obj.(type) {
+	case *object.IntegerLiteral:
+		value = obj.Value
+	case *object.StringLiteral:
+		value = obj.Value
+	case *object.CharacterLiteral:
+		value = obj.Value
+	case *object.FloatingPointLiteral:
+		value = obj.Value
+	case *object.BooleanLiteral:
+		value = obj == object.True
+	default:
+		return sessionValue{}, false
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return sessionValue{}, false
+	}
+
+	return sessionValue{
+		Kind:  obj.Kind().String(),
+		Value: encoded,
+	}, true
+}
+
+func decodeValue(value sessionValue) (object.Object, error) {
+	var (
+		obj    object.Object
+		target interface{}
+	)
+	switch value.Kind {
+	case object.Integer.String():
+		lit := &object.IntegerLiteral{}
+		obj, target = lit, &lit.Value
+	case object.String.String():
+		lit := &object.StringLiteral{}
+		obj, target = lit, &lit.Value
+	case object.Character.String():
+		lit := &object.CharacterLiteral{}
+		obj, target = lit, &lit.Value
+	case object.FloatingPoint.String():
+		lit := &object.FloatingPointLiteral{}
+		obj, target = lit, &lit.Value
+	case object.Boolean.String():
+		var b bool
+		if err := json.Unmarshal(value.Value, &b); err != nil {
+			return nil, err
+		}
+		if b {
+			return object.True, nil
+		}
+		return object.False, nil
+	default:
+		return nil, fmt.Errorf("unsupported kind of value: %s", value.Kind)
+	}
+
+	if err := json.Unmarshal(value.Value, target); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// saveSession saves the session to the file, returning the warnings
+// about the values which can not be saved.
+func (repler *warabi) saveSession(filename string) ([]string, error) {
+	s, warnings := repler.snapshotSession()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return warnings, ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+func (repler *warabi) loadSession(ctx context.Context, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid session: %s", err)
+	}
+
+	return repler.restoreSession(ctx, s)
+}
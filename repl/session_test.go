@@ -0,0 +1,88 @@
+package repl
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "session.json")
+
+	saved := newWarabi(strings.NewReader(""), ioutil.Discard)
+	srcs := []string{
+		`import f "fmt"`,
+		`var a, b = 1, "x"`,
+		`var c, d, e = 'y', 1.5, true`,
+		`func hello() { f.Println("hello") }`,
+		`var g = hello`,
+		`const k = 3`,
+		`var h = f.Sprint(a, k)`,
+	}
+	for _, src := range srcs {
+		saved.evaluate(context.Background(), src)
+	}
+	want := "loaded the session from " + filename
+	if got := saved.runCommand(context.Background(), ":save-session "+filename); !strings.Contains(got, "saved the session to "+filename) {
+		t.Fatalf("unexpected output: %s\n", got)
+	} else if want := "warning: the value of g can not be saved since it is a value of func, so it will be evaluated again from its declaration\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("unexpected warning: got %q, expected %q\n", got, want)
+	}
+
+	restored := newWarabi(strings.NewReader(""), ioutil.Discard)
+	if got := restored.runCommand(context.Background(), ":load-session "+filename); got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+	for _, command := range []string{":env", ":save " + filepath.Join(dir, "main.go")} {
+		wantOut := saved.runCommand(context.Background(), command)
+		if got := restored.runCommand(context.Background(), command); got != wantOut {
+			t.Errorf("unexpected output of %s: got %q, expected %q\n", command, got, wantOut)
+		}
+	}
+	if got := restored.evaluate(context.Background(), "var check = f.Sprint(h, e)"); got != "1 3true" {
+		t.Errorf("unexpected result: %s\n", got)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte(`{"version": 2}`), 0644); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if got := restored.runCommand(context.Background(), ":load-session "+filename); got != "unsupported version of session: 2" {
+		t.Errorf("unexpected output: %s\n", got)
+	}
+}
+
+func TestWarabiREPLSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warabi")
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "session.json")
+
+	for _, test := range []struct {
+		input string
+		want  string
+	}{
+		{"var a = 1\n", "1\n\nSee you later\n"},
+		{"var b = a + 1\n", "2\n\nSee you later\n"},
+		{":env\n", "a int = 1\nb int = 2\n\nSee you later\n"},
+	} {
+		var w strings.Builder
+		repler := newWarabi(strings.NewReader(test.input), &w)
+		repler.sessionFile = filename
+
+		runREPL(t, repler)
+
+		if got := w.String(); got != test.want {
+			t.Errorf("unexpected output of %q: got %q, expected %q\n", test.input, got, test.want)
+		}
+	}
+}
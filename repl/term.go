@@ -0,0 +1,17 @@
+package repl
+
+import "os"
+
+// terminal is the terminal where the line editor edits lines.
+type terminal interface {
+	// makeRaw puts the terminal into raw mode, returning the function to
+	// restore it.
+	makeRaw() (func() error, error)
+	// width returns the number of the columns.
+	width() int
+}
+
+// newTerminal returns the terminal of f if f is a terminal.
+func newTerminal(f *os.File) (terminal, bool) {
+	return newFileTerminal(f.Fd())
+}
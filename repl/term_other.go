@@ -0,0 +1,10 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package repl
+
+// newFileTerminal reports that no file is a terminal, so that the REPL
+// scans lines as they are.
+func newFileTerminal(fd uintptr) (terminal, bool) {
+	return nil, false
+}
@@ -0,0 +1,66 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type fileTerminal struct {
+	fd uintptr
+}
+
+func newFileTerminal(fd uintptr) (terminal, bool) {
+	var termios syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&termios)); err != nil {
+		return nil, false
+	}
+
+	return fileTerminal{fd: fd}, true
+}
+
+// makeRaw disables the echo, the canonical mode and the signals as
+// cfmakeraw does, but keeps the processing of the output so that "\n"
+// still starts a new line.
+func (t fileTerminal) makeRaw() (func() error, error) {
+	var termios syscall.Termios
+	if err := ioctl(t.fd, ioctlGetTermios, unsafe.Pointer(&termios)); err != nil {
+		return nil, err
+	}
+	original := termios
+
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+	if err := ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&termios)); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&original))
+	}, nil
+}
+
+func (t fileTerminal) width() int {
+	var size struct {
+		rows, columns, x, y uint16
+	}
+	if err := ioctl(t.fd, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil || size.columns == 0 {
+		return 80
+	}
+
+	return int(size.columns)
+}
+
+func ioctl(fd, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
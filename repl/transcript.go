@@ -0,0 +1,182 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Entry is an entry of a transcript with what it output, which is
+// what the program printed followed by the result.
+type Entry struct {
+	// Line is the line of the transcript which the entry starts at.
+	Line   int
+	Input  string
+	Output string
+}
+
+// WriteTranscript writes the entries as a transcript, where they are
+// written as they are in the REPL: the first line of an input follows
+// "> " and the rest follow "... ", and then the output follows. The
+// lines of the output which could be taken for inputs are escaped with
+// a leading backslash.
+func WriteTranscript(w io.Writer, entries []Entry) error {
+	for _, entry := range entries {
+		if err := writeEntry(w, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeEntry(w io.Writer, entry Entry) error {
+	var b strings.Builder
+	for i, line := range strings.Split(entry.Input, "\n") {
+		if i == 0 {
+			b.WriteString(prompt)
+		} else {
+			b.WriteString(continuationPrompt)
+		}
+		b.WriteString(line + "\n")
+	}
+	if entry.Output != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(entry.Output, "\n"), "\n") {
+			if strings.HasPrefix(line, strings.TrimSpace(prompt)) || strings.HasPrefix(line, strings.TrimSpace(continuationPrompt)) || strings.HasPrefix(line, `\`) {
+				line = `\` + line
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ReadTranscript reads the entries of a transcript.
+func ReadTranscript(r io.Reader) ([]Entry, error) {
+	var (
+		entries   []Entry
+		inputDone bool
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, prompt) || line == strings.TrimSpace(prompt):
+			entries = append(entries, Entry{
+				Line:  n,
+				Input: strings.TrimPrefix(strings.TrimPrefix(line, strings.TrimSpace(prompt)), " "),
+			})
+			inputDone = false
+		case len(entries) == 0:
+			return nil, fmt.Errorf("line %d: output without input", n)
+		case !inputDone && (strings.HasPrefix(line, continuationPrompt) || line == strings.TrimSpace(continuationPrompt)):
+			entry := &entries[len(entries)-1]
+			entry.Input += "\n" + strings.TrimPrefix(strings.TrimPrefix(line, strings.TrimSpace(continuationPrompt)), " ")
+		default:
+			inputDone = true
+			entry := &entries[len(entries)-1]
+			entry.Output += strings.TrimPrefix(line, `\`) + "\n"
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// entryOutput returns what the entry src output: what the program
+// printed followed by the result as the REPL prints it to what is not
+// a terminal, ending with a newline as the transcript does.
+func entryOutput(src, printed string, result entryResult) string {
+	output := printed
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+	if plain := result.render(src, false, false); plain != "" {
+		output += plain + "\n"
+	}
+
+	return output
+}
+
+// recorder records the entries which the REPL evaluates and what they
+// output into a transcript.
+type recorder struct {
+	w io.Writer
+
+	mu     sync.Mutex
+	output bytes.Buffer
+}
+
+// Write captures what programs print while an entry is evaluated.
+func (r *recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.output.Write(p)
+}
+
+// evaluate evaluates the entry as repler.evaluate does, recording it
+// with what it output.
+func (r *recorder) evaluate(repler *warabi) func(context.Context, string) string {
+	return func(ctx context.Context, src string) string {
+		r.mu.Lock()
+		r.output.Reset()
+		r.mu.Unlock()
+
+		result := repler.evaluateEntry(ctx, src)
+		if strings.TrimSpace(src) == "" {
+			return result.render(src, repler.color, repler.terminal)
+		}
+
+		r.mu.Lock()
+		printed := r.output.String()
+		r.mu.Unlock()
+		entry := Entry{
+			Input:  src,
+			Output: entryOutput(src, printed, result),
+		}
+		if err := writeEntry(r.w, entry); err != nil {
+			repler.printf("failed to record the entry: %s\n", err)
+		}
+
+		return result.render(src, repler.color, repler.terminal)
+	}
+}
+
+// WithTranscript records the entries and what they output into w as
+// a transcript.
+func WithTranscript(w io.Writer) Option {
+	return func(repler *warabi) {
+		repler.transcript = w
+	}
+}
+
+// Replay evaluates the inputs of the entries in a new session of
+// the REPL, returning the entries with what they output this time.
+func Replay(entries []Entry, opts ...Option) []Entry {
+	var output bytes.Buffer
+	repler := newWarabi(strings.NewReader(""), &output)
+	for _, opt := range opts {
+		opt(repler)
+	}
+	repler.interpreter.SetOutput(&output)
+
+	replayed := make([]Entry, len(entries))
+	for i, entry := range entries {
+		output.Reset()
+		result := repler.evaluateEntry(context.Background(), entry.Input)
+		replayed[i] = Entry{
+			Line:   entry.Line,
+			Input:  entry.Input,
+			Output: entryOutput(entry.Input, output.String(), result),
+		}
+	}
+
+	return replayed
+}
@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTranscript(t *testing.T) {
+	entries := []Entry{
+		{Line: 1, Input: "var a = 1", Output: "1\n"},
+		{Line: 3, Input: "func f() {\n\tprintln(a)\n}"},
+		{Line: 6, Input: `import "fmt"`},
+		{Line: 7, Input: `var s = fmt.Sprint("> ", 2)`, Output: "> 2\n"},
+		{Line: 9, Input: "var b = c", Output: "main.go:2:9: undefined: c\n"},
+	}
+	var b strings.Builder
+	if err := WriteTranscript(&b, entries); err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	want := "> var a = 1\n1\n" +
+		"> func f() {\n... \tprintln(a)\n... }\n" +
+		"> import \"fmt\"\n" +
+		"> var s = fmt.Sprint(\"> \", 2)\n\\> 2\n" +
+		"> var b = c\nmain.go:2:9: undefined: c\n"
+	if got := b.String(); got != want {
+		t.Errorf("unexpected transcript: got %q, expected %q\n", got, want)
+	}
+
+	got, err := ReadTranscript(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("unexpected entries: got %#v, expected %#v\n", got, entries)
+	}
+
+	if _, err := ReadTranscript(strings.NewReader("1\n> var a = 1\n")); err == nil || err.Error() != "line 1: output without input" {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	entries := []Entry{
+		{Line: 1, Input: "var a = 1"},
+		{Line: 2, Input: `import "fmt"`},
+		{Line: 3, Input: `var n = fmt.Println("hello")`},
+		{Line: 4, Input: "var b = a / 0"},
+		{Line: 5, Input: ":env"},
+	}
+	want := []Entry{
+		{Line: 1, Input: "var a = 1", Output: "1\n"},
+		{Line: 2, Input: `import "fmt"`},
+		{Line: 3, Input: `var n = fmt.Println("hello")`, Output: "hello\nmain.go:2:9: fmt.Println(\"hello\") (no value) used as value\n"},
+		{Line: 4, Input: "var b = a / 0", Output: "main.go:2:11: runtime error: integer divide by zero\n"},
+		{Line: 5, Input: ":env", Output: "a int = 1\nfmt package = package fmt (\"fmt\")\n"},
+	}
+	if got := Replay(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected entries: got %#v, expected %#v\n", got, want)
+	}
+}
+
+func TestWarabiREPLTranscript(t *testing.T) {
+	var w, transcript strings.Builder
+	repler := newWarabi(strings.NewReader("var a = 1\n\nimport \"fmt\"\nvar n = fmt.Println(\"> \", a)\nvar b = c\n"), &w)
+	repler.transcript = &transcript
+
+	runREPL(t, repler)
+
+	want := "> var a = 1\n1\n" +
+		"> import \"fmt\"\n" +
+		"> var n = fmt.Println(\"> \", a)\n\\>  1\nmain.go:2:9: fmt.Println(\"> \", a) (no value) used as value\n" +
+		"> var b = c\nmain.go:2:9: undefined: c\n"
+	if got := transcript.String(); got != want {
+		t.Errorf("unexpected transcript: got %q, expected %q\n", got, want)
+	}
+	if got, want := w.String(), "1\n>  1\nmain.go:2:9: fmt.Println(\"> \", a) (no value) used as value\nmain.go:2:9: undefined: c\n\nSee you later\n"; got != want {
+		t.Errorf("unexpected output: got %q, expected %q\n", got, want)
+	}
+}
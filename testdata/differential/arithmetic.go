@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+var a, b = 17, 5
+
+func main() {
+	fmt.Println(a+b, a-b, a*b, a/b, a%b)
+	fmt.Println(-a/b, -a%b, a/-b, a%-b)
+	fmt.Println(a < b, a > b, a <= b, a >= b, a == b, a != b)
+	fmt.Println((a + b) * (a - b))
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	t, f := true, false
+	fmt.Println(!t, !f, !!t)
+	fmt.Println(t == f, t != f, t == !f)
+	fmt.Println((1 < 2) == (2 < 3), (1 > 2) != (3 > 2))
+}
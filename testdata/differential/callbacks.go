@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+func greet(name string, greeting func(string)) {
+	greeting(name)
+}
+
+func main() {
+	prefix := "hello"
+	greet("gopher", func(name string) {
+		fmt.Println(prefix + ", " + name)
+	})
+	greet("warabi", func(string) {
+		fmt.Println("ignored")
+	})
+	greet("mochi", func(_ string) {
+		fmt.Println(prefix)
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+func twice(f func(string)) {
+	f("first")
+	f("second")
+}
+
+// chain calls done after n levels of calls, each of which wraps done in
+// a closure capturing its own level.
+func chain(n int, done func(string)) {
+	if n == 0 {
+		done("end")
+	} else {
+		chain(n-1, func(s string) {
+			done(fmt.Sprint(s, "<", n))
+		})
+	}
+}
+
+func main() {
+	prefix := "outer"
+	twice(func(s string) {
+		prefix := prefix + "/" + s
+		twice(func(t string) {
+			fmt.Println(prefix, t)
+		})
+	})
+	fmt.Println(prefix)
+
+	chain(4, func(s string) {
+		fmt.Println(s)
+	})
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	a := 'a'
+	fmt.Println(a, a == 'a', a < 'b', 'z'-a)
+	fmt.Printf("%c %q %d\n", a, a, a)
+	fmt.Println('\n', '\t', '\'')
+}
@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+func apply(f func(int), n int) {
+	f(n)
+}
+
+func main() {
+	base := 40
+	add := func(n int) {
+		fmt.Println(base + n)
+	}
+	apply(add, 2)
+	apply(func(n int) {
+		inner := n * 2
+		show := func() {
+			fmt.Println(inner, base)
+		}
+		show()
+	}, 21)
+}
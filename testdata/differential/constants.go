@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println('a'+1, 'a'*2.5, 1+2.5, -'a', ^5, +3)
+	fmt.Println(0x1f, 0o17, 0b101, 1_000_000, 017)
+	fmt.Println(1.5e3, 0x1p4, -2.5, 1_0.5)
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	zero := 0
+	fmt.Println("before")
+	fmt.Println(1 / zero)
+	fmt.Println("after")
+}
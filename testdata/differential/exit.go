@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func finish(code int) {
+	fmt.Println("exiting with", code)
+	os.Exit(code)
+}
+
+func main() {
+	finish(3)
+	fmt.Println("unreachable")
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	a := 1.5
+	b := 0.25
+	fmt.Println(a+b, a-b, a*b, a/b)
+	fmt.Println(a < b, a == 1.5)
+	fmt.Println(a * 2)
+}
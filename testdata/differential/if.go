@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+func sign(n int) {
+	if n < 0 {
+		fmt.Println(n, "is negative")
+	} else if n == 0 {
+		fmt.Println(n, "is zero")
+	} else {
+		fmt.Println(n, "is positive")
+	}
+}
+
+func main() {
+	sign(-3)
+	sign(0)
+	sign(7)
+	if x := 10; x > 5 {
+		fmt.Println("x is", x)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+var (
+	total = base * 2
+	base  = 21
+)
+
+func init() {
+	fmt.Println("init", base)
+}
+
+func init() {
+	fmt.Println("init again", total)
+}
+
+func main() {
+	fmt.Println("main", total+base)
+}
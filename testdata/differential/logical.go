@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func yes(name string) bool {
+	fmt.Println("evaluated", name)
+	return true
+}
+
+func main() {
+	t, f := true, false
+	fmt.Println(t && f, t || f, f || f, t && t)
+	fmt.Println(f && yes("right of &&"), t || yes("right of ||"))
+}
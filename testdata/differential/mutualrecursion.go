@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+func even(n int, report func(bool)) {
+	if n == 0 {
+		report(true)
+	} else {
+		odd(n-1, report)
+	}
+}
+
+func odd(n int, report func(bool)) {
+	if n == 0 {
+		report(false)
+	} else {
+		even(n-1, report)
+	}
+}
+
+func fib(n int, report func(int)) {
+	if n < 2 {
+		report(n)
+	} else {
+		fib(n-1, func(a int) {
+			fib(n-2, func(b int) {
+				report(a + b)
+			})
+		})
+	}
+}
+
+func parity(n int) {
+	even(n, func(ok bool) {
+		fmt.Println(n, ok)
+	})
+}
+
+func main() {
+	parity(0)
+	parity(7)
+	parity(10)
+	fib(15, func(n int) {
+		fmt.Println("fib", n)
+	})
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+func check(n int) {
+	if n%2 == 1 {
+		panic(fmt.Sprint("odd: ", n))
+	}
+	fmt.Println("even", n)
+}
+
+func main() {
+	check(2)
+	check(3)
+	fmt.Println("unreachable")
+}
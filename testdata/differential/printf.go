@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func main() {
+	n, s := 42, "go"
+	fmt.Printf("%d %5d %-5d| %o %X %b\n", n, n, n, n, n, n)
+	fmt.Printf("%s %q %v %T %T\n", s, s, s, s, n)
+	fmt.Printf("%6.2f %e %g\n", 3.25, 1.5, 0.5)
+	fmt.Printf("%t %v %%\n", true, false)
+	fmt.Printf("%d %s\n", "wrong", 1)
+	fmt.Printf("%d\n")
+	fmt.Printf("%d\n", 1, 2)
+}
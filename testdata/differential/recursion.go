@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+func countdown(n int) {
+	if n == 0 {
+		fmt.Println("liftoff")
+	} else {
+		fmt.Println(n)
+		countdown(n - 1)
+	}
+}
+
+func main() {
+	countdown(3)
+}
@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+var x = 1
+
+func main() {
+	fmt.Println(x)
+	x := 2
+	fmt.Println(x)
+	{
+		x := 3
+		fmt.Println(x)
+	}
+	fmt.Println(x)
+	if x := 4; x > 0 {
+		fmt.Println(x)
+	}
+	fmt.Println(x)
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+var skipped = !false || []int{1}[0] == 1
+
+func main() {
+	fmt.Println(skipped)
+	unevaluated := false && *new(int) == 0
+	fmt.Println(unevaluated)
+	fmt.Println(true || len("go") == 2, false && cap([]int{}) == 0)
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	s := fmt.Sprint("a", 1, 2, "b")
+	fmt.Println(s, s+s)
+	fmt.Print(fmt.Sprintln("line", 3))
+	fmt.Println(fmt.Sprintf("%03d|%-4s|%x", 7, "ab", 255))
+}
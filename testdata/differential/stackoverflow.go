@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func descend(n int) {
+	descend(n + 1)
+}
+
+func main() {
+	fmt.Println("descending")
+	descend(0)
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+var greeting = "hello"
+
+func main() {
+	name := "warabi"
+	fmt.Println(greeting + ", " + name)
+	fmt.Println(greeting == "hello", greeting != name, greeting < name)
+	fmt.Printf("%q %s %v %5s|\n", name, name, name, "go")
+	fmt.Print("no", "space", 1, 2, "\n")
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+var (
+	i int
+	s string
+	b bool
+	f float64
+	r rune
+)
+
+func main() {
+	fmt.Println(i, s == "", b, f, r)
+	fmt.Printf("%q %v\n", s, i+1)
+}